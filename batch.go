@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	defaultBatchConcurrency = 3
+	maxBatchConcurrency     = 8
+	// defaultBatchRate is the default number of analysis requests started per minute.
+	defaultBatchRate = 30
+	maxBatchFiles    = 1000
+	maxBatchRetries  = 2
+)
+
+// batchCSVHeader is the column layout of CSV batch output.
+var batchCSVHeader = []string{"file", "status", "result", "error", "completed_at"}
+
+// batchOptions configures RunBatch.
+type batchOptions struct {
+	Directory     string
+	Patterns      []string
+	Prompt        string
+	Output        string // .csv or .jsonl
+	Concurrency   int
+	RatePerMinute int
+}
+
+// batchRecord is the outcome for one file, written as one CSV row or JSON line.
+type batchRecord struct {
+	File        string `json:"file"`
+	Status      string `json:"status"` // "ok" or "error"
+	Result      string `json:"result,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CompletedAt string `json:"completed_at"`
+}
+
+// batchSummary is the result of RunBatch.
+type batchSummary struct {
+	Output    string `json:"output"`
+	Matched   int    `json:"matched"`
+	Skipped   int    `json:"skippedDone"`     // already succeeded in an earlier run
+	NotMedia  int    `json:"skippedNotMedia"` // matched the glob but aren't images, PDFs, audio or video
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+}
+
+// RunBatch runs prompt over every image, PDF, audio and video file matching the patterns,
+// analysing up to Concurrency files at a time and starting at most RatePerMinute requests a
+// minute. Each result is appended to the output file as soon as it is ready, so an interrupted
+// run can be resumed: files that already succeeded in the output are skipped and failed ones
+// are retried. When the run ends the output is rewritten with one record per file. progress,
+// if not nil, is called after each file.
+func RunBatch(ctx context.Context, client *genai.Client, opts batchOptions, progress func(done, total int, rec batchRecord)) (*batchSummary, error) {
+	if strings.TrimSpace(opts.Prompt) == "" {
+		return nil, fmt.Errorf("prompt must not be empty")
+	}
+	format := strings.ToLower(filepath.Ext(opts.Output))
+	if format != ".csv" && format != ".jsonl" {
+		return nil, fmt.Errorf("output must be a .csv or .jsonl file")
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultBatchConcurrency
+	}
+	opts.Concurrency = min(opts.Concurrency, maxBatchConcurrency)
+	if opts.RatePerMinute <= 0 {
+		opts.RatePerMinute = defaultBatchRate
+	}
+
+	outPath, err := resolvePath(opts.Output)
+	if err != nil {
+		return nil, err
+	}
+	if err := workspace.CheckWrite(outPath); err != nil {
+		return nil, err
+	}
+	found, err := FindFiles(opts.Directory, opts.Patterns, "path", maxBatchFiles, false)
+	if err != nil {
+		return nil, err
+	}
+	root, err := resolvePath(opts.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := os.ReadFile(outPath)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read existing output: %v", err)
+	}
+	records, order, err := parseBatchOutput(before, format)
+	if err != nil {
+		return nil, fmt.Errorf("can't resume from %s: %v", opts.Output, err)
+	}
+
+	summary := &batchSummary{Output: outPath, Matched: found.Total}
+	var todo []string
+	for _, f := range found.Files {
+		full := filepath.Join(root, filepath.FromSlash(f.Path))
+		if full == outPath {
+			continue
+		}
+		if rec, ok := records[f.Path]; ok && rec.Status == "ok" {
+			summary.Skipped++
+			continue
+		}
+		if mimeType, err := sniffFile(full); err != nil || mediaCategory(mimeType) == "" {
+			summary.NotMedia++
+			continue
+		}
+		todo = append(todo, f.Path)
+	}
+
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output: %v", err)
+	}
+	if format == ".csv" && len(before) == 0 {
+		writeBatchRecord(out, format, nil)
+	} else if len(before) > 0 && before[len(before)-1] != '\n' {
+		// Don't run on from a record that was cut off by an earlier crash.
+		out.Write([]byte("\n"))
+	}
+
+	// A single ticker spaces out request starts across all workers.
+	ticker := time.NewTicker(time.Minute / time.Duration(opts.RatePerMinute))
+	defer ticker.Stop()
+	jobs := make(chan string)
+	// Buffered so workers never block once the run is cancelled.
+	results := make(chan batchRecord, len(todo))
+	for i := 0; i < opts.Concurrency; i++ {
+		go func() {
+			for rel := range jobs {
+				results <- analyseBatchFile(ctx, client, ticker.C, filepath.Join(root, filepath.FromSlash(rel)), rel, opts.Prompt)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, rel := range todo {
+			select {
+			case jobs <- rel:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for done := 0; done < len(todo); done++ {
+		var rec batchRecord
+		select {
+		case rec = <-results:
+		case <-ctx.Done():
+			summary.Cancelled = true
+		}
+		if summary.Cancelled {
+			break
+		}
+		if ctx.Err() != nil && rec.Status == "error" {
+			// Failures caused by cancellation aren't recorded, so they are retried on resume.
+			summary.Cancelled = true
+			break
+		}
+		if _, seen := records[rec.File]; !seen {
+			order = append(order, rec.File)
+		}
+		records[rec.File] = rec
+		writeBatchRecord(out, format, &rec)
+		if rec.Status == "ok" {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		if progress != nil {
+			progress(done+1, len(todo), rec)
+		}
+	}
+	out.Close()
+
+	// Compact the output to one record per file, keeping the latest, and make the run undoable.
+	var buf bytes.Buffer
+	if format == ".csv" {
+		writeBatchRecord(&buf, format, nil)
+	}
+	for _, file := range order {
+		rec := records[file]
+		writeBatchRecord(&buf, format, &rec)
+	}
+	if err := writeFileAtomic(outPath, buf.Bytes(), 0644); err != nil {
+		log.Printf("Warning: failed to compact %s: %v\n", outPath, err)
+	}
+	journal.record(outPath, "batch_analyze", existed, before, buf.Bytes())
+	return summary, nil
+}
+
+// analyseBatchFile analyses one file, waiting for the rate limiter before each attempt and
+// retrying failures a few times, backing off longer when the API reports a quota error.
+func analyseBatchFile(ctx context.Context, client *genai.Client, tick <-chan time.Time, path, rel, prompt string) batchRecord {
+	rec := batchRecord{File: rel}
+	var err error
+	for attempt := 0; attempt <= maxBatchRetries; attempt++ {
+		select {
+		case <-tick:
+		case <-ctx.Done():
+			err = ctx.Err()
+			attempt = maxBatchRetries
+			continue
+		}
+		var result string
+		result, err = ReadFileContentWithAI(ctx, client, []string{path}, prompt)
+		if err == nil {
+			rec.Status, rec.Result = "ok", strings.TrimSpace(result)
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if isRateLimited(err) && attempt < maxBatchRetries {
+			select {
+			case <-time.After(time.Duration(10<<attempt) * time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}
+	if err != nil {
+		rec.Status, rec.Error = "error", err.Error()
+	}
+	rec.CompletedAt = time.Now().Format(time.RFC3339)
+	return rec
+}
+
+// isRateLimited reports whether err is a quota or rate limit error from the API.
+func isRateLimited(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "429") || strings.Contains(msg, "RESOURCE_EXHAUSTED") || strings.Contains(strings.ToLower(msg), "quota")
+}
+
+// writeBatchRecord writes one record, or the CSV header when rec is nil.
+func writeBatchRecord(w io.Writer, format string, rec *batchRecord) {
+	if format == ".jsonl" {
+		if rec != nil {
+			data, _ := json.Marshal(rec)
+			w.Write(append(data, '\n'))
+		}
+		return
+	}
+	cw := csv.NewWriter(w)
+	if rec == nil {
+		cw.Write(batchCSVHeader)
+	} else {
+		cw.Write([]string{rec.File, rec.Status, rec.Result, rec.Error, rec.CompletedAt})
+	}
+	cw.Flush()
+}
+
+// parseBatchOutput reads the records of an earlier run, keeping the last record for each file,
+// and returns them with the files in first-seen order.
+func parseBatchOutput(data []byte, format string) (map[string]batchRecord, []string, error) {
+	records := make(map[string]batchRecord)
+	var order []string
+	add := func(rec batchRecord) {
+		if rec.File == "" {
+			return
+		}
+		if _, ok := records[rec.File]; !ok {
+			order = append(order, rec.File)
+		}
+		records[rec.File] = rec
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return records, order, nil
+	}
+
+	if format == ".jsonl" {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var rec batchRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				// A run killed mid-write can leave a partial last line; ignore it.
+				if i == bytes.Count(data, []byte("\n")) {
+					continue
+				}
+				return nil, nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			add(rec)
+		}
+		return records, order, nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A run killed mid-write can leave the last row partial, often inside a quoted
+			// result; ignore it if reading it used up the rest of the file.
+			if r.InputOffset() == int64(len(data)) {
+				break
+			}
+			return nil, nil, err
+		}
+		if i == 0 && len(row) > 0 && row[0] == batchCSVHeader[0] {
+			continue
+		}
+		if len(row) < len(batchCSVHeader) {
+			continue
+		}
+		add(batchRecord{File: row[0], Status: row[1], Result: row[2], Error: row[3], CompletedAt: row[4]})
+	}
+	return records, order, nil
+}
+
+var batchAnalyzeSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"patterns": {
+			Type:        genai.TypeArray,
+			Items:       &genai.Schema{Type: genai.TypeString},
+			Description: "Glob patterns selecting the files, e.g. 'photos/*.jpg' or '*.pdf'. Only images, PDFs, audio and video are analysed.",
+		},
+		"prompt": {
+			Type:        genai.TypeString,
+			Description: "What to produce for each file, e.g. 'Write one sentence of alt text'.",
+		},
+		"output": {
+			Type:        genai.TypeString,
+			Description: "Results file ending in .csv or .jsonl. If it already exists, files that succeeded before are skipped.",
+		},
+		"directory": {
+			Type:        genai.TypeString,
+			Description: "Directory the patterns are relative to. Defaults to the current working directory.",
+		},
+		"concurrency": {
+			Type:        genai.TypeInteger,
+			Description: "Files analysed at the same time (default 3, max 8).",
+		},
+		"ratePerMinute": {
+			Type:        genai.TypeInteger,
+			Description: "Maximum analysis requests started per minute (default 30).",
+		},
+	},
+	Required: []string{"patterns", "prompt", "output"},
+}
+
+var BatchAnalyzeTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "batch_analyze",
+			Description: "Runs the same media analysis prompt over every image, PDF, audio or video file matching a glob " +
+				"(captions, alt text, summaries) and writes one result per file to a CSV or JSONL file. Re-running with the same output resumes.",
+			Parameters: batchAnalyzeSchema,
+		},
+	},
+}
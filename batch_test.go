@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// batchOutput writes records as RunBatch does, with the CSV header first.
+func batchOutput(format string, recs ...batchRecord) []byte {
+	var buf bytes.Buffer
+	writeBatchRecord(&buf, format, nil)
+	for i := range recs {
+		writeBatchRecord(&buf, format, &recs[i])
+	}
+	return buf.Bytes()
+}
+
+func TestParseBatchOutput(t *testing.T) {
+	a := batchRecord{File: "a.jpg", Status: "error", Error: "rate limited", CompletedAt: "2024-05-01T10:00:00Z"}
+	b := batchRecord{File: "b.pdf", Status: "ok", Result: "Invoice, \"paid\"\nTotal: 42", CompletedAt: "2024-05-01T10:00:01Z"}
+	aRetried := batchRecord{File: "a.jpg", Status: "ok", Result: "A cat", CompletedAt: "2024-05-01T10:05:00Z"}
+	c := batchRecord{File: "c.png", Status: "ok", Result: "A long description\nover \"several\" lines", CompletedAt: "2024-05-01T10:05:01Z"}
+
+	for _, format := range []string{".csv", ".jsonl"} {
+		complete := batchOutput(format, a, b, aRetried)
+		withC := batchOutput(format, a, b, aRetried, c)
+		// Cut the last record short, inside its quoted result for CSV.
+		partial := withC[:len(withC)-len("lines\",2024-05-01T10:05:01Z\n")]
+
+		tests := []struct {
+			name    string
+			data    []byte
+			want    map[string]batchRecord
+			order   []string
+			wantErr bool
+		}{
+			{"empty", nil, map[string]batchRecord{}, nil, false},
+			{"header only", batchOutput(format), map[string]batchRecord{}, nil, false},
+			{"last record wins", complete, map[string]batchRecord{"a.jpg": aRetried, "b.pdf": b}, []string{"a.jpg", "b.pdf"}, false},
+			{"partial last record", partial, map[string]batchRecord{"a.jpg": aRetried, "b.pdf": b}, []string{"a.jpg", "b.pdf"}, false},
+			{"all records", withC, map[string]batchRecord{"a.jpg": aRetried, "b.pdf": b, "c.png": c}, []string{"a.jpg", "b.pdf", "c.png"}, false},
+			{"corrupt record before the end", append([]byte("{oops\na\"b,\"c\n"), complete...), nil, nil, true},
+		}
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				got, order, err := parseBatchOutput(tt.data, format)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("records = %+v, want %+v", got, tt.want)
+				}
+				if !reflect.DeepEqual(order, tt.order) {
+					t.Errorf("order = %q, want %q", order, tt.order)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckpointDir is where shadow repositories are kept, relative to the user's home directory.
+const CheckpointDir = ".myapp_checkpoints"
+
+// checkpointRefPrefix holds one ref per checkpoint in the shadow repository, named by the
+// time it was taken. Checkpoints don't link to each other, so old ones can be pruned.
+const checkpointRefPrefix = "refs/checkpoints/"
+
+const (
+	// maxCheckpoints is how many checkpoints are kept per project before the oldest are pruned.
+	maxCheckpoints = 100
+	// maxCheckpointFileSize is the largest file included in a checkpoint.
+	maxCheckpointFileSize = 10 * 1024 * 1024
+)
+
+// checkpointStore snapshots the working tree into a git object store that lives outside the
+// project, so the user's own .git is never touched and changes made by run_command are covered too.
+type checkpointStore struct {
+	gitDir         string
+	workTree       string
+	disabled       bool
+	maxCheckpoints int
+	maxFileSize    int64
+	skipped        map[string]bool // large files already reported
+
+	prompt string // user input for the current turn
+	taken  bool   // whether the current turn already has a checkpoint
+}
+
+// Checkpoint is one snapshot of the working tree.
+type Checkpoint struct {
+	ID     string
+	Time   time.Time
+	Prompt string
+}
+
+var checkpoints *checkpointStore
+
+// newCheckpointStore prepares a shadow repository for workTree. Checkpoints are disabled
+// (with a warning) if git is not installed or the store can't be created.
+func newCheckpointStore(workTree string) *checkpointStore {
+	s := &checkpointStore{
+		workTree:       workTree,
+		maxCheckpoints: maxCheckpoints,
+		maxFileSize:    maxCheckpointFileSize,
+		skipped:        make(map[string]bool),
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		log.Println("Warning: git not found; workspace checkpoints are disabled")
+		s.disabled = true
+		return s
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("Warning: workspace checkpoints are disabled: %v\n", err)
+		s.disabled = true
+		return s
+	}
+
+	sum := sha256.Sum256([]byte(workTree))
+	s.gitDir = filepath.Join(homeDir, CheckpointDir, hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(filepath.Join(s.gitDir, "HEAD")); os.IsNotExist(err) {
+		err := os.MkdirAll(s.gitDir, 0700)
+		if err == nil {
+			err = exec.Command("git", "init", "--bare", "--quiet", s.gitDir).Run()
+		}
+		if err != nil {
+			log.Printf("Warning: workspace checkpoints are disabled: %v\n", err)
+			s.disabled = true
+		}
+	}
+	return s
+}
+
+// git runs a git command against the shadow repository and the project's working tree.
+func (s *checkpointStore) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.workTree
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+s.gitDir,
+		"GIT_WORK_TREE="+s.workTree,
+		"GIT_INDEX_FILE="+filepath.Join(s.gitDir, "checkpoint-index"),
+		"GIT_AUTHOR_NAME=checkpoint",
+		"GIT_AUTHOR_EMAIL=checkpoint@localhost",
+		"GIT_COMMITTER_NAME=checkpoint",
+		"GIT_COMMITTER_EMAIL=checkpoint@localhost",
+	)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// BeginTurn remembers the user's input so the next tool call can be checkpointed under it.
+func (s *checkpointStore) BeginTurn(prompt string) {
+	s.prompt = prompt
+	s.taken = false
+}
+
+// EnsureCheckpoint snapshots the working tree once per turn, before the first tool runs.
+func (s *checkpointStore) EnsureCheckpoint() {
+	if s == nil || s.disabled || s.taken {
+		return
+	}
+	s.taken = true
+	if _, err := s.snapshot(s.prompt); err != nil {
+		log.Printf("Warning: failed to create checkpoint: %v\n", err)
+		return
+	}
+	if err := s.prune(); err != nil {
+		log.Printf("Warning: failed to prune old checkpoints: %v\n", err)
+	}
+}
+
+// snapshot records the current working tree as a new checkpoint and returns its ID.
+// Files matched by the project's .gitignore, files over the size limit and the checkpoint
+// store itself are not included.
+func (s *checkpointStore) snapshot(message string) (string, error) {
+	pathspec := []string{"."}
+	if rel, err := filepath.Rel(s.workTree, filepath.Dir(s.gitDir)); err == nil && rel != "." &&
+		rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// Started from the home directory or a parent of it: don't add the store to itself.
+		pathspec = append(pathspec, ":(exclude,literal)"+filepath.ToSlash(rel))
+	}
+
+	large, err := s.largeFiles(pathspec)
+	if err != nil {
+		return "", err
+	}
+	if len(large) > 0 {
+		// Drop earlier versions from the index too, or the snapshot would keep a stale copy.
+		args := []string{"update-index", "--force-remove", "--"}
+		for _, p := range large {
+			args = append(args, p)
+			pathspec = append(pathspec, ":(exclude,literal)"+p)
+		}
+		if _, err := s.git(args...); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := s.git(append([]string{"add", "--all", "--"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	tree, err := s.git("write-tree")
+	if err != nil {
+		return "", err
+	}
+	commit, err := s.git("commit-tree", tree, "-m", oneLine(message))
+	if err != nil {
+		return "", err
+	}
+	ref := fmt.Sprintf("%s%020d", checkpointRefPrefix, time.Now().UnixNano())
+	if _, err := s.git("update-ref", ref, commit); err != nil {
+		return "", err
+	}
+	return commit[:12], nil
+}
+
+// largeFiles returns new or changed files within pathspec that are over the size limit,
+// warning once about each.
+func (s *checkpointStore) largeFiles(pathspec []string) ([]string, error) {
+	out, err := s.git(append([]string{"ls-files", "-z", "--others", "--modified", "--exclude-standard", "--"}, pathspec...)...)
+	if err != nil {
+		return nil, err
+	}
+	var large []string
+	for _, p := range strings.Split(out, "\x00") {
+		if p == "" {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(s.workTree, filepath.FromSlash(p)))
+		if err != nil || !info.Mode().IsRegular() || info.Size() <= s.maxFileSize {
+			continue
+		}
+		large = append(large, p)
+		if !s.skipped[p] {
+			s.skipped[p] = true
+			log.Printf("Warning: %s is larger than %d MB and is not included in checkpoints\n", p, s.maxFileSize>>20)
+		}
+	}
+	return large, nil
+}
+
+// refs returns the checkpoint refs, newest first.
+func (s *checkpointStore) refs(format string) ([]string, error) {
+	out, err := s.git("for-each-ref", "--sort=-refname", "--sort=-committerdate", "--format="+format, checkpointRefPrefix)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// prune deletes the oldest checkpoints once there are more than maxCheckpoints. It keeps
+// three quarters of the limit, so the object store is only garbage collected now and then.
+func (s *checkpointStore) prune() error {
+	refs, err := s.refs("%(refname)")
+	if err != nil || len(refs) <= s.maxCheckpoints {
+		return err
+	}
+	for _, ref := range refs[s.maxCheckpoints*3/4:] {
+		if _, err := s.git("update-ref", "-d", ref); err != nil {
+			return err
+		}
+	}
+	_, err = s.git("gc", "--prune=now", "--quiet")
+	return err
+}
+
+// List returns checkpoints newest first.
+func (s *checkpointStore) List() ([]Checkpoint, error) {
+	if s.disabled {
+		return nil, fmt.Errorf("workspace checkpoints are disabled")
+	}
+	refs, err := s.refs("%(objectname)%00%(committerdate:unix)%00%(subject)")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Checkpoint
+	for _, line := range refs {
+		parts := strings.SplitN(line, "\x00", 3)
+		if len(parts) != 3 || len(parts[0]) < 12 {
+			continue
+		}
+		secs, _ := strconv.ParseInt(parts[1], 10, 64)
+		list = append(list, Checkpoint{ID: parts[0][:12], Time: time.Unix(secs, 0), Prompt: parts[2]})
+	}
+	return list, nil
+}
+
+// Restore rolls the working tree back to checkpoint id. The current state is checkpointed
+// first, so a restore can itself be undone.
+func (s *checkpointStore) Restore(id string) (string, error) {
+	if s.disabled {
+		return "", fmt.Errorf("workspace checkpoints are disabled")
+	}
+	target, err := s.git("rev-parse", "--verify", "--quiet", id+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown checkpoint '%s'", id)
+	}
+
+	// The snapshot also loads the current files into the shadow index, which is what lets
+	// read-tree remove files created after the target checkpoint.
+	backup, err := s.snapshot("before /restore " + id)
+	if err != nil {
+		return "", fmt.Errorf("failed to checkpoint current state: %v", err)
+	}
+	if _, err := s.git("read-tree", "--reset", "-u", target); err != nil {
+		return "", err
+	}
+	if err := s.prune(); err != nil {
+		log.Printf("Warning: failed to prune old checkpoints: %v\n", err)
+	}
+	return fmt.Sprintf("restored working tree to checkpoint %s (previous state saved as %s)", id, backup), nil
+}
+
+// oneLine flattens a prompt into a single commit subject line.
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "(no prompt)"
+	}
+	if r := []rune(s); len(r) > 100 {
+		s = string(r[:100]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestCheckpointStore returns a store for workTree with its shadow repository under a
+// temporary home directory, or under home if given.
+func newTestCheckpointStore(t *testing.T, workTree, home string) *checkpointStore {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if home == "" {
+		home = t.TempDir()
+	}
+	t.Setenv("HOME", home)
+	s := newCheckpointStore(workTree)
+	if s.disabled {
+		t.Fatal("checkpoints are disabled")
+	}
+	return s
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkpointFiles lists the files stored in checkpoint id.
+func checkpointFiles(t *testing.T, s *checkpointStore, id string) []string {
+	t.Helper()
+	out, err := s.git("ls-tree", "-r", "--name-only", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(out)
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go":     "package main\n",
+		"docs/a.md":   "a\n",
+		".gitignore":  "build/\n",
+		"build/out.o": "object\n",
+	})
+	s := newTestCheckpointStore(t, dir, "")
+
+	if list, err := s.List(); err != nil || len(list) != 0 {
+		t.Fatalf("List before any checkpoint = %v, %v", list, err)
+	}
+	s.BeginTurn("first  prompt\nwith two lines")
+	s.EnsureCheckpoint()
+	s.EnsureCheckpoint() // only once per turn
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Prompt != "first prompt with two lines" {
+		t.Fatalf("List = %+v, want one checkpoint for the first prompt", list)
+	}
+	first := list[0].ID
+	if got := strings.Join(checkpointFiles(t, s, first), " "); got != ".gitignore docs/a.md main.go" {
+		t.Errorf("checkpoint holds %s, want the ignored build output left out", got)
+	}
+
+	// The assistant edits a file, deletes one and creates another.
+	writeFiles(t, dir, map[string]string{"main.go": "package main // edited\n", "new/file.go": "package x\n"})
+	if err := os.Remove(filepath.Join(dir, "docs/a.md")); err != nil {
+		t.Fatal(err)
+	}
+	s.BeginTurn("second prompt")
+	s.EnsureCheckpoint()
+	if list, _ := s.List(); len(list) != 2 || list[0].Prompt != "second prompt" || list[1].ID != first {
+		t.Fatalf("List = %+v, want the second checkpoint first", list)
+	}
+
+	msg, err := s.Restore(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg, "restored working tree to checkpoint "+first) {
+		t.Errorf("Restore reported %q", msg)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "main.go")); got != "package main\n" {
+		t.Errorf("main.go holds %q after restoring", got)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "docs/a.md")); got != "a\n" {
+		t.Errorf("docs/a.md holds %q after restoring", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new/file.go")); !os.IsNotExist(err) {
+		t.Errorf("a file created after the checkpoint survived the restore: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "build/out.o")); got != "object\n" {
+		t.Errorf("ignored build/out.o holds %q after restoring", got)
+	}
+
+	// The state before the restore was saved and can be restored in turn.
+	list, _ = s.List()
+	if len(list) != 3 || list[0].Prompt != "before /restore "+first {
+		t.Fatalf("List = %+v, want a backup checkpoint first", list)
+	}
+	if _, err := s.Restore(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "new/file.go")); got != "package x\n" {
+		t.Errorf("new/file.go holds %q after undoing the restore", got)
+	}
+
+	if _, err := s.Restore("0123456789ab"); err == nil || !strings.Contains(err.Error(), "unknown checkpoint") {
+		t.Errorf("restoring an unknown checkpoint = %v", err)
+	}
+}
+
+func TestCheckpointSkipsLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"small.txt": "small\n", "video.mp4": "short at first"})
+	s := newTestCheckpointStore(t, dir, "")
+	s.maxFileSize = 100
+
+	id, err := s.snapshot("small files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(checkpointFiles(t, s, id), " "); got != "small.txt video.mp4" {
+		t.Errorf("checkpoint holds %s", got)
+	}
+
+	// Once a file grows over the limit, it is dropped rather than kept at an old version.
+	writeFiles(t, dir, map[string]string{"video.mp4": strings.Repeat("x", 200), "big.bin": strings.Repeat("y", 200)})
+	id, err = s.snapshot("large files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(checkpointFiles(t, s, id), " "); got != "small.txt" {
+		t.Errorf("checkpoint holds %s, want the large files left out", got)
+	}
+	if _, err := s.Restore(id); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "video.mp4")); len(got) != 200 {
+		t.Errorf("restoring removed or changed the large file: %d bytes", len(got))
+	}
+}
+
+func TestCheckpointExcludesItself(t *testing.T) {
+	home := t.TempDir()
+	writeFiles(t, home, map[string]string{"notes.txt": "notes\n"})
+	s := newTestCheckpointStore(t, home, home)
+	if !strings.HasPrefix(s.gitDir, home) {
+		t.Fatalf("store %s is not inside %s", s.gitDir, home)
+	}
+
+	for i := 0; i < 2; i++ {
+		id, err := s.snapshot("from home")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(checkpointFiles(t, s, id), " "); got != "notes.txt" {
+			t.Errorf("checkpoint %d holds %s, want only notes.txt", i+1, got)
+		}
+	}
+}
+
+func TestCheckpointPrune(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestCheckpointStore(t, dir, "")
+	s.maxCheckpoints = 4
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		writeFiles(t, dir, map[string]string{"f.txt": strings.Repeat("v", i+1)})
+		s.BeginTurn("turn " + strings.Repeat("i", i+1))
+		s.EnsureCheckpoint()
+		list, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, list[0].ID)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range list {
+		got = append(got, c.ID)
+	}
+	want := []string{ids[4], ids[3], ids[2]}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("after pruning got %v, want the newest three %v", got, want)
+	}
+	if _, err := s.git("cat-file", "-e", ids[0]); err == nil {
+		t.Error("the oldest checkpoint's commit is still in the store")
+	}
+	if _, err := s.Restore(ids[0]); err == nil {
+		t.Error("restoring a pruned checkpoint succeeded")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// handleSlashCommand runs a REPL command such as /undo. It reports false if input is
+// not a known command, in which case it is sent to the model as usual.
+func handleSlashCommand(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return false
+	}
+	args := fields[1:]
+
+	switch fields[0] {
+	case "/undo":
+		var all, force bool
+		for _, a := range args {
+			all = all || a == "all"
+			force = force || a == "force"
+		}
+		var msg string
+		var err error
+		if all {
+			msg, err = journal.UndoAll(force)
+		} else {
+			msg, err = journal.Undo(force)
+		}
+		if msg != "" {
+			fmt.Println(msg)
+		}
+		if err != nil {
+			fmt.Println("Undo failed:", err)
+		}
+
+	case "/changes":
+		fmt.Println(journal.Summary())
+
+	case "/checkpoints":
+		list, err := checkpoints.List()
+		if err != nil {
+			fmt.Println("Checkpoints unavailable:", err)
+			break
+		}
+		if len(list) == 0 {
+			fmt.Println("No checkpoints yet.")
+			break
+		}
+		for _, c := range list {
+			fmt.Printf("%s  %s  %s\n", c.ID, c.Time.Format("2006-01-02 15:04:05"), c.Prompt)
+		}
+
+	case "/restore":
+		if len(args) != 1 {
+			fmt.Println("Usage: /restore <checkpoint id>")
+			break
+		}
+		msg, err := checkpoints.Restore(args[0])
+		if err != nil {
+			fmt.Println("Restore failed:", err)
+			break
+		}
+		fmt.Println(msg)
+
+	case "/files":
+		runFilesCommand(args)
+
+	case "/batch":
+		runBatchCommand(args)
+
+	default:
+		return false
+	}
+	return true
+}
+
+// runFilesCommand lists uploaded media files, or deletes them with "/files delete <name|all>".
+// "/files prune" drops expired entries from the local upload cache.
+func runFilesCommand(args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if len(args) > 0 && args[0] == "prune" {
+		fmt.Printf("Removed %d expired cache entries.\n", uploads.Prune())
+		return
+	}
+	if len(args) > 0 && args[0] == "delete" {
+		if len(args) != 2 {
+			fmt.Println("Usage: /files delete <name|all>")
+			return
+		}
+		names := []string{args[1]}
+		if args[1] == "all" {
+			files, err := ListRemoteFiles(ctx, genaiApp.client)
+			if err != nil {
+				fmt.Println("Listing uploads failed:", err)
+				return
+			}
+			names = names[:0]
+			for _, f := range files {
+				names = append(names, f.Name)
+			}
+		} else if !strings.HasPrefix(names[0], "files/") {
+			names[0] = "files/" + names[0]
+		}
+		deleted, detached := 0, 0
+		for _, name := range names {
+			if err := deleteRemoteFile(genaiApp.client, name); err == nil {
+				deleted++
+				if genaiApp.cs != nil {
+					detached += forgetHistoryFile(genaiApp.cs.History, name)
+				}
+			}
+		}
+		fmt.Printf("Deleted %d of %d uploads.\n", deleted, len(names))
+		if detached > 0 {
+			fmt.Printf("Removed %d attachment(s) from this session's history; the model can no longer see them.\n", detached)
+		}
+		return
+	}
+	if len(args) > 0 {
+		fmt.Println("Usage: /files [delete <name|all> | prune]")
+		return
+	}
+
+	files, err := ListRemoteFiles(ctx, genaiApp.client)
+	if err != nil {
+		fmt.Println("Listing uploads failed:", err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Println("No uploaded files.")
+		return
+	}
+	for _, f := range files {
+		local := f.LocalPath
+		if local == "" {
+			local = "-"
+		}
+		expires := "never"
+		if !f.ExpiresAt.IsZero() {
+			expires = "in " + time.Until(f.ExpiresAt).Round(time.Minute).String()
+		}
+		fmt.Printf("%s  %-16s %10d bytes  expires %s  %s\n", f.Name, f.MIMEType, f.Size, expires, local)
+	}
+}
+
+// runBatchCommand runs "/batch <glob> <output.csv|output.jsonl> <prompt...>", printing a line as
+// each file completes. Ctrl-C stops the run; running the same command again resumes it.
+func runBatchCommand(args []string) {
+	if len(args) < 3 {
+		fmt.Println("Usage: /batch <glob> <output.csv|output.jsonl> <prompt...>")
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := batchOptions{Patterns: []string{args[0]}, Output: args[1], Prompt: strings.Join(args[2:], " ")}
+	summary, err := RunBatch(ctx, genaiApp.client, opts, func(done, total int, rec batchRecord) {
+		fmt.Printf("[%d/%d] %-5s %s\n", done, total, rec.Status, rec.File)
+	})
+	if err != nil {
+		fmt.Println("Batch failed:", err)
+		return
+	}
+	fmt.Printf("%d succeeded, %d failed, %d already done, %d not media. Results in %s\n",
+		summary.Succeeded, summary.Failed, summary.Skipped, summary.NotMedia, summary.Output)
+	if summary.Cancelled {
+		fmt.Println("Interrupted; run the same command again to resume.")
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// docChunkChars is roughly how much text one document chunk holds.
+	docChunkChars       = 2000
+	defaultDocQueryTopK = 6
+	maxDocQueryTopK     = 20
+)
+
+var (
+	pageMarker    = regexp.MustCompile(`^--- Page (\d+) ---$`)
+	sheetMarker   = regexp.MustCompile(`^--- Sheet: (.*) ---$`)
+	headingLine   = regexp.MustCompile(`^(#{1,6}\s+\S.*|\d+(\.\d+)*\.?\s+\p{Lu}.{0,80})$`)
+	docChunkCache = make(map[string]*docIndex)
+	docChunkMu    sync.Mutex
+)
+
+// docChunk is one section of a page (or of a document without pages).
+type docChunk struct {
+	Page      int // 1-based; 0 for documents without pages
+	StartLine int // line span in the text returned by ReadFile
+	EndLine   int
+	Section   string
+	Text      string
+	Vector    []float32
+}
+
+// docIndex is the embedded chunks of one document version, keyed by content hash.
+type docIndex struct {
+	Hash     string
+	Embedder string
+	Chunks   []docChunk
+}
+
+// docSource is one excerpt an answer was based on.
+type docSource struct {
+	Citation string  `json:"citation"`
+	Section  string  `json:"section,omitempty"`
+	Score    float64 `json:"score"`
+}
+
+// DocQuery answers question from the relevant parts of a long document, citing pages (or line
+// ranges for documents without pages) like "spec.pdf p.12". The document is extracted locally
+// and split by page and section; the chunks and their embeddings are cached by content hash, so
+// later questions about the same file only embed the question. Scanned documents without a text
+// layer are analysed through read_file_content instead.
+func DocQuery(ctx context.Context, client *genai.Client, emb embedder, filePath, question string, topK int) (map[string]interface{}, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, fmt.Errorf("question must not be empty")
+	}
+	if topK <= 0 {
+		topK = defaultDocQueryTopK
+	}
+	topK = min(topK, maxDocQueryTopK)
+
+	fullPath, err := resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := workspace.CheckRead(fullPath); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	if info.Size() > maxReadFileInput {
+		return nil, fmt.Errorf("%s is too large to query (%d bytes, limit %d)", fullPath, info.Size(), maxReadFileInput)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	name := filepath.Base(fullPath)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	idx, cached, err := loadDocIndex(ctx, emb, hash, name, data)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		// Nothing to chunk: let the model read the pages as images.
+		prompt := fmt.Sprintf("Answer this question about the document. After each claim, cite the page it comes from "+
+			"in square brackets, like [%s p.3]. If the document doesn't answer it, say so.\n\nQuestion: %s", name, question)
+		answer, err := ReadFileContentWithAI(ctx, client, []string{fullPath}, prompt)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"answer": answer, "method": "media analysis (no text layer)"}, nil
+	}
+
+	qv, err := emb.EmbedQuery(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+	type scored struct {
+		chunk *docChunk
+		score float64
+	}
+	ranked := make([]scored, len(idx.Chunks))
+	for i := range idx.Chunks {
+		ranked[i] = scored{&idx.Chunks[i], dot(qv, idx.Chunks[i].Vector)}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	// Present the excerpts in document order so they read naturally.
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].chunk.StartLine < ranked[j].chunk.StartLine })
+
+	var excerpts strings.Builder
+	sources := []docSource{}
+	for _, r := range ranked {
+		citation := docCitation(name, r.chunk)
+		fmt.Fprintf(&excerpts, "[%s]", citation)
+		if r.chunk.Section != "" {
+			fmt.Fprintf(&excerpts, " (%s)", r.chunk.Section)
+		}
+		excerpts.WriteString("\n" + r.chunk.Text + "\n\n")
+		sources = append(sources, docSource{Citation: citation, Section: r.chunk.Section, Score: r.score})
+	}
+
+	prompt := fmt.Sprintf("Answer the question using only the excerpts from %s below. After each claim, cite its excerpt "+
+		"in square brackets exactly as labelled, e.g. [%s]. If the excerpts don't contain the answer, say so.\n\n"+
+		"Question: %s\n\nExcerpts:\n\n%s", name, sources[0].Citation, question, excerpts.String())
+	resp, err := client.GenerativeModel(GenaiModel).GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, fmt.Errorf("error generating answer: %v", err)
+	}
+	return map[string]interface{}{
+		"answer":       extractResponse(resp),
+		"sources":      toResponseValue(sources),
+		"chunks":       len(idx.Chunks),
+		"chunksCached": cached,
+	}, nil
+}
+
+// loadDocIndex returns the chunks for the document with the given hash, from memory, from disk
+// or by extracting and embedding it. It returns nil if the document has no usable text layer.
+func loadDocIndex(ctx context.Context, emb embedder, hash, name string, data []byte) (*docIndex, bool, error) {
+	docChunkMu.Lock()
+	defer docChunkMu.Unlock()
+
+	key := hash + "-" + emb.Name()
+	if idx, ok := docChunkCache[key]; ok {
+		return idx, true, nil
+	}
+	cachePath, err := docIndexPath(key)
+	if err == nil {
+		if f, err := os.Open(cachePath); err == nil {
+			var idx docIndex
+			err := gob.NewDecoder(f).Decode(&idx)
+			f.Close()
+			if err == nil && idx.Hash == hash && idx.Embedder == emb.Name() {
+				docChunkCache[key] = &idx
+				return &idx, true, nil
+			}
+		}
+	}
+
+	var text string
+	doc, err := extractDocument(data)
+	switch {
+	case err == nil && doc.Sparse:
+		return nil, false, nil
+	case err == nil:
+		text = doc.Text
+	case err == errNotDocument:
+		if text, _, err = decodeText(data); err != nil {
+			return nil, false, fmt.Errorf("%s is not a document or text file; use read_file_content for media", name)
+		}
+	default:
+		return nil, false, fmt.Errorf("%s: %v", name, err)
+	}
+
+	chunks := chunkDocument(text)
+	if len(chunks) == 0 {
+		return nil, false, fmt.Errorf("%s contains no text", name)
+	}
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = name + " " + c.Section + "\n" + c.Text
+	}
+	vectors, err := emb.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range chunks {
+		chunks[i].Vector = vectors[i]
+	}
+
+	idx := &docIndex{Hash: hash, Embedder: emb.Name(), Chunks: chunks}
+	docChunkCache[key] = idx
+	if cachePath != "" {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(idx); err == nil {
+			err = writeFileAtomic(cachePath, buf.Bytes(), 0600)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to cache document chunks: %v\n", err)
+		}
+	}
+	return idx, false, nil
+}
+
+// docIndexPath returns where the chunks for key are cached, creating the directory.
+func docIndexPath(key string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(homeDir, IndexDir, "docs")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, key+".gob"), nil
+}
+
+// chunkDocument splits extracted text at page and sheet markers and at headings, and splits
+// sections longer than docChunkChars at line boundaries. Each chunk remembers its page and the
+// nearest heading.
+func chunkDocument(text string) []docChunk {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var chunks []docChunk
+	page, section := 0, ""
+	cur := docChunk{StartLine: 1}
+	var body strings.Builder
+
+	flush := func(next int) {
+		if strings.TrimSpace(body.String()) != "" {
+			cur.Text = strings.TrimSpace(body.String())
+			chunks = append(chunks, cur)
+		}
+		body.Reset()
+		cur = docChunk{Page: page, Section: section, StartLine: next}
+	}
+
+	for i, line := range lines {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if m := pageMarker.FindStringSubmatch(trimmed); m != nil {
+			page, _ = strconv.Atoi(m[1])
+			flush(lineNo + 1)
+			continue
+		}
+		if m := sheetMarker.FindStringSubmatch(trimmed); m != nil {
+			section = "Sheet " + m[1]
+			flush(lineNo + 1)
+			continue
+		}
+		if headingLine.MatchString(trimmed) {
+			section = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			flush(lineNo)
+		} else if body.Len()+len(line) > docChunkChars && body.Len() > 0 {
+			flush(lineNo)
+		}
+		body.WriteString(line + "\n")
+		cur.EndLine = lineNo
+	}
+	flush(len(lines) + 1)
+	return chunks
+}
+
+// docCitation formats where a chunk comes from, e.g. "spec.pdf p.12" or "notes.md L10-42".
+func docCitation(name string, c *docChunk) string {
+	if c.Page > 0 {
+		return fmt.Sprintf("%s p.%d", name, c.Page)
+	}
+	return fmt.Sprintf("%s L%d-%d", name, c.StartLine, c.EndLine)
+}
+
+var docQuerySchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"filePath": {
+			Type:        genai.TypeString,
+			Description: "The document to ask about: a PDF, Word, Excel, OpenDocument, Markdown or other text file.",
+		},
+		"question": {
+			Type:        genai.TypeString,
+			Description: "The question to answer from the document.",
+		},
+		"topK": {
+			Type:        genai.TypeInteger,
+			Description: "Number of excerpts to base the answer on (default 6, max 20).",
+		},
+	},
+	Required: []string{"filePath", "question"},
+}
+
+var DocQueryTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "doc_query",
+			Description: "Answers a question about a long document (spec, manual, report) from its most relevant sections, " +
+				"with citations such as 'spec.pdf p.12'. Returns the answer and the excerpts it used. Repeat questions about the same file are fast.",
+			Parameters: docQuerySchema,
+		},
+	},
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChunkDocument(t *testing.T) {
+	long := strings.Repeat(strings.Repeat("x", 100)+"\n", 30)
+
+	tests := []struct {
+		name string
+		text string
+		want []string // "page section start-end first line" for each chunk
+	}{
+		{
+			name: "pages",
+			text: "--- Page 1 ---\nIntro text\n--- Page 2 ---\n\n  --- Page 3 ---\nMore text\n",
+			want: []string{"1 '' 2-2 Intro text", "3 '' 6-6 More text"},
+		},
+		{
+			name: "markdown headings",
+			text: "# Title\nintro\n## Setup\nstep one\n",
+			want: []string{"0 'Title' 1-2 # Title", "0 'Setup' 3-4 ## Setup"},
+		},
+		{
+			name: "numbered headings within a page",
+			text: "--- Page 4 ---\npreamble\n1.2 Scope of Work\nThe contractor shall\n",
+			want: []string{"4 '' 2-2 preamble", "4 '1.2 Scope of Work' 3-4 1.2 Scope of Work"},
+		},
+		{
+			name: "sheets",
+			text: "--- Sheet: Q1 ---\na,b\n--- Sheet: Q2 ---\nc,d\n",
+			want: []string{"0 'Sheet Q1' 2-2 a,b", "0 'Sheet Q2' 4-4 c,d"},
+		},
+		{
+			name: "long section split at a line",
+			text: "# Notes\n" + long,
+			want: []string{"0 'Notes' 1-20 # Notes", "0 'Notes' 21-31 " + strings.Repeat("x", 100)},
+		},
+		{name: "blank", text: "\n \n\n", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range chunkDocument(tt.text) {
+				first, _, _ := strings.Cut(c.Text, "\n")
+				got = append(got, fmt.Sprintf("%d '%s' %d-%d %s", c.Page, c.Section, c.StartLine, c.EndLine, first))
+				if len(c.Text) > docChunkChars {
+					t.Errorf("chunk at line %d has %d bytes, limit %d", c.StartLine, len(c.Text), docChunkChars)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDocCitation(t *testing.T) {
+	tests := []struct {
+		chunk docChunk
+		want  string
+	}{
+		{docChunk{Page: 12, StartLine: 300, EndLine: 340}, "spec.pdf p.12"},
+		{docChunk{StartLine: 10, EndLine: 42}, "spec.pdf L10-42"},
+		{docChunk{StartLine: 7, EndLine: 7}, "spec.pdf L7-7"},
+	}
+	for _, tt := range tests {
+		if got := docCitation("spec.pdf", &tt.chunk); got != tt.want {
+			t.Errorf("docCitation(%+v) = %q, want %q", tt.chunk, got, tt.want)
+		}
+	}
+}
+
+func TestDocQueryRefusesLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "huge.pdf")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A sparse file: large on paper without using the disk space.
+	if err := f.Truncate(maxReadFileInput + 1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	_, err = DocQuery(context.Background(), nil, &hashEmbedder{dims: localEmbeddingDims}, path, "what is this?", 0)
+	if err == nil || !strings.Contains(err.Error(), "too large to query") {
+		t.Errorf("got error %v, want a size error", err)
+	}
+}
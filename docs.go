@@ -0,0 +1,489 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxDocumentPart bounds how much of one file inside a DOCX, XLSX or ODT archive is read.
+	maxDocumentPart = 64 * 1024 * 1024
+	// sparsePageChars is the average number of characters per page below which a PDF is
+	// treated as scanned or image-only.
+	sparsePageChars = 40
+)
+
+// errNotDocument is returned by extractDocument for files it doesn't know how to read.
+var errNotDocument = errors.New("not a supported document format")
+
+// extractedDocument is the text of a document, extracted locally.
+type extractedDocument struct {
+	Text   string
+	Format string // "PDF", "DOCX", "XLSX" or "ODF"
+	Pages  int    // PDFs only
+	Sparse bool   // little text was found, as in scanned or image-only PDFs
+}
+
+// looksLikeDocument reports whether data starts like a PDF or a zip-based office document.
+func looksLikeDocument(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-")) || bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// extractDocument extracts the text of a PDF, Word (DOCX), Excel (XLSX) or OpenDocument file.
+// The format is detected from the contents. PDF pages are separated by "--- Page N ---" lines
+// and spreadsheet sheets by "--- Sheet: name ---" lines, with rows written as CSV.
+func extractDocument(data []byte) (*extractedDocument, error) {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		pages, err := extractPDF(data)
+		if err != nil {
+			return nil, err
+		}
+		var out strings.Builder
+		chars := 0
+		for i, page := range pages {
+			fmt.Fprintf(&out, "--- Page %d ---\n", i+1)
+			if page != "" {
+				out.WriteString(page)
+				out.WriteByte('\n')
+			}
+			chars += utf8.RuneCountInString(strings.Join(strings.Fields(page), ""))
+		}
+		return &extractedDocument{Text: out.String(), Format: "PDF", Pages: len(pages), Sparse: chars < sparsePageChars*len(pages)}, nil
+	}
+	if !looksLikeDocument(data) {
+		return nil, errNotDocument
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errNotDocument
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var text string
+	var format string
+	switch {
+	case files["word/document.xml"] != nil:
+		format = "DOCX"
+		text, err = extractDOCX(files)
+	case files["xl/workbook.xml"] != nil:
+		format = "XLSX"
+		text, err = extractXLSX(files)
+	case files["content.xml"] != nil && files["mimetype"] != nil:
+		format = "ODF"
+		text, err = extractODF(files)
+	default:
+		return nil, errNotDocument
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", format, err)
+	}
+	return &extractedDocument{Text: text, Format: format}, nil
+}
+
+// readZipPart returns the contents of a file in the archive, or nil if it is missing.
+func readZipPart(files map[string]*zip.File, name string) ([]byte, error) {
+	f := files[name]
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxDocumentPart))
+}
+
+// xmlAttr returns the value of the attribute with the given local name.
+func xmlAttr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// extractDOCX returns the paragraphs of a Word document, one per line. Headings are marked with
+// '#' and table cells are separated by " | ".
+func extractDOCX(files map[string]*zip.File) (string, error) {
+	data, err := readZipPart(files, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	var out, para strings.Builder
+	heading := 0
+	inCell, cells := 0, 0
+	inText := false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				heading = 0
+			case "pStyle":
+				if level, ok := strings.CutPrefix(xmlAttr(t, "val"), "Heading"); ok {
+					heading, _ = strconv.Atoi(level)
+				}
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tr":
+				cells = 0
+			case "tc":
+				if cells > 0 {
+					out.WriteString("| ")
+				}
+				inCell++
+				cells++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if heading > 0 {
+					out.WriteString(strings.Repeat("#", heading) + " ")
+				}
+				out.WriteString(para.String())
+				if inCell > 0 {
+					out.WriteByte(' ')
+				} else {
+					out.WriteByte('\n')
+				}
+			case "tc":
+				inCell--
+			case "tr":
+				out.WriteByte('\n')
+			case "tbl":
+				out.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// extractODF returns the text of an OpenDocument text, spreadsheet or presentation file.
+func extractODF(files map[string]*zip.File) (string, error) {
+	data, err := readZipPart(files, "content.xml")
+	if err != nil {
+		return "", err
+	}
+	mimeType, err := readZipPart(files, "mimetype")
+	if err != nil {
+		return "", err
+	}
+	spreadsheet := bytes.Contains(mimeType, []byte("spreadsheet"))
+
+	var out strings.Builder
+	inCell, cells, inPara := 0, 0, 0
+	skip := 0 // depth inside elements whose text isn't document content
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "annotation", "tracked-changes":
+				skip++
+			case "p":
+				inPara++
+			case "h":
+				inPara++
+				if level, err := strconv.Atoi(xmlAttr(t, "outline-level")); err == nil && level > 0 {
+					out.WriteString(strings.Repeat("#", level) + " ")
+				}
+			case "s":
+				n, err := strconv.Atoi(xmlAttr(t, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				out.WriteString(strings.Repeat(" ", n))
+			case "tab":
+				out.WriteByte('\t')
+			case "line-break":
+				out.WriteByte('\n')
+			case "table":
+				if name := xmlAttr(t, "name"); spreadsheet && name != "" {
+					fmt.Fprintf(&out, "--- Sheet: %s ---\n", name)
+				}
+			case "table-row":
+				cells = 0
+			case "table-cell":
+				if cells > 0 {
+					out.WriteString("| ")
+				}
+				inCell++
+				cells++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "annotation", "tracked-changes":
+				skip--
+			case "p", "h":
+				inPara--
+				if skip > 0 {
+					break
+				}
+				if inCell > 0 {
+					out.WriteByte(' ')
+				} else {
+					out.WriteByte('\n')
+				}
+			case "table-cell":
+				inCell--
+			case "table-row":
+				out.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inPara > 0 && skip == 0 {
+				out.Write(t)
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// extractXLSX returns every sheet of an Excel workbook as CSV rows. Formulas are shown by their
+// cached values; dates appear as Excel serial numbers.
+func extractXLSX(files map[string]*zip.File) (string, error) {
+	shared, err := xlsxSharedStrings(files)
+	if err != nil {
+		return "", err
+	}
+	sheets, err := xlsxSheets(files)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, sheet := range sheets {
+		data, err := readZipPart(files, sheet.path)
+		if err != nil {
+			return "", err
+		}
+		if data == nil {
+			continue
+		}
+		rows, err := xlsxRows(data, shared)
+		if err != nil {
+			return "", fmt.Errorf("sheet %s: %v", sheet.name, err)
+		}
+		fmt.Fprintf(&out, "--- Sheet: %s ---\n", sheet.name)
+		w := csv.NewWriter(&out)
+		w.WriteAll(rows)
+	}
+	return out.String(), nil
+}
+
+type xlsxSheet struct {
+	name string
+	path string // inside the archive
+}
+
+// xlsxSheets lists the workbook's sheets in order with their worksheet files.
+func xlsxSheets(files map[string]*zip.File) ([]xlsxSheet, error) {
+	rels := make(map[string]string)
+	if data, err := readZipPart(files, "xl/_rels/workbook.xml.rels"); err != nil {
+		return nil, err
+	} else if data != nil {
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			if e, ok := tok.(xml.StartElement); ok && e.Name.Local == "Relationship" {
+				target := xmlAttr(e, "Target")
+				if strings.HasPrefix(target, "/") {
+					target = strings.TrimPrefix(target, "/")
+				} else {
+					target = path.Join("xl", target)
+				}
+				rels[xmlAttr(e, "Id")] = target
+			}
+		}
+	}
+
+	data, err := readZipPart(files, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	var sheets []xlsxSheet
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := tok.(xml.StartElement); ok && e.Name.Local == "sheet" {
+			s := xlsxSheet{name: xmlAttr(e, "name"), path: rels[xmlAttr(e, "id")]}
+			if s.path == "" {
+				s.path = fmt.Sprintf("xl/worksheets/sheet%d.xml", len(sheets)+1)
+			}
+			sheets = append(sheets, s)
+		}
+	}
+	return sheets, nil
+}
+
+// xlsxSharedStrings returns the workbook's shared string table.
+func xlsxSharedStrings(files map[string]*zip.File) ([]string, error) {
+	data, err := readZipPart(files, "xl/sharedStrings.xml")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var strs []string
+	var cur strings.Builder
+	inText, inPhonetic := false, false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, cur.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				cur.Write(t)
+			}
+		}
+	}
+	return strs, nil
+}
+
+// xlsxRows reads the cell values of a worksheet, placing each value in the column given by its
+// cell reference so that empty cells keep their place.
+func xlsxRows(data []byte, shared []string) ([][]string, error) {
+	var rows [][]string
+	var row []string
+	var cellType, cellRef string
+	var value strings.Builder
+	inValue := false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				cellType, cellRef = xmlAttr(t, "t"), xmlAttr(t, "r")
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				v := value.String()
+				if cellType == "s" {
+					if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(shared) {
+						v = shared[i]
+					}
+				} else if cellType == "b" {
+					v = map[string]string{"0": "FALSE", "1": "TRUE"}[v]
+				}
+				col := xlsxColumn(cellRef)
+				if col < 0 {
+					col = len(row)
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = v
+			case "row":
+				rows = append(rows, row)
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as "C12", or -1.
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 || col > 16384 {
+		return -1
+	}
+	return col - 1
+}
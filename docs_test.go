@@ -0,0 +1,181 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTestZip returns a zip archive holding files, written in the given order.
+func buildTestZip(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const testDOCX = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Release notes</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Fixed the </w:t></w:r><w:r><w:t>upload retry.</w:t></w:r></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Status</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>Parser</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Done</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+<w:p><w:r><w:t>Line one</w:t><w:br/><w:t>Line two</w:t></w:r></w:p>
+</w:body>
+</w:document>`
+
+const testXLSXWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+ xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Budget" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const testXLSXRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+const testXLSXSheet = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>1250</v></c></row>
+<row r="3"><c r="A3" t="inlineStr"><is><t>Total, net</t></is></c><c r="B3" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`
+
+const testXLSXStrings = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Item</t></si><si><t>Note</t></si><si><r><t>Ser</t></r><r><t>vers</t></r></si>
+</sst>`
+
+const testODT = `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>
+<text:h text:outline-level="2">Minutes</text:h>
+<text:p>Agreed to<text:s text:c="2"/>ship on Friday.<office:annotation><text:p>private note</text:p></office:annotation></text:p>
+</office:text></office:body></office:document-content>`
+
+func TestExtractDocument(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   []string
+		absent []string
+	}{
+		{
+			name:   "docx",
+			data:   buildTestZip(t, [2]string{"[Content_Types].xml", "<Types/>"}, [2]string{"word/document.xml", testDOCX}),
+			format: "DOCX",
+			want:   []string{"# Release notes\n", "Fixed the upload retry.\n", "Name | Status \n", "Parser | Done \n", "Line one\nLine two\n"},
+		},
+		{
+			name: "xlsx",
+			data: buildTestZip(t,
+				[2]string{"xl/workbook.xml", testXLSXWorkbook},
+				[2]string{"xl/_rels/workbook.xml.rels", testXLSXRels},
+				[2]string{"xl/sharedStrings.xml", testXLSXStrings},
+				[2]string{"xl/worksheets/sheet1.xml", testXLSXSheet}),
+			format: "XLSX",
+			want:   []string{"--- Sheet: Budget ---\n", "Item,Note\n", "Servers,,1250\n", "\"Total, net\",TRUE\n"},
+		},
+		{
+			name:   "odt",
+			data:   buildTestZip(t, [2]string{"mimetype", "application/vnd.oasis.opendocument.text"}, [2]string{"content.xml", testODT}),
+			format: "ODF",
+			want:   []string{"## Minutes\n", "Agreed to  ship on Friday."},
+			absent: []string{"private note"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := extractDocument(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Format != tt.format {
+				t.Errorf("format = %s, want %s", doc.Format, tt.format)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(doc.Text, w) {
+					t.Errorf("text does not contain %q:\n%s", w, doc.Text)
+				}
+			}
+			for _, a := range tt.absent {
+				if strings.Contains(doc.Text, a) {
+					t.Errorf("text contains %q:\n%s", a, doc.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractDocumentNotDocument(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"text":      []byte("just some text\n"),
+		"plain zip": buildTestZip(t, [2]string{"readme.txt", "hello"}),
+		"png":       []byte("\x89PNG\r\n\x1a\n"),
+	} {
+		if _, err := extractDocument(data); err != errNotDocument {
+			t.Errorf("%s: got error %v, want errNotDocument", name, err)
+		}
+	}
+}
+
+func TestReadFileDocuments(t *testing.T) {
+	dir := t.TempDir()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		note string
+	}{
+		{
+			name: "report.pdf",
+			data: buildTestPDF([]string{"BT /F1 12 Tf 72 720 Td (Quarterly report for the northern region) Tj ET"}, false),
+			want: "Quarterly report for the northern region",
+			note: "text extracted from PDF, 1 pages",
+		},
+		{
+			name: "notes.docx",
+			data: buildTestZip(t, [2]string{"word/document.xml", testDOCX}),
+			want: "Fixed the upload retry.",
+			note: "text extracted from DOCX",
+		},
+		{
+			name: "latin1.txt",
+			data: []byte("caf\xe9 au lait\n"),
+			want: "café au lait",
+			note: "decoded from latin-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := ReadFile(path, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want) || !strings.Contains(out, tt.note) {
+				t.Errorf("ReadFile(%s) lacks %q or %q:\n%s", tt.name, tt.want, tt.note, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// textEdit replaces exactly one occurrence of OldText with NewText.
+type textEdit struct {
+	OldText string
+	NewText string
+}
+
+// EditFile applies either a list of search-and-replace edits or a unified diff to an existing file.
+// The content is stored exactly as given; nothing is unescaped.
+func EditFile(fileName string, edits []textEdit, diff string) (string, error) {
+	if len(edits) == 0 && strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("either 'edits' or 'diff' must be provided")
+	}
+	if len(edits) > 0 && strings.TrimSpace(diff) != "" {
+		return "", fmt.Errorf("provide 'edits' or 'diff', not both")
+	}
+
+	fullPath, err := resolvePath(fileName)
+	if err != nil {
+		return "", err
+	}
+	if err := workspace.CheckWrite(fullPath); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %v", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("'%s' is a directory", fullPath)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	var updated string
+	var summary string
+	if len(edits) > 0 {
+		updated, err = applyEdits(string(data), edits)
+		summary = fmt.Sprintf("applied %d edit(s) to %s", len(edits), fullPath)
+	} else {
+		var hunks int
+		updated, hunks, err = applyUnifiedDiff(string(data), diff)
+		summary = fmt.Sprintf("applied %d hunk(s) to %s", hunks, fullPath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := recordedWrite(fullPath, []byte(updated), info.Mode().Perm(), "file_edit"); err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// applyEdits applies each edit in order. Every OldText must occur exactly once in the
+// content as it stands when that edit is applied.
+func applyEdits(content string, edits []textEdit) (string, error) {
+	for i, e := range edits {
+		if e.OldText == "" {
+			return "", fmt.Errorf("edit %d: oldText must not be empty", i+1)
+		}
+		switch n := strings.Count(content, e.OldText); n {
+		case 0:
+			return "", fmt.Errorf("edit %d: oldText not found in file", i+1)
+		case 1:
+			content = strings.Replace(content, e.OldText, e.NewText, 1)
+		default:
+			return "", fmt.Errorf("edit %d: oldText appears %d times; include more surrounding text so it is unique", i+1, n)
+		}
+	}
+	return content, nil
+}
+
+// diffHunk is one "@@ -a,b +c,d @@" section of a unified diff.
+type diffHunk struct {
+	oldStart int
+	oldCount int
+	newCount int
+	oldLines []string
+	newLines []string
+}
+
+// applyUnifiedDiff applies the hunks of a unified diff to content. Each hunk is tried at
+// the line it names first and, failing that, at the nearest position where its context matches.
+// A file with CRLF line endings keeps them even if the diff uses LF.
+func applyUnifiedDiff(content, diff string) (string, int, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", 0, err
+	}
+
+	trailingNewline := strings.HasSuffix(content, "\n")
+	crlf := strings.Contains(content, "\r\n") && strings.Count(content, "\r\n") == strings.Count(content, "\n")
+	if crlf {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		for i := range hunks {
+			for j, l := range hunks[i].newLines {
+				hunks[i].newLines[j] = strings.TrimSuffix(l, "\r")
+			}
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	offset := 0
+	minPos := 0
+	for i, h := range hunks {
+		want := h.oldStart - 1 + offset
+		switch {
+		case len(h.oldLines) == 0:
+			// A hunk without context or removed lines ("@@ -5,0 +6,2 @@") inserts after line oldStart.
+			want = h.oldStart + offset
+		case h.oldStart == 0:
+			want = 0
+		}
+		pos := findHunk(lines, h.oldLines, want, minPos)
+		if pos < 0 {
+			return "", 0, fmt.Errorf("hunk %d (@@ -%d) does not apply: its context or removed lines were not found", i+1, h.oldStart)
+		}
+
+		patched := make([]string, 0, len(lines)-len(h.oldLines)+len(h.newLines))
+		patched = append(patched, lines[:pos]...)
+		patched = append(patched, h.newLines...)
+		patched = append(patched, lines[pos+len(h.oldLines):]...)
+		lines = patched
+
+		offset += len(h.newLines) - len(h.oldLines)
+		minPos = pos + len(h.newLines)
+	}
+
+	eol := "\n"
+	if crlf {
+		eol = "\r\n"
+	}
+	result := strings.Join(lines, eol)
+	if trailingNewline && len(lines) > 0 {
+		result += eol
+	}
+	return result, len(hunks), nil
+}
+
+// findHunk returns the position of old in lines nearest to want, not before minPos, or -1.
+func findHunk(lines, old []string, want, minPos int) int {
+	matches := func(pos int) bool {
+		if pos < minPos || pos+len(old) > len(lines) {
+			return false
+		}
+		for j, l := range old {
+			if strings.TrimSuffix(lines[pos+j], "\r") != strings.TrimSuffix(l, "\r") {
+				return false
+			}
+		}
+		return true
+	}
+	for delta := 0; delta <= len(lines); delta++ {
+		if matches(want - delta) {
+			return want - delta
+		}
+		if matches(want + delta) {
+			return want + delta
+		}
+	}
+	return -1
+}
+
+// parseUnifiedDiff splits diff into hunks. Each hunk's body must have as many old and new
+// lines as its header declares.
+func parseUnifiedDiff(diff string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	var cur *diffHunk
+	full := func() bool {
+		return cur != nil && len(cur.oldLines) >= cur.oldCount && len(cur.newLines) >= cur.newCount
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			if err := checkHunk(cur, len(hunks)); err != nil {
+				return nil, err
+			}
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunks = append(hunks, h)
+			cur = &hunks[len(hunks)-1]
+		case cur == nil:
+			// File headers ("---", "+++", "diff --git", "index") before the first hunk.
+			continue
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+			continue
+		case full() && (line == "" || strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "index ") ||
+			strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ")):
+			// Trailing blank lines or the headers of another file after a complete hunk.
+			continue
+		case strings.HasPrefix(line, "+"):
+			cur.newLines = append(cur.newLines, line[1:])
+		case strings.HasPrefix(line, "-"):
+			cur.oldLines = append(cur.oldLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			cur.oldLines = append(cur.oldLines, line[1:])
+			cur.newLines = append(cur.newLines, line[1:])
+		case line == "":
+			// Some tools strip the leading space from blank context lines.
+			cur.oldLines = append(cur.oldLines, "")
+			cur.newLines = append(cur.newLines, "")
+		default:
+			return nil, fmt.Errorf("malformed diff line: %q", line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("diff contains no hunks (expected lines starting with '@@')")
+	}
+	if err := checkHunk(cur, len(hunks)); err != nil {
+		return nil, err
+	}
+	return hunks, nil
+}
+
+// checkHunk reports an error if hunk n's body doesn't match the line counts in its header.
+func checkHunk(h *diffHunk, n int) error {
+	if h == nil || len(h.oldLines) == h.oldCount && len(h.newLines) == h.newCount {
+		return nil
+	}
+	return fmt.Errorf("hunk %d: header declares %d old and %d new lines, but the body has %d and %d",
+		n, h.oldCount, h.newCount, len(h.oldLines), len(h.newLines))
+}
+
+// parseHunkHeader parses "@@ -12,7 +12,8 @@". An omitted count means one line.
+func parseHunkHeader(line string) (diffHunk, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return diffHunk{}, fmt.Errorf("malformed hunk header: %q", line)
+	}
+	oldStart, oldCount, err1 := parseHunkRange(fields[1][1:])
+	_, newCount, err2 := parseHunkRange(fields[2][1:])
+	if err1 != nil || err2 != nil {
+		return diffHunk{}, fmt.Errorf("malformed hunk header: %q", line)
+	}
+	return diffHunk{oldStart: oldStart, oldCount: oldCount, newCount: newCount}, nil
+}
+
+// parseHunkRange parses the "12,7" or "12" part of a hunk header.
+func parseHunkRange(s string) (int, int, error) {
+	start, count, hasCount := strings.Cut(s, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("bad range %q", s)
+	}
+	if !hasCount {
+		return n, 1, nil
+	}
+	c, err := strconv.Atoi(count)
+	if err != nil || c < 0 {
+		return 0, 0, fmt.Errorf("bad range %q", s)
+	}
+	return n, c, nil
+}
+
+// parseEditsArg converts the "edits" function call argument into textEdits.
+func parseEditsArg(arg any) ([]textEdit, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	list, ok := arg.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list at key 'edits'")
+	}
+	edits := make([]textEdit, 0, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("edit %d: expected an object with 'oldText' and 'newText'", i+1)
+		}
+		oldText, ok := m["oldText"].(string)
+		if !ok {
+			return nil, fmt.Errorf("edit %d: expected string at key 'oldText'", i+1)
+		}
+		newText, _ := m["newText"].(string)
+		edits = append(edits, textEdit{OldText: oldText, NewText: newText})
+	}
+	return edits, nil
+}
+
+var fileEditSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"fileName": {
+			Type:        genai.TypeString,
+			Description: "The name or path of an existing file to edit. Relative paths are resolved against the current working directory.",
+		},
+		"edits": {
+			Type: genai.TypeArray,
+			Description: "Search-and-replace edits applied in order. Each oldText must match the file exactly " +
+				"(including whitespace) and occur exactly once.",
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"oldText": {
+						Type:        genai.TypeString,
+						Description: "The exact text to replace.",
+					},
+					"newText": {
+						Type:        genai.TypeString,
+						Description: "The replacement text. May be empty to delete oldText.",
+					},
+				},
+				Required: []string{"oldText", "newText"},
+			},
+		},
+		"diff": {
+			Type:        genai.TypeString,
+			Description: "A unified diff to apply instead of 'edits'. Only the @@ hunks are used.",
+		},
+	},
+	Required: []string{"fileName"},
+}
+
+var FileEditTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "file_edit",
+			Description: "Edits part of an existing file using exact search-and-replace edits or a unified diff, " +
+				"without rewriting the whole file. Fails if an anchor is missing or ambiguous.",
+			Parameters: fileEditSchema,
+		},
+	},
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	const content = "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 1\n}\n"
+	tests := []struct {
+		name  string
+		edits []textEdit
+		want  string
+		err   string
+	}{
+		{
+			name:  "single edit",
+			edits: []textEdit{{"func a() {\n\treturn 1", "func a() {\n\treturn 2"}},
+			want:  "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 1\n}\n",
+		},
+		{
+			name:  "edits apply in order",
+			edits: []textEdit{{"func a()", "func first()"}, {"first() {\n\treturn 1", "first() {\n\treturn 0"}},
+			want:  "func first() {\n\treturn 0\n}\n\nfunc b() {\n\treturn 1\n}\n",
+		},
+		{
+			name:  "delete",
+			edits: []textEdit{{"\nfunc b() {\n\treturn 1\n}\n", ""}},
+			want:  "func a() {\n\treturn 1\n}\n",
+		},
+		{
+			name:  "backslashes are kept",
+			edits: []textEdit{{"return 1\n}\n\n", `return "a\nb"` + "\n}\n\n"}},
+			want:  "func a() {\n\treturn \"a\\nb\"\n}\n\nfunc b() {\n\treturn 1\n}\n",
+		},
+		{name: "anchor not found", edits: []textEdit{{"func c()", "x"}}, err: "edit 1: oldText not found"},
+		{name: "anchor found twice", edits: []textEdit{{"return 1", "return 2"}}, err: "edit 1: oldText appears 2 times"},
+		{name: "empty anchor", edits: []textEdit{{"func a", "func x"}, {"", "x"}}, err: "edit 2: oldText must not be empty"},
+		{name: "later edit fails", edits: []textEdit{{"func a", "func x"}, {"func a", "func y"}}, err: "edit 2: oldText not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyEdits(content, tt.edits)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	const ten = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		want    string
+		hunks   int
+		err     string
+	}{
+		{
+			name:    "replace with context",
+			content: ten,
+			diff:    "--- a/f\n+++ b/f\n@@ -2,3 +2,3 @@\n 2\n-3\n+three\n 4\n",
+			want:    "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n",
+			hunks:   1,
+		},
+		{
+			name:    "two hunks, the second shifted by the first",
+			content: ten,
+			diff:    "@@ -1,2 +1,3 @@\n 1\n+1.5\n 2\n@@ -8,3 +9,2 @@\n 8\n-9\n 10\n",
+			want:    "1\n1.5\n2\n3\n4\n5\n6\n7\n8\n10\n",
+			hunks:   2,
+		},
+		{
+			name:    "hunk at the wrong line is found nearby",
+			content: ten,
+			diff:    "@@ -2,2 +2,2 @@\n 6\n-7\n+seven\n",
+			want:    "1\n2\n3\n4\n5\n6\nseven\n8\n9\n10\n",
+			hunks:   1,
+		},
+		{
+			name:    "insertion without context goes after the named line",
+			content: ten,
+			diff:    "@@ -5,0 +6,2 @@\n+5a\n+5b\n",
+			want:    "1\n2\n3\n4\n5\n5a\n5b\n6\n7\n8\n9\n10\n",
+			hunks:   1,
+		},
+		{
+			name:    "insertions without context in several hunks",
+			content: ten,
+			diff:    "@@ -0,0 +1 @@\n+0\n@@ -10,0 +12 @@\n+11\n",
+			want:    "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			hunks:   2,
+		},
+		{
+			name:    "deletion without context",
+			content: ten,
+			diff:    "@@ -3,2 +2,0 @@\n-3\n-4\n",
+			want:    "1\n2\n5\n6\n7\n8\n9\n10\n",
+			hunks:   1,
+		},
+		{
+			name:    "into an empty file",
+			content: "",
+			diff:    "--- /dev/null\n+++ b/f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want:    "a\nb",
+			hunks:   1,
+		},
+		{
+			name:    "no newline at end of file",
+			content: "a\nb",
+			diff:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			want:    "a\nc",
+			hunks:   1,
+		},
+		{
+			name:    "blank context line without its leading space",
+			content: "a\n\nb\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			want:    "a\n\nc\n",
+			hunks:   1,
+		},
+		{
+			name:    "crlf file with an lf diff",
+			content: "a\r\nb\r\nc\r\n",
+			diff:    "@@ -1,3 +1,4 @@\n a\n-b\n+B\n+B2\n c\n",
+			want:    "a\r\nB\r\nB2\r\nc\r\n",
+			hunks:   1,
+		},
+		{
+			name:    "crlf diff",
+			content: "a\r\nb\r\n",
+			diff:    "@@ -1,2 +1,2 @@\r\n a\r\n-b\r\n+c\r\n",
+			want:    "a\r\nc\r\n",
+			hunks:   1,
+		},
+		{
+			name:    "trailing blank lines after the last hunk",
+			content: ten,
+			diff:    "@@ -10 +10 @@\n-10\n+ten\n\n\n",
+			want:    "1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			hunks:   1,
+		},
+		{name: "context not found", content: ten, diff: "@@ -2,2 +2,2 @@\n 2\n-4\n+four\n", err: "hunk 1 (@@ -2) does not apply"},
+		{name: "hunks out of order", content: ten, diff: "@@ -8 +8 @@\n-8\n+eight\n@@ -2 +2 @@\n-2\n+two\n", err: "hunk 2 (@@ -2) does not apply"},
+		{name: "body longer than the header", content: ten, diff: "@@ -2,1 +2,1 @@\n-2\n+two\n 3\n", err: "hunk 1: header declares 1 old and 1 new lines, but the body has 2 and 2"},
+		{name: "body shorter than the header", content: ten, diff: "@@ -2,3 +2,3 @@\n 2\n-3\n+three\n", err: "hunk 1: header declares 3 old and 3 new lines, but the body has 2 and 2"},
+		{name: "earlier hunk shorter than its header", content: ten, diff: "@@ -2,2 +2,2 @@\n-2\n+two\n@@ -8 +8 @@\n-8\n+eight\n", err: "hunk 1: header declares 2 old"},
+		{name: "malformed header", content: ten, diff: "@@ -x +1 @@\n+a\n", err: "malformed hunk header"},
+		{name: "no hunks", content: ten, diff: "--- a/f\n+++ b/f\n", err: "diff contains no hunks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hunks, err := applyUnifiedDiff(tt.content, tt.diff)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || hunks != tt.hunks {
+				t.Errorf("got %q (%d hunks), want %q (%d hunks)", got, hunks, tt.want, tt.hunks)
+			}
+		})
+	}
+}
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		header                       string
+		oldStart, oldCount, newCount int
+		err                          bool
+	}{
+		{"@@ -12,7 +12,8 @@", 12, 7, 8, false},
+		{"@@ -12,7 +12,8 @@ func main() {", 12, 7, 8, false},
+		{"@@ -3 +3 @@", 3, 1, 1, false},
+		{"@@ -5,0 +6,2 @@", 5, 0, 2, false},
+		{"@@ -1,2 @@", 0, 0, 0, true},
+		{"@@ 1,2 +1,2 @@", 0, 0, 0, true},
+		{"@@ -1,x +1,2 @@", 0, 0, 0, true},
+		{"@@ -1,2 +1,-2 @@", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		h, err := parseHunkHeader(tt.header)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseHunkHeader(%q) succeeded", tt.header)
+			}
+			continue
+		}
+		if err != nil || h.oldStart != tt.oldStart || h.oldCount != tt.oldCount || h.newCount != tt.newCount {
+			t.Errorf("parseHunkHeader(%q) = %+v, %v; want -%d,%d +%d", tt.header, h, err, tt.oldStart, tt.oldCount, tt.newCount)
+		}
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	path := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EditFile(path, []textEdit{{"b", "c"}}, "@@ -1 +1 @@\n-a\n+x\n"); err == nil {
+		t.Error("edits and diff together were accepted")
+	}
+	if _, err := EditFile(path, []textEdit{{"missing", "c"}}, ""); err == nil {
+		t.Error("a missing anchor was accepted")
+	}
+	if _, err := EditFile(path, []textEdit{{"b", "c"}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "a\nc\n" || info.Mode().Perm() != 0600 {
+		t.Errorf("got %q with mode %v, want \"a\\nc\\n\" with mode 0600", data, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"golang.org/x/net/html/charset"
+)
+
+// FetchAllowEnv restricts fetch_url to a comma-separated list of domains; each also allows its
+// subdomains, so "go.dev" allows "pkg.go.dev". When it is unset any public host may be fetched,
+// but not loopback, link-local or private addresses.
+const FetchAllowEnv = "MYAPP_FETCH_ALLOW"
+
+const (
+	defaultFetchTimeout = 20 * time.Second
+	maxFetchBytes       = 5 * 1024 * 1024
+	maxFetchRedirects   = 5
+	defaultFetchChars   = 40000
+	maxFetchChars       = 200000
+)
+
+// fetcher downloads pages for fetch_url. Its fields are set by newFetcher; a test can point
+// client at an httptest server and allow its host, or replace resolve.
+type fetcher struct {
+	client       *http.Client
+	allow        []string
+	timeout      time.Duration
+	maxBytes     int64
+	maxRedirects int
+	proxies      map[string]bool // proxy addresses, which may be private
+	resolve      func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// fetchResult is a downloaded page converted to text.
+type fetchResult struct {
+	URL         string `json:"url"` // after redirects
+	Title       string `json:"title,omitempty"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	TotalChars  int    `json:"totalChars"`
+}
+
+// newFetcher returns a fetcher with the default limits and the allowlist from FetchAllowEnv.
+func newFetcher() *fetcher {
+	var allow []string
+	for _, d := range strings.Split(os.Getenv(FetchAllowEnv), ",") {
+		if d = strings.ToLower(strings.Trim(strings.TrimSpace(d), ".")); d != "" {
+			allow = append(allow, d)
+		}
+	}
+	f := &fetcher{
+		allow:        allow,
+		timeout:      defaultFetchTimeout,
+		maxBytes:     maxFetchBytes,
+		maxRedirects: maxFetchRedirects,
+		proxies:      make(map[string]bool),
+		resolve:      net.DefaultResolver.LookupIPAddr,
+	}
+	for _, scheme := range []string{"http", "https"} {
+		proxy, _ := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: scheme, Host: "example.com"}})
+		if proxy == nil {
+			continue
+		}
+		port := proxy.Port()
+		if port == "" {
+			port = "80"
+			if proxy.Scheme == "https" {
+				port = "443"
+			}
+		}
+		f.proxies[net.JoinHostPort(proxy.Hostname(), port)] = true
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = f.dial
+	f.client = &http.Client{Transport: transport}
+	return f
+}
+
+// dial connects to addr. Without an allowlist it resolves the host itself and refuses private
+// addresses, so a public name that resolves to an internal address can't be used to reach it.
+func (f *fetcher) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if len(f.allow) > 0 || f.proxies[addr] {
+		return d.DialContext(ctx, network, addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := f.publicAddrs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// Connect to the addresses just checked rather than resolving the name again.
+	err = fmt.Errorf("no addresses found for %s", host)
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// publicAddrs resolves host and fails if any of its addresses is private.
+func (f *fetcher) publicAddrs(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, err := f.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if privateIP(ip.IP) {
+			return nil, fmt.Errorf("%s resolves to the private address %s; add it to %s to fetch it", host, ip.IP, FetchAllowEnv)
+		}
+	}
+	return ips, nil
+}
+
+// checkProxied applies the private-address check to u's host when the request goes through a
+// proxy. dial then only sees the proxy's address and the proxy resolves the name itself, so the
+// name is resolved here instead. The proxy could still get a different answer, but a name that
+// plainly points inside the network is refused.
+func (f *fetcher) checkProxied(ctx context.Context, u *url.URL) error {
+	if len(f.allow) > 0 {
+		return nil
+	}
+	transport, ok := f.client.Transport.(*http.Transport)
+	if !ok || transport.Proxy == nil {
+		return nil
+	}
+	if proxy, err := transport.Proxy(&http.Request{URL: u}); err != nil || proxy == nil {
+		return nil
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return nil // checked by allowed
+	}
+	_, err := f.publicAddrs(ctx, u.Hostname())
+	return err
+}
+
+// privateIP reports whether ip is a loopback, link-local, private or unspecified address,
+// including IPv4 addresses mapped into IPv6.
+func privateIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() ||
+		ip.Equal(net.IPv4bcast) || (len(ip) == net.IPv4len && ip[0] == 100 && ip[1]&0xC0 == 64) // carrier-grade NAT
+}
+
+// allowed reports whether u may be fetched: it must be http or https and, if there is an
+// allowlist, its host must be on it. Without an allowlist, local and private addresses are
+// refused; names that resolve to them are refused when connecting, or by checkProxied when
+// a proxy connects instead.
+func (f *fetcher) allowed(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme '%s': only http and https can be fetched", u.Scheme)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if len(f.allow) == 0 {
+		ip := net.ParseIP(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && privateIP(ip)) {
+			return fmt.Errorf("%s is a local or private address; add it to %s to fetch it", host, FetchAllowEnv)
+		}
+		return nil
+	}
+	for _, d := range f.allow {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not in %s (%s)", host, FetchAllowEnv, strings.Join(f.allow, ", "))
+}
+
+// Fetch downloads rawURL and returns its content as text: HTML is converted to markdown without
+// scripts, styles and navigation, PDFs and office documents are extracted, and other text is
+// returned as is. At most maxChars characters are returned. Redirects are followed up to the
+// fetcher's limit and each target is checked against the allowlist.
+func (f *fetcher) Fetch(ctx context.Context, rawURL string, maxChars int) (*fetchResult, error) {
+	if maxChars <= 0 {
+		maxChars = defaultFetchChars
+	}
+	maxChars = min(maxChars, maxFetchChars)
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if err := f.allowed(u); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	if err := f.checkProxied(ctx, u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	req.Header.Set("User-Agent", "Go_CLI fetch_url")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/*;q=0.9,*/*;q=0.5")
+
+	client := *f.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > f.maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", f.maxRedirects)
+		}
+		if err := f.allowed(req.URL); err != nil {
+			return err
+		}
+		return f.checkProxied(req.Context(), req.URL)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("fetching %s timed out after %s", u.Host, f.timeout)
+		}
+		return nil, fmt.Errorf("failed to fetch %s: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching %s failed: HTTP %s", resp.Request.URL, resp.Status)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%s is too large (%d bytes, limit %d)", resp.Request.URL, resp.ContentLength, f.maxBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("fetching %s timed out after %s", u.Host, f.timeout)
+		}
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	bodyTruncated := int64(len(data)) > f.maxBytes
+	if bodyTruncated {
+		data = data[:f.maxBytes]
+	}
+	if mediaType == "" {
+		mediaType = strings.SplitN(http.DetectContentType(data), ";", 2)[0]
+	}
+
+	result := &fetchResult{URL: resp.Request.URL.String(), ContentType: mediaType}
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text, err := decodeCharset(data, contentType)
+		if err != nil {
+			return nil, err
+		}
+		result.Title, result.Content = htmlToMarkdown(text, resp.Request.URL)
+	case strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml"):
+		if result.Content, err = decodeCharset(data, contentType); err != nil {
+			return nil, err
+		}
+	default:
+		if bodyTruncated {
+			return nil, fmt.Errorf("%s is larger than %d bytes", result.URL, f.maxBytes)
+		}
+		doc, err := extractDocument(data)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert %s content to text; download it with run_command and use read_file_content for media", mediaType)
+		}
+		result.Content = doc.Text
+	}
+
+	result.TotalChars = len(result.Content)
+	if len(result.Content) > maxChars {
+		cut := strings.LastIndex(result.Content[:maxChars], "\n")
+		if cut < maxChars/2 {
+			cut = maxChars
+		}
+		result.Content = strings.ToValidUTF8(result.Content[:cut], "")
+		result.Truncated = true
+	}
+	if bodyTruncated {
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// decodeCharset converts a response body to UTF-8 using the charset from the Content-Type
+// header or, for HTML, the page's meta tag.
+func decodeCharset(data []byte, contentType string) (string, error) {
+	r, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "�"), nil
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+	return string(text), nil
+}
+
+var fetchURLSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"url": {
+			Type:        genai.TypeString,
+			Description: "The http or https URL to fetch, e.g. 'https://pkg.go.dev/net/http'.",
+		},
+		"maxChars": {
+			Type:        genai.TypeInteger,
+			Description: "Maximum characters of content to return (default 40000, max 200000).",
+		},
+	},
+	Required: []string{"url"},
+}
+
+var FetchURLTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "fetch_url",
+			Description: "Downloads a web page and returns it as readable markdown, without scripts, styles or navigation. " +
+				"Also returns plain text, JSON and the text of PDF and office documents. Use this to read documentation instead of curl.",
+			Parameters: fetchURLSchema,
+		},
+	},
+}
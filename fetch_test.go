@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>Widgets  guide</title><style>body { color: red }</style></head>
+<body>
+<nav><a href="/">Home</a> | <a href="/about">About us</a></nav>
+<main>
+<h1>Installing widgets</h1>
+<p>Run the <code>widget</code> installer, then read the <a href="/docs/setup">setup notes</a>.</p>
+<ul><li>Fast</li><li>Small</li></ul>
+<pre><code class="language-go">fmt.Println("hi")</code></pre>
+<table><tr><th>Name</th><th>Size</th></tr><tr><td>Gear</td><td>3</td></tr></table>
+<script>trackVisitor()</script>
+</main>
+<footer>Copyright notice</footer>
+</body></html>`
+
+// newTestFetchServer serves the pages used by the fetch tests.
+func newTestFetchServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, testPage)
+	})
+	mux.HandleFunc("/latin1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=iso-8859-1")
+		w.Write([]byte("caf\xe9 cr\xe8me\n"))
+	})
+	// /redirect/N redirects N times before serving a page.
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if n == 0 {
+			fmt.Fprint(w, "arrived")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		http.Redirect(w, r, "http://localhost:"+port+"/page", http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "5000")
+		w.Write([]byte(strings.Repeat("x", 5000)))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length: the size is only known while reading.
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		for i := 0; i < 50; i++ {
+			fmt.Fprintln(w, strings.Repeat("line of text ", 8))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestFetcher returns a fetcher that may reach the test server.
+func newTestFetcher(t *testing.T) *fetcher {
+	t.Helper()
+	t.Setenv(FetchAllowEnv, "127.0.0.1")
+	return newFetcher()
+}
+
+func TestFetchHTML(t *testing.T) {
+	srv := newTestFetchServer(t)
+	res, err := newTestFetcher(t).Fetch(context.Background(), srv.URL+"/page", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Title != "Widgets guide" || res.ContentType != "text/html" {
+		t.Errorf("title %q, content type %q", res.Title, res.ContentType)
+	}
+	for _, want := range []string{
+		"# Installing widgets",
+		"Run the `widget` installer, then read the [setup notes](" + srv.URL + "/docs/setup).",
+		"- Fast\n- Small",
+		"```go\nfmt.Println(\"hi\")\n```",
+		"| Name | Size |",
+		"| Gear | 3 |",
+	} {
+		if !strings.Contains(res.Content, want) {
+			t.Errorf("content lacks %q:\n%s", want, res.Content)
+		}
+	}
+	for _, unwanted := range []string{"About us", "trackVisitor", "color: red", "Copyright"} {
+		if strings.Contains(res.Content, unwanted) {
+			t.Errorf("content contains %q:\n%s", unwanted, res.Content)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := newTestFetchServer(t)
+	tests := []struct {
+		name      string
+		path      string
+		setup     func(f *fetcher)
+		maxChars  int
+		want      string // in the content
+		truncated bool
+		err       string // in the error
+	}{
+		{name: "charset", path: "/latin1", want: "café crème"},
+		{name: "redirects within the limit", path: "/redirect/3", setup: func(f *fetcher) { f.maxRedirects = 3 }, want: "arrived"},
+		{name: "too many redirects", path: "/redirect/4", setup: func(f *fetcher) { f.maxRedirects = 3 }, err: "stopped after 3 redirects"},
+		{name: "redirect off the allowlist", path: "/elsewhere", err: "localhost is not in " + FetchAllowEnv},
+		{name: "declared size over the cap", path: "/large", setup: func(f *fetcher) { f.maxBytes = 1024 }, err: "too large (5000 bytes, limit 1024)"},
+		{name: "streamed text over the cap", path: "/stream?type=text/plain", setup: func(f *fetcher) { f.maxBytes = 1024 }, want: "line of text", truncated: true},
+		{name: "streamed binary over the cap", path: "/stream?type=application/octet-stream", setup: func(f *fetcher) { f.maxBytes = 1024 }, err: "larger than 1024 bytes"},
+		{name: "maxChars", path: "/stream?type=text/plain", maxChars: 300, want: "line of text", truncated: true},
+		{name: "timeout", path: "/slow", setup: func(f *fetcher) { f.timeout = 100 * time.Millisecond }, err: "timed out after 100ms"},
+		{name: "not found", path: "/missing", err: "HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFetcher(t)
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+			res, err := f.Fetch(context.Background(), srv.URL+tt.path, tt.maxChars)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(res.Content, tt.want) || res.Truncated != tt.truncated {
+				t.Errorf("got truncated %v, content:\n%s\nwant %q, truncated %v", res.Truncated, res.Content, tt.want, tt.truncated)
+			}
+			if tt.maxChars > 0 && len(res.Content) > tt.maxChars {
+				t.Errorf("got %d characters, want at most %d", len(res.Content), tt.maxChars)
+			}
+		})
+	}
+}
+
+func TestFetchPrivateAddresses(t *testing.T) {
+	srv := newTestFetchServer(t)
+	t.Setenv(FetchAllowEnv, "")
+	f := newFetcher()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	for _, rawURL := range []string{
+		srv.URL + "/page",
+		"http://localhost:" + port + "/page",
+		"http://[::1]:" + port + "/page",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/",
+		"ftp://example.com/file",
+	} {
+		if _, err := f.Fetch(context.Background(), rawURL, 0); err == nil {
+			t.Errorf("fetching %s succeeded without an allowlist", rawURL)
+		}
+	}
+
+	// Redirect targets go through the same check.
+	u, _ := url.Parse(srv.URL + "/page")
+	if err := f.allowed(u); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Errorf("allowed(%s) = %v, want a private address error", u, err)
+	}
+
+	// Names are checked again once resolved.
+	if _, err := f.dial(context.Background(), "tcp", "localhost:"+port); err == nil || !strings.Contains(err.Error(), "private address") {
+		t.Errorf("dialing localhost: got %v, want a private address error", err)
+	}
+}
+
+func TestFetchThroughProxy(t *testing.T) {
+	var requested []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		if r.URL.Path == "/bounce" {
+			http.Redirect(w, r, "http://intranet.example/admin", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "via proxy")
+	}))
+	t.Cleanup(proxy.Close)
+
+	t.Setenv(FetchAllowEnv, "")
+	f := newFetcher()
+	proxyURL, _ := url.Parse(proxy.URL)
+	f.client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+	f.proxies[proxyURL.Host] = true
+	f.resolve = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "public.example":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+		case "intranet.example":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.35")}, {IP: net.ParseIP("10.0.0.5")}}, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+		err  string
+	}{
+		{url: "http://public.example/page", want: "via proxy"},
+		{url: "http://intranet.example/admin", err: "resolves to the private address 10.0.0.5"},
+		{url: "http://public.example/bounce", err: "resolves to the private address 10.0.0.5"},
+		{url: "http://10.0.0.5/", err: "local or private address"},
+		{url: "http://unknown.example/", err: "no such host"},
+	}
+	for _, tt := range tests {
+		res, err := f.Fetch(context.Background(), tt.url, 0)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.url, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+		} else if res.Content != tt.want {
+			t.Errorf("%s: content %q, want %q", tt.url, res.Content, tt.want)
+		}
+	}
+	for _, r := range requested {
+		if strings.Contains(r, "intranet") || strings.Contains(r, "10.0.0.5") {
+			t.Errorf("the proxy was asked for %s", r)
+		}
+	}
+	if len(requested) != 2 {
+		t.Errorf("proxy requests = %q, want the page and the bounce", requested)
+	}
+}
+
+func TestPrivateIP(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":        true,
+		"::1":              true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"fe80::1":          true,
+		"fd00::1":          true,
+		"0.0.0.0":          true,
+		"100.64.0.1":       true,
+		"::ffff:127.0.0.1": true,
+		"8.8.8.8":          false,
+		"172.32.0.1":       false,
+		"100.128.0.1":      false,
+		"2606:4700::1111":  false,
+	}
+	for ip, want := range tests {
+		if got := privateIP(net.ParseIP(ip)); got != want {
+			t.Errorf("privateIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	defaultFindLimit = 200
+	// maxFindCandidates bounds how many matches are collected before sorting.
+	maxFindCandidates = 20000
+)
+
+// foundFile is one match returned by find_files.
+type foundFile struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"` // "file" or "dir"
+	Size     int64  `json:"size,omitempty"`
+	Modified string `json:"modified"`
+
+	modTime time.Time
+}
+
+// findResult is the structured result of FindFiles.
+type findResult struct {
+	Files     []foundFile `json:"files"`
+	Total     int         `json:"total"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// FindFiles returns the paths under directory matching any of patterns, using .gitignore glob
+// syntax ("*_test.go" matches at any depth, "cmd/**/main.go" is relative to directory).
+// Results are sorted by path, or newest first when sortBy is "modified".
+func FindFiles(directory string, patterns []string, sortBy string, limit int, includeDirs bool) (*findResult, error) {
+	globs, err := compileGlobs(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(globs) == 0 {
+		return nil, fmt.Errorf("at least one glob pattern is required")
+	}
+	if sortBy == "" {
+		sortBy = "path"
+	}
+	if sortBy != "path" && sortBy != "modified" {
+		return nil, fmt.Errorf("invalid sortBy '%s': expected 'path' or 'modified'", sortBy)
+	}
+	if limit <= 0 {
+		limit = defaultFindLimit
+	}
+
+	if directory == "" {
+		directory = "."
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	if err := workspace.CheckRead(root); err != nil {
+		return nil, err
+	}
+	access := workspaceFor(root)
+
+	result := &findResult{Files: []foundFile{}}
+	var matches []foundFile
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Warning: Error accessing path %s: %v\n", path, err)
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if d.Name() == ".git" || access.Access(path, d.IsDir()) == accessHidden {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && !includeDirs {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if !matchesAnyGlob(globs, rel) {
+			return nil
+		}
+		if len(matches) >= maxFindCandidates {
+			result.Truncated = true
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		f := foundFile{Path: rel, Type: "file", modTime: info.ModTime()}
+		if d.IsDir() {
+			f.Type = "dir"
+		} else {
+			f.Size = info.Size()
+		}
+		f.Modified = f.modTime.Format(time.RFC3339)
+		matches = append(matches, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if sortBy == "modified" {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].modTime.After(matches[j].modTime) })
+	} else {
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	}
+
+	result.Total = len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+		result.Truncated = true
+	}
+	result.Files = append(result.Files, matches...)
+	return result, nil
+}
+
+var findFilesSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"patterns": {
+			Type:  genai.TypeArray,
+			Items: &genai.Schema{Type: genai.TypeString},
+			Description: "Glob patterns to match (e.g. '*_test.go', 'app.py', 'src/**/*.ts'). " +
+				"Patterns without a slash match file names at any depth.",
+		},
+		"directory": {
+			Type:        genai.TypeString,
+			Description: "Directory to search. Defaults to the current working directory.",
+		},
+		"sortBy": {
+			Type:        genai.TypeString,
+			Enum:        []string{"path", "modified"},
+			Description: "Sort by path (default) or by modification time, newest first.",
+		},
+		"limit": {
+			Type:        genai.TypeInteger,
+			Description: "Maximum number of results to return (default 200).",
+		},
+		"includeDirs": {
+			Type:        genai.TypeBoolean,
+			Description: "Also return directories whose path matches.",
+		},
+	},
+	Required: []string{"patterns"},
+}
+
+var FindFilesTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "find_files",
+			Description: "Finds files by glob pattern in a directory tree and returns their paths, sizes and " +
+				"modification times. Respects .fileignore/.gitignore.",
+			Parameters: findFilesSchema,
+		},
+	},
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileGlobs(t *testing.T) {
+	tests := []struct {
+		glob    string
+		match   []string
+		noMatch []string
+	}{
+		{"*_test.go", []string{"a_test.go", "pkg/sub/b_test.go"}, []string{"a_test.go.bak", "test.go"}},
+		{"app.py", []string{"app.py", "src/app.py"}, []string{"myapp.py"}},
+		{"src/**/*.ts", []string{"src/a.ts", "src/x/a.ts", "src/x/y/a.ts"}, []string{"lib/src/a.ts", "src/a.tsx", "srca.ts"}},
+		{"**/testdata/*", []string{"testdata/a", "x/y/testdata/b"}, []string{"testdata/a/b", "mytestdata/a"}},
+		{"docs/**", []string{"docs/a.md", "docs/x/y.png"}, []string{"docs", "x/docs/a.md"}},
+		{"/main.go", []string{"main.go"}, []string{"cmd/main.go"}},
+		{"cmd/*/main.go", []string{"cmd/tool/main.go"}, []string{"cmd/main.go", "cmd/a/b/main.go"}},
+		{"**.go", []string{"a.go", "x/b.go"}, []string{"a.gox"}},
+		{"file?.txt", []string{"file1.txt"}, []string{"file10.txt", "file/.txt"}},
+		{"[ab]*.md", []string{"a.md", "big.md"}, []string{"c.md"}},
+		{`name\*`, []string{"name*", "dir/name*"}, []string{"names"}},
+	}
+	for _, tt := range tests {
+		globs, err := compileGlobs([]string{tt.glob})
+		if err != nil || len(globs) != 1 {
+			t.Errorf("compileGlobs(%q) = %v, %v", tt.glob, globs, err)
+			continue
+		}
+		for _, p := range tt.match {
+			if !matchesAnyGlob(globs, p) {
+				t.Errorf("%q does not match %q", tt.glob, p)
+			}
+		}
+		for _, p := range tt.noMatch {
+			if matchesAnyGlob(globs, p) {
+				t.Errorf("%q matches %q", tt.glob, p)
+			}
+		}
+	}
+	if globs, err := compileGlobs([]string{"", "  "}); err != nil || len(globs) != 0 {
+		t.Errorf("blank globs compiled to %v, %v", globs, err)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":            "dist/\n",
+		"main.go":               "package main\n",
+		"main_test.go":          "package main\n",
+		"cmd/tool/main.go":      "package main\n",
+		"cmd/tool/main_test.go": "package main\n",
+		"src/app.ts":            "export {}\n",
+		"src/lib/util.ts":       "export {}\n",
+		"dist/app.js":           "ignored\n",
+		".git/config":           "[core]\n",
+	})
+	// Give every file a distinct modification time, oldest first in this order.
+	for i, name := range []string{"src/lib/util.ts", "main.go", "cmd/tool/main.go", "src/app.ts", "main_test.go", "cmd/tool/main_test.go"} {
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	tests := []struct {
+		name        string
+		patterns    []string
+		sortBy      string
+		limit       int
+		includeDirs bool
+		want        string
+		truncated   bool
+		err         string
+	}{
+		{name: "name at any depth", patterns: []string{"*_test.go"}, want: "cmd/tool/main_test.go main_test.go"},
+		{name: "double star", patterns: []string{"src/**/*.ts"}, want: "src/app.ts src/lib/util.ts"},
+		{name: "several patterns", patterns: []string{"main.go", "*.ts"}, want: "cmd/tool/main.go main.go src/app.ts src/lib/util.ts"},
+		{name: "newest first", patterns: []string{"*.go"}, sortBy: "modified", want: "cmd/tool/main_test.go main_test.go cmd/tool/main.go main.go"},
+		{name: "limit", patterns: []string{"*.go"}, limit: 2, want: "cmd/tool/main.go cmd/tool/main_test.go", truncated: true},
+		{name: "directories", patterns: []string{"tool", "lib"}, includeDirs: true, want: "cmd/tool src/lib"},
+		{name: "directories left out", patterns: []string{"tool"}, want: ""},
+		{name: "ignored and .git paths", patterns: []string{"*.js", "config"}, want: ""},
+		{name: "no patterns", patterns: []string{" "}, err: "at least one glob pattern"},
+		{name: "bad sort", patterns: []string{"*"}, sortBy: "size", err: "invalid sortBy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := FindFiles(dir, tt.patterns, tt.sortBy, tt.limit, tt.includeDirs)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range res.Files {
+				got = append(got, f.Path)
+				if f.Type == "file" && f.Size == 0 || f.Modified == "" {
+					t.Errorf("%s: size %d, modified %q", f.Path, f.Size, f.Modified)
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("got  %s\nwant %s", strings.Join(got, " "), tt.want)
+			}
+			if res.Truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", res.Truncated, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// gitFileStatus is one entry of `git status`.
+type gitFileStatus struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"origPath,omitempty"`
+	Index    string `json:"index"`
+	WorkTree string `json:"workTree"`
+}
+
+// gitCommit is one entry of `git log`.
+type gitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+// gitDiffFile summarises the changes to one file in a diff.
+type gitDiffFile struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// gitBlameLine is one line of `git blame`.
+type gitBlameLine struct {
+	Line    int    `json:"line"`
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Content string `json:"content"`
+}
+
+// maxGitOutput caps diff and file output returned to the model.
+const maxGitOutput = 100 * 1024
+
+// runGit runs git in repo without a shell and returns stdout.
+func runGit(repo string, args ...string) (string, error) {
+	if repo == "" {
+		repo = "."
+	}
+	cmd := exec.Command("git", append([]string{"-C", repo, "--no-pager"}, args...)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
+
+// checkGitArg rejects values that git would parse as options.
+func checkGitArg(name, value string) error {
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("invalid %s '%s': must not start with '-'", name, value)
+	}
+	return nil
+}
+
+// gitPath resolves a path argument against repo, as git -C does, so it can be checked against
+// the workspace's ignore rules.
+func gitPath(repo, p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p), nil
+	}
+	if repo == "" {
+		repo = "."
+	}
+	base, err := resolvePath(repo)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, p), nil
+}
+
+// gitRoot returns the top directory of the repository containing repo.
+func gitRoot(repo string) (string, error) {
+	out, err := runGit(repo, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// checkGitPaths rejects paths that ignore rules hide from the model, or that may not be
+// changed when write is set, so git can't be used to get around them.
+func checkGitPaths(repo string, paths []string, write bool) error {
+	for _, p := range paths {
+		if err := checkGitArg("path", p); err != nil {
+			return err
+		}
+		full, err := gitPath(repo, p)
+		if err != nil {
+			return err
+		}
+		if write {
+			err = workspace.CheckWrite(full)
+		} else {
+			err = workspace.CheckRead(full)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GitStatus returns the changed files in the repository.
+func GitStatus(repo string) (map[string]interface{}, error) {
+	out, err := runGit(repo, "status", "--porcelain=v1", "-z", "--branch")
+	if err != nil {
+		return nil, err
+	}
+	return parseGitStatus(out), nil
+}
+
+// parseGitStatus parses the output of `git status --porcelain=v1 -z --branch`.
+func parseGitStatus(out string) map[string]interface{} {
+	result := map[string]interface{}{}
+	files := []gitFileStatus{}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 3 {
+			continue
+		}
+		if strings.HasPrefix(e, "## ") {
+			result["branch"] = e[3:]
+			continue
+		}
+		st := gitFileStatus{Index: string(e[0]), WorkTree: string(e[1]), Path: e[3:]}
+		if e[0] == 'R' || e[0] == 'C' {
+			// Renames are followed by the original path as a separate entry.
+			if i+1 < len(entries) {
+				st.OrigPath = entries[i+1]
+				i++
+			}
+		}
+		files = append(files, st)
+	}
+	result["files"] = files
+	result["clean"] = len(files) == 0
+	return result
+}
+
+// GitDiff returns a per-file summary and the patch text. With no refs it diffs the working
+// tree against the index, or the index against HEAD when staged is set.
+func GitDiff(repo string, staged bool, from, to string, paths []string) (map[string]interface{}, error) {
+	if to != "" && from == "" {
+		return nil, fmt.Errorf("'to' requires 'from': pass the older ref as 'from'")
+	}
+	if err := checkGitPaths(repo, paths, false); err != nil {
+		return nil, err
+	}
+	args := []string{"diff"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	for _, ref := range []string{from, to} {
+		if ref == "" {
+			continue
+		}
+		if err := checkGitArg("ref", ref); err != nil {
+			return nil, err
+		}
+		args = append(args, ref)
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+
+	stat, err := runGit(repo, append([]string{args[0], "--numstat"}, args[1:]...)...)
+	if err != nil {
+		return nil, err
+	}
+	root, err := gitRoot(repo)
+	if err != nil {
+		return nil, err
+	}
+	files := []gitDiffFile{}
+	var visible []string
+	hidden := 0
+	for _, line := range strings.Split(strings.TrimSpace(stat), "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		// Diff paths are relative to the top of the repository.
+		if workspace.CheckRead(filepath.Join(root, filepath.FromSlash(parts[2]))) != nil {
+			hidden++
+			continue
+		}
+		visible = append(visible, ":(top)"+parts[2])
+		f := gitDiffFile{Path: parts[2]}
+		if parts[0] == "-" {
+			f.Binary = true
+		} else {
+			f.Added, _ = strconv.Atoi(parts[0])
+			f.Removed, _ = strconv.Atoi(parts[1])
+		}
+		files = append(files, f)
+	}
+
+	patch := ""
+	if hidden > 0 {
+		// Only show the patches of files the model may read.
+		args = append(args[:len(args)-len(paths)], visible...)
+	}
+	if hidden == 0 || len(visible) > 0 {
+		if patch, err = runGit(repo, args...); err != nil {
+			return nil, err
+		}
+	}
+	result := map[string]interface{}{"files": files}
+	if hidden > 0 {
+		result["hiddenFiles"] = hidden
+	}
+	patch, truncated := truncateGitOutput(patch)
+	if truncated {
+		result["truncated"] = true
+	}
+	result["patch"] = patch
+	return result, nil
+}
+
+// GitLog returns commits newest first, filtered by the given options.
+func GitLog(repo string, maxCount int, ref, author, since, until, grep, path string) ([]gitCommit, error) {
+	if maxCount <= 0 || maxCount > 200 {
+		maxCount = 20
+	}
+	args := []string{"log", "-n", strconv.Itoa(maxCount), "--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e"}
+	if author != "" {
+		args = append(args, "--author="+author)
+	}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	if until != "" {
+		args = append(args, "--until="+until)
+	}
+	if grep != "" {
+		args = append(args, "--grep="+grep)
+	}
+	if ref != "" {
+		if err := checkGitArg("ref", ref); err != nil {
+			return nil, err
+		}
+		args = append(args, ref)
+	}
+	args = append(args, "--")
+	if path != "" {
+		if err := checkGitPaths(repo, []string{path}, false); err != nil {
+			return nil, err
+		}
+		args = append(args, path)
+	}
+
+	out, err := runGit(repo, args...)
+	if err != nil {
+		return nil, err
+	}
+	commits := []gitCommit{}
+	for _, rec := range strings.Split(out, "\x1e") {
+		f := strings.Split(strings.TrimSpace(rec), "\x1f")
+		if len(f) != 5 {
+			continue
+		}
+		commits = append(commits, gitCommit{Hash: f[0], Author: f[1], Email: f[2], Date: f[3], Subject: f[4]})
+	}
+	return commits, nil
+}
+
+// GitBlame returns authorship for lines startLine..endLine of file (0 means the whole file).
+func GitBlame(repo, file string, startLine, endLine int, rev string) ([]gitBlameLine, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if startLine > 0 {
+		if endLine < startLine {
+			endLine = startLine
+		}
+		args = append(args, "-L", fmt.Sprintf("%d,%d", startLine, endLine))
+	}
+	if rev != "" {
+		if err := checkGitArg("rev", rev); err != nil {
+			return nil, err
+		}
+		args = append(args, rev)
+	}
+	if err := checkGitPaths(repo, []string{file}, false); err != nil {
+		return nil, err
+	}
+	args = append(args, "--", file)
+
+	out, err := runGit(repo, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(out)
+}
+
+// parseBlame parses `git blame --line-porcelain` output. Every line starts with a header
+// naming its commit, whose hash is 40 hex digits, or 64 in a SHA-256 repository.
+func parseBlame(out string) ([]gitBlameLine, error) {
+	lines := []gitBlameLine{}
+	var cur gitBlameLine
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			cur.Content = text[1:]
+			lines = append(lines, cur)
+			cur = gitBlameLine{}
+		case strings.HasPrefix(text, "author "):
+			cur.Author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-time "):
+			secs, _ := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64)
+			cur.Date = time.Unix(secs, 0).UTC().Format(time.RFC3339)
+		default:
+			fields := strings.Fields(text)
+			if cur.Commit == "" && len(fields) >= 3 && isCommitHash(fields[0]) {
+				cur.Commit = fields[0]
+				cur.Line, _ = strconv.Atoi(fields[2])
+			}
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// isCommitHash reports whether s is a full SHA-1 or SHA-256 object name.
+func isCommitHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// truncateGitOutput cuts s to maxGitOutput bytes without splitting a UTF-8 sequence.
+func truncateGitOutput(s string) (string, bool) {
+	if len(s) <= maxGitOutput {
+		return s, false
+	}
+	cut := maxGitOutput
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// GitShowFile returns the contents of file as of rev.
+func GitShowFile(repo, file, rev string) (string, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := checkGitArg("rev", rev); err != nil {
+		return "", err
+	}
+	// In rev:path the path is relative to the top of the repository.
+	root, err := gitRoot(repo)
+	if err != nil {
+		return "", err
+	}
+	if err := checkGitPaths(root, []string{file}, false); err != nil {
+		return "", err
+	}
+	out, err := runGit(repo, "show", rev+":"+file)
+	if err != nil {
+		return "", err
+	}
+	if out, truncated := truncateGitOutput(out); truncated {
+		return out + "\n[output truncated]", nil
+	}
+	return out, nil
+}
+
+// GitAdd stages the given paths.
+func GitAdd(repo string, paths []string) (string, error) {
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no paths to stage")
+	}
+	if err := checkGitPaths(repo, paths, true); err != nil {
+		return "", err
+	}
+	// A directory may contain files the model can't change; check what would be staged.
+	dry, err := runGit(repo, append([]string{"add", "--dry-run", "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(dry), "\n") {
+		p := strings.TrimSuffix(strings.TrimPrefix(line, "add '"), "'")
+		if p == line || p == "" {
+			continue
+		}
+		if err := checkGitPaths(repo, []string{p}, true); err != nil {
+			return "", fmt.Errorf("not staging anything: %v", err)
+		}
+	}
+	if _, err := runGit(repo, append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("staged %d path(s)", len(paths)), nil
+}
+
+// GitCommit commits the staged changes with message.
+func GitCommit(repo, message string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("commit message must not be empty")
+	}
+	out, err := runGit(repo, "commit", "-m", message)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// runGitTool dispatches a git_* function call.
+func runGitTool(name string, args map[string]interface{}) (interface{}, error) {
+	repo, _ := args["repo"].(string)
+	file, _ := args["file"].(string)
+	switch name {
+	case "git_status":
+		return GitStatus(repo)
+	case "git_diff":
+		staged, _ := args["staged"].(bool)
+		from, _ := args["from"].(string)
+		to, _ := args["to"].(string)
+		return GitDiff(repo, staged, from, to, stringListArg(args["paths"]))
+	case "git_log":
+		maxCount, _ := intArg(args, "maxCount")
+		ref, _ := args["ref"].(string)
+		author, _ := args["author"].(string)
+		since, _ := args["since"].(string)
+		until, _ := args["until"].(string)
+		grep, _ := args["grep"].(string)
+		return GitLog(repo, maxCount, ref, author, since, until, grep, file)
+	case "git_blame":
+		if file == "" {
+			return nil, fmt.Errorf("expected non-empty string at key 'file'")
+		}
+		startLine, _ := intArg(args, "startLine")
+		endLine, _ := intArg(args, "endLine")
+		rev, _ := args["rev"].(string)
+		return GitBlame(repo, file, startLine, endLine, rev)
+	case "git_show_file":
+		if file == "" {
+			return nil, fmt.Errorf("expected non-empty string at key 'file'")
+		}
+		rev, _ := args["rev"].(string)
+		return GitShowFile(repo, file, rev)
+	case "git_add":
+		return GitAdd(repo, stringListArg(args["paths"]))
+	case "git_commit":
+		message, _ := args["message"].(string)
+		return GitCommit(repo, message)
+	}
+	return nil, fmt.Errorf("unknown git tool '%s'", name)
+}
+
+// stringListArg converts a list function call argument into strings, skipping non-strings.
+func stringListArg(arg interface{}) []string {
+	list, _ := arg.([]interface{})
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+var gitRepoProperty = &genai.Schema{
+	Type:        genai.TypeString,
+	Description: "Optional path to the repository. Defaults to the current working directory.",
+}
+
+// GitReadTool holds the read-only git tools.
+var GitReadTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name:        "git_status",
+			Description: "Returns the current branch and the list of changed, staged and untracked files.",
+			Parameters: &genai.Schema{
+				Type:       genai.TypeObject,
+				Properties: map[string]*genai.Schema{"repo": gitRepoProperty},
+			},
+		},
+		{
+			Name: "git_diff",
+			Description: "Returns a per-file summary and patch. By default shows unstaged changes; " +
+				"set staged to see staged changes, or pass from/to refs to compare revisions.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo":   gitRepoProperty,
+					"staged": {Type: genai.TypeBoolean, Description: "Show staged changes (index against HEAD)."},
+					"from":   {Type: genai.TypeString, Description: "Optional ref to diff from (e.g. 'main', 'HEAD~3')."},
+					"to":     {Type: genai.TypeString, Description: "Optional ref to diff to. Requires 'from'."},
+					"paths": {
+						Type:        genai.TypeArray,
+						Items:       &genai.Schema{Type: genai.TypeString},
+						Description: "Optional list of paths to limit the diff to.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "git_log",
+			Description: "Returns commits (hash, author, date, subject) newest first, with optional filters.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo":     gitRepoProperty,
+					"maxCount": {Type: genai.TypeInteger, Description: "Maximum number of commits (default 20, max 200)."},
+					"ref":      {Type: genai.TypeString, Description: "Optional branch or revision range (e.g. 'main..feature')."},
+					"author":   {Type: genai.TypeString, Description: "Only commits by this author (substring match)."},
+					"since":    {Type: genai.TypeString, Description: "Only commits after this date (e.g. '2 weeks ago', '2024-01-01')."},
+					"until":    {Type: genai.TypeString, Description: "Only commits before this date."},
+					"grep":     {Type: genai.TypeString, Description: "Only commits whose message matches this pattern."},
+					"file":     {Type: genai.TypeString, Description: "Only commits touching this path."},
+				},
+			},
+		},
+		{
+			Name:        "git_blame",
+			Description: "Returns the commit, author and date for each line in a range of a file.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo":      gitRepoProperty,
+					"file":      {Type: genai.TypeString, Description: "Path of the file to blame."},
+					"startLine": {Type: genai.TypeInteger, Description: "First line (1-based). Omit to blame the whole file."},
+					"endLine":   {Type: genai.TypeInteger, Description: "Last line (inclusive)."},
+					"rev":       {Type: genai.TypeString, Description: "Optional revision to blame at."},
+				},
+				Required: []string{"file"},
+			},
+		},
+		{
+			Name:        "git_show_file",
+			Description: "Returns the contents of a file as it was at a given revision.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo": gitRepoProperty,
+					"file": {Type: genai.TypeString, Description: "Path of the file relative to the repository root."},
+					"rev":  {Type: genai.TypeString, Description: "Revision to read from (default HEAD)."},
+				},
+				Required: []string{"file"},
+			},
+		},
+	},
+}
+
+// GitWriteTool holds the git tools that change repository state. It is kept separate
+// from GitReadTool so it can be withheld or gated independently.
+var GitWriteTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name:        "git_add",
+			Description: "Stages the given paths for commit.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo": gitRepoProperty,
+					"paths": {
+						Type:        genai.TypeArray,
+						Items:       &genai.Schema{Type: genai.TypeString},
+						Description: "Paths to stage.",
+					},
+				},
+				Required: []string{"paths"},
+			},
+		},
+		{
+			Name:        "git_commit",
+			Description: "Commits the staged changes. Always confirm the message with the user first.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"repo":    gitRepoProperty,
+					"message": {Type: genai.TypeString, Description: "The commit message."},
+				},
+				Required: []string{"message"},
+			},
+		},
+	},
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseGitStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		branch interface{}
+		files  []gitFileStatus
+	}{
+		{
+			name:   "clean",
+			out:    "## main...origin/main\x00",
+			branch: "main...origin/main",
+			files:  []gitFileStatus{},
+		},
+		{
+			name:   "modified, added and untracked",
+			out:    "## main\x00 M tool.go\x00A  new file.go\x00?? notes/\x00",
+			branch: "main",
+			files: []gitFileStatus{
+				{Path: "tool.go", Index: " ", WorkTree: "M"},
+				{Path: "new file.go", Index: "A", WorkTree: " "},
+				{Path: "notes/", Index: "?", WorkTree: "?"},
+			},
+		},
+		{
+			name:   "rename followed by its original path",
+			out:    "## main\x00R  b.go\x00a.go\x00 D gone.go\x00",
+			branch: "main",
+			files: []gitFileStatus{
+				{Path: "b.go", OrigPath: "a.go", Index: "R", WorkTree: " "},
+				{Path: "gone.go", Index: " ", WorkTree: "D"},
+			},
+		},
+		{
+			name:  "newline in a path",
+			out:   "MM odd\nname.go\x00",
+			files: []gitFileStatus{{Path: "odd\nname.go", Index: "M", WorkTree: "M"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGitStatus(tt.out)
+			if got["branch"] != tt.branch {
+				t.Errorf("branch = %v, want %v", got["branch"], tt.branch)
+			}
+			if !reflect.DeepEqual(got["files"], tt.files) {
+				t.Errorf("files = %+v, want %+v", got["files"], tt.files)
+			}
+			if got["clean"] != (len(tt.files) == 0) {
+				t.Errorf("clean = %v", got["clean"])
+			}
+		})
+	}
+}
+
+func TestParseBlame(t *testing.T) {
+	sha1 := strings.Repeat("a1", 20)
+	sha256 := strings.Repeat("b2", 32)
+	header := func(hash string, orig, final int) string {
+		return hash + " " + string(rune('0'+orig)) + " " + string(rune('0'+final)) + "\n"
+	}
+	entry := func(hash string, line int, author string, content string) string {
+		return header(hash, line, line) +
+			"author " + author + "\nauthor-mail <a@example.com>\nauthor-time 1714557600\nauthor-tz +0000\n" +
+			"committer Someone\ncommitter-time 1714557600\nsummary Initial commit\nfilename main.go\n\t" + content + "\n"
+	}
+
+	tests := []struct {
+		name string
+		out  string
+		want []gitBlameLine
+	}{
+		{
+			name: "sha-1",
+			out:  entry(sha1, 1, "Jane Doe", "package main") + entry(sha1, 2, "Jane Doe", ""),
+			want: []gitBlameLine{
+				{Line: 1, Commit: sha1, Author: "Jane Doe", Date: "2024-05-01T10:00:00Z", Content: "package main"},
+				{Line: 2, Commit: sha1, Author: "Jane Doe", Date: "2024-05-01T10:00:00Z", Content: ""},
+			},
+		},
+		{
+			name: "sha-256",
+			out:  entry(sha256, 3, "John Roe", "\tfunc main() {}"),
+			want: []gitBlameLine{
+				{Line: 3, Commit: sha256, Author: "John Roe", Date: "2024-05-01T10:00:00Z", Content: "\tfunc main() {}"},
+			},
+		},
+		{
+			name: "previous line naming another commit",
+			out: header(sha1, 4, 5) + "author Jane Doe\nauthor-time 1714557600\n" +
+				"previous " + strings.Repeat("c3", 20) + " old.go\nfilename main.go\n\tx := 1\n",
+			want: []gitBlameLine{
+				{Line: 5, Commit: sha1, Author: "Jane Doe", Date: "2024-05-01T10:00:00Z", Content: "x := 1"},
+			},
+		},
+		{name: "empty", out: "", want: []gitBlameLine{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlame(tt.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCommitHash(t *testing.T) {
+	tests := map[string]bool{
+		strings.Repeat("0123456789", 4):           true,
+		strings.Repeat("abcdef0123456789", 4):     true,
+		strings.Repeat("a", 39):                   false,
+		strings.Repeat("A", 40):                   false,
+		strings.Repeat("g", 40):                   false,
+		"author-mail <someone@example.com> xxxxx": false,
+	}
+	for s, want := range tests {
+		if got := isCommitHash(s); got != want {
+			t.Errorf("isCommitHash(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestTruncateGitOutput(t *testing.T) {
+	short := "diff --git a/x b/x\n"
+	if got, truncated := truncateGitOutput(short); got != short || truncated {
+		t.Errorf("short output changed: %q, %v", got, truncated)
+	}
+	// Put a three-byte character across the limit.
+	long := strings.Repeat("a", maxGitOutput-1) + "€" + strings.Repeat("b", 10)
+	got, truncated := truncateGitOutput(long)
+	if !truncated || !utf8.ValidString(got) || got != strings.Repeat("a", maxGitOutput-1) {
+		t.Errorf("got %d bytes (valid UTF-8: %v, truncated: %v), want the character dropped", len(got), utf8.ValidString(got), truncated)
+	}
+}
+
+func TestGitBlameAndStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "no-gitconfig"))
+
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "main.go"},
+		{"-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() { println() }\n", "new.go": "package main\n"})
+
+	lines, err := GitBlame(dir, "main.go", 2, 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Line != 2 || lines[1].Author != "Not Committed Yet" || !isCommitHash(lines[0].Commit) {
+		t.Errorf("blame = %+v", lines)
+	}
+
+	status, err := GitStatus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gitFileStatus{{Path: "main.go", Index: " ", WorkTree: "M"}, {Path: "new.go", Index: "?", WorkTree: "?"}}
+	if status["branch"] != "main" || !reflect.DeepEqual(status["files"], want) {
+		t.Errorf("status = %+v", status)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	maxGoReferences = 300
+	// maxGoSignature keeps struct and interface bodies from flooding the result.
+	maxGoSignature = 2000
+)
+
+// goSymbol is one top-level declaration in a Go file.
+type goSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // func, method, type, var or const
+	Receiver  string `json:"receiver,omitempty"`
+	Package   string `json:"package"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Exported  bool   `json:"exported"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+// goReference is one use of an identifier.
+type goReference struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+	IsDecl bool   `json:"isDeclaration,omitempty"`
+}
+
+// parsedGoFile is a parsed source file and its path relative to the search root.
+type parsedGoFile struct {
+	rel  string
+	file *ast.File
+	src  []byte
+}
+
+// parseGoFiles parses the .go files at path, which may be a single file or a directory.
+// Directories are searched recursively when recursive is set, skipping .git, vendor,
+// testdata and anything hidden by ignore rules. Files that fail to parse are skipped.
+func parseGoFiles(path string, recursive bool) (*token.FileSet, []parsedGoFile, error) {
+	if path == "" {
+		path = "."
+	}
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	if err := workspace.CheckRead(root); err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to access '%s': %v", root, err)
+	}
+
+	fset := token.NewFileSet()
+	var files []parsedGoFile
+	parse := func(p, rel string) {
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return
+		}
+		f, err := parser.ParseFile(fset, p, src, parser.ParseComments)
+		if err != nil && f == nil {
+			return
+		}
+		files = append(files, parsedGoFile{rel: filepath.ToSlash(rel), file: f, src: src})
+	}
+
+	if !info.IsDir() {
+		parse(root, filepath.Base(root))
+		return fset, files, nil
+	}
+
+	access := workspaceFor(root)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if !recursive || name == ".git" || name == "vendor" || name == "testdata" || access.Access(p, true) == accessHidden {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") || access.Access(p, false) == accessHidden {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		parse(p, rel)
+		return nil
+	})
+	return fset, files, err
+}
+
+// GoListSymbols lists the top-level declarations in a Go file or package directory.
+func GoListSymbols(path string, exportedOnly bool) ([]goSymbol, error) {
+	fset, files, err := parseGoFiles(path, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files found at '%s'", path)
+	}
+	symbols := []goSymbol{}
+	for _, pf := range files {
+		for _, s := range fileSymbols(fset, pf) {
+			if exportedOnly && !s.Exported {
+				continue
+			}
+			symbols = append(symbols, s)
+		}
+	}
+	return symbols, nil
+}
+
+// GoFindDefinition finds the declarations of symbol under directory. symbol is either a plain
+// name ("NewClient") or a method qualified by its receiver type ("App.Run").
+func GoFindDefinition(directory, symbol string) ([]goSymbol, error) {
+	symbol = strings.TrimSpace(symbol)
+	if symbol == "" {
+		return nil, fmt.Errorf("symbol must not be empty")
+	}
+	recv, name, qualified := strings.Cut(symbol, ".")
+	if !qualified {
+		name, recv = recv, ""
+	}
+
+	fset, files, err := parseGoFiles(directory, true)
+	if err != nil {
+		return nil, err
+	}
+	found := []goSymbol{}
+	for _, pf := range files {
+		for _, s := range fileSymbols(fset, pf) {
+			if s.Name != name {
+				continue
+			}
+			// "pkg.Name" also matches a package-level Name in package pkg.
+			if qualified && s.Receiver != recv && s.Package != recv {
+				continue
+			}
+			found = append(found, s)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no declaration of '%s' found", symbol)
+	}
+	return found, nil
+}
+
+// GoFindReferences finds every use of identifier under directory. Matching is by name only,
+// so unrelated identifiers with the same name are included.
+func GoFindReferences(directory, identifier string) (map[string]interface{}, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" || !token.IsIdentifier(identifier) {
+		return nil, fmt.Errorf("'%s' is not a valid Go identifier", identifier)
+	}
+	fset, files, err := parseGoFiles(directory, true)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []goReference{}
+	truncated := false
+	for _, pf := range files {
+		lines := strings.Split(string(pf.src), "\n")
+		ast.Inspect(pf.file, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || id.Name != identifier {
+				return true
+			}
+			if len(refs) >= maxGoReferences {
+				truncated = true
+				return false
+			}
+			pos := fset.Position(id.Pos())
+			ref := goReference{File: pf.rel, Line: pos.Line, Column: pos.Column, IsDecl: id.Obj != nil && id.Obj.Pos() == id.Pos()}
+			if pos.Line-1 < len(lines) {
+				ref.Text = strings.TrimSpace(lines[pos.Line-1])
+			}
+			refs = append(refs, ref)
+			return true
+		})
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].File != refs[j].File {
+			return refs[i].File < refs[j].File
+		}
+		return refs[i].Line < refs[j].Line
+	})
+	return map[string]interface{}{"references": refs, "count": len(refs), "truncated": truncated}, nil
+}
+
+// fileSymbols extracts the top-level declarations of one file.
+func fileSymbols(fset *token.FileSet, pf parsedGoFile) []goSymbol {
+	pkg := pf.file.Name.Name
+	var symbols []goSymbol
+	add := func(name, kind, recv string, node ast.Node, doc *ast.CommentGroup, sig string) {
+		symbols = append(symbols, goSymbol{
+			Name:      name,
+			Kind:      kind,
+			Receiver:  recv,
+			Package:   pkg,
+			File:      pf.rel,
+			Line:      fset.Position(node.Pos()).Line,
+			Exported:  ast.IsExported(name),
+			Signature: sig,
+			Doc:       strings.TrimSpace(doc.Text()),
+		})
+	}
+
+	for _, decl := range pf.file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind, recv := "func", ""
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind, recv = "method", receiverTypeName(d.Recv.List[0].Type)
+			}
+			sig := *d
+			sig.Body = nil
+			sig.Doc = nil
+			add(d.Name.Name, kind, recv, d, d.Doc, nodeString(fset, &sig))
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					doc := s.Doc
+					if doc == nil {
+						doc = d.Doc
+					}
+					add(s.Name.Name, "type", "", s, doc, "type "+nodeString(fset, s))
+				case *ast.ValueSpec:
+					doc := s.Doc
+					if doc == nil {
+						doc = d.Doc
+					}
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, n := range s.Names {
+						sig := kind + " " + n.Name
+						if s.Type != nil {
+							sig += " " + nodeString(fset, s.Type)
+						}
+						add(n.Name, kind, "", n, doc, sig)
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// receiverTypeName returns "T" for receivers of type T, *T, T[P] or *T[P].
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// nodeString prints node as Go source, truncated to maxGoSignature bytes.
+func nodeString(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	s := buf.String()
+	if len(s) > maxGoSignature {
+		s = s[:maxGoSignature] + " ..."
+	}
+	return s
+}
+
+var GoCodeTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "go_list_symbols",
+			Description: "Parses a Go file or package directory and lists its top-level functions, methods, types, " +
+				"variables and constants with signatures, doc comments and line numbers.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"path": {
+						Type:        genai.TypeString,
+						Description: "A .go file or a package directory. Defaults to the current working directory.",
+					},
+					"exportedOnly": {
+						Type:        genai.TypeBoolean,
+						Description: "Only list exported declarations.",
+					},
+				},
+			},
+		},
+		{
+			Name:        "go_find_definition",
+			Description: "Finds where a Go function, method, type, variable or constant is declared, with its signature and doc comment.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"symbol": {
+						Type:        genai.TypeString,
+						Description: "The name to find, e.g. 'NewClient', or 'Type.Method' / 'pkg.Name' to narrow it down.",
+					},
+					"directory": {
+						Type:        genai.TypeString,
+						Description: "Directory to search recursively. Defaults to the current working directory.",
+					},
+				},
+				Required: []string{"symbol"},
+			},
+		},
+		{
+			Name:        "go_find_references",
+			Description: "Finds every place a Go identifier is used, matching by name, with file, line, column and the source line.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"identifier": {
+						Type:        genai.TypeString,
+						Description: "The identifier to look for, e.g. 'buildResponse'.",
+					},
+					"directory": {
+						Type:        genai.TypeString,
+						Description: "Directory to search recursively. Defaults to the current working directory.",
+					},
+				},
+				Required: []string{"identifier"},
+			},
+		},
+	},
+}
+
+// runGoCodeTool dispatches a go_* function call.
+func runGoCodeTool(name string, args map[string]interface{}) (interface{}, error) {
+	directory, _ := args["directory"].(string)
+	switch name {
+	case "go_list_symbols":
+		path, _ := args["path"].(string)
+		exportedOnly, _ := args["exportedOnly"].(bool)
+		return GoListSymbols(path, exportedOnly)
+	case "go_find_definition":
+		symbol, _ := args["symbol"].(string)
+		return GoFindDefinition(directory, symbol)
+	case "go_find_references":
+		identifier, _ := args["identifier"].(string)
+		return GoFindReferences(directory, identifier)
+	}
+	return nil, fmt.Errorf("unknown Go tool '%s'", name)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGoApp = `// Package app runs things.
+package app
+
+import "fmt"
+
+// Version is the release.
+const Version = "1.0"
+
+const (
+	// A is first.
+	A, b = 1, 2
+)
+
+var Default *App
+
+// App runs things.
+type App struct {
+	name string
+}
+
+// New makes an App.
+func New(name string) *App {
+	return &App{name: name}
+}
+
+// Run starts the app.
+func (a *App) Run() error {
+	fmt.Println(a.name)
+	return nil
+}
+
+func (a App) helper() {}
+
+type List[T any] struct{ items []T }
+
+func (l *List[T]) Len() int { return len(l.items) }
+`
+
+func setupGoCodeDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app/app.go":         testGoApp,
+		"app/sub/sub.go":     "package sub\n\nfunc Run() {}\n\nfunc New() int { return 1 }\n\nvar _ = New()\n",
+		"app/notes.txt":      "func New() {}\n",
+		"vendor/lib/lib.go":  "package lib\n\nfunc New() {}\n",
+		"testdata/x/x.go":    "package x\n\nfunc New() {}\n",
+		"generated/gen.go":   "package generated\n\nfunc New() {}\n",
+		".gitignore":         "generated/\n",
+		".git/hooks/hook.go": "package hook\n\nfunc New() {}\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	return dir
+}
+
+// symbolList formats symbols as "kind Recv.Name file:line" for comparison.
+func symbolList(symbols []goSymbol) string {
+	var out []string
+	for _, s := range symbols {
+		name := s.Name
+		if s.Receiver != "" {
+			name = s.Receiver + "." + name
+		}
+		out = append(out, fmt.Sprintf("%s %s %s:%d", s.Kind, name, s.File, s.Line))
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestGoListSymbols(t *testing.T) {
+	dir := setupGoCodeDir(t)
+
+	tests := []struct {
+		name         string
+		path         string
+		exportedOnly bool
+		want         string
+		err          string
+	}{
+		{
+			name: "package directory",
+			path: "app",
+			want: "const Version app.go:7, const A app.go:11, const b app.go:11, var Default app.go:14, type App app.go:17, " +
+				"func New app.go:22, method App.Run app.go:27, method App.helper app.go:32, type List app.go:34, method List.Len app.go:36",
+		},
+		{
+			name:         "exported only",
+			path:         "app",
+			exportedOnly: true,
+			want: "const Version app.go:7, const A app.go:11, var Default app.go:14, type App app.go:17, " +
+				"func New app.go:22, method App.Run app.go:27, type List app.go:34, method List.Len app.go:36",
+		},
+		{name: "single file", path: "app/sub/sub.go", want: "func Run sub.go:3, func New sub.go:5, var _ sub.go:7"},
+		{name: "no Go files", path: "testdata", err: "no Go files found"},
+		{name: "missing", path: "nope", err: "failed to access"},
+		{name: "ignored", path: "generated", err: "excluded by ignore rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			symbols, err := GoListSymbols(filepath.Join(dir, tt.path), tt.exportedOnly)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := symbolList(symbols); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	symbols, err := GoListSymbols(filepath.Join(dir, "app/app.go"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := map[string][2]string{
+		"Version": {`const Version`, "Version is the release."},
+		"A":       {`const A`, "A is first."},
+		"App":     {"type App struct {\n\tname string\n}", "App runs things."},
+		"New":     {"func New(name string) *App", "New makes an App."},
+		"Run":     {"func (a *App) Run() error", "Run starts the app."},
+		"List":    {"type List[T any] struct{ items []T }", ""},
+	}
+	for _, s := range symbols {
+		want, ok := details[s.Name]
+		if !ok {
+			continue
+		}
+		if s.Signature != want[0] || s.Doc != want[1] || s.Package != "app" {
+			t.Errorf("%s: signature %q, doc %q, package %q; want %q, %q", s.Name, s.Signature, s.Doc, s.Package, want[0], want[1])
+		}
+	}
+}
+
+func TestGoFindDefinition(t *testing.T) {
+	dir := setupGoCodeDir(t)
+
+	tests := []struct {
+		symbol string
+		want   string
+		err    string
+	}{
+		{symbol: "New", want: "func New app/app.go:22, func New app/sub/sub.go:5"},
+		{symbol: "App.Run", want: "method App.Run app/app.go:27"},
+		{symbol: "sub.Run", want: "func Run app/sub/sub.go:3"},
+		{symbol: "Run", want: "method App.Run app/app.go:27, func Run app/sub/sub.go:3"},
+		{symbol: "List.Len", want: "method List.Len app/app.go:36"},
+		{symbol: " Default ", want: "var Default app/app.go:14"},
+		{symbol: "Other.Run", err: "no declaration of 'Other.Run' found"},
+		{symbol: "Missing", err: "no declaration of 'Missing' found"},
+		{symbol: " ", err: "must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			symbols, err := GoFindDefinition(dir, tt.symbol)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := symbolList(symbols); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoFindReferences(t *testing.T) {
+	dir := setupGoCodeDir(t)
+
+	tests := []struct {
+		identifier string
+		want       string
+		err        string
+	}{
+		{identifier: "New", want: "app/app.go:22:6 decl, app/sub/sub.go:5:6 decl, app/sub/sub.go:7:9"},
+		{identifier: "name", want: "app/app.go:18:2 decl, app/app.go:22:10 decl, app/app.go:23:14, app/app.go:23:20, app/app.go:28:16"},
+		{identifier: "Missing", want: ""},
+		{identifier: "App.Run", err: "not a valid Go identifier"},
+		{identifier: "func", err: "not a valid Go identifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.identifier, func(t *testing.T) {
+			res, err := GoFindReferences(dir, tt.identifier)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range res["references"].([]goReference) {
+				ref := fmt.Sprintf("%s:%d:%d", r.File, r.Line, r.Column)
+				if r.IsDecl {
+					ref += " decl"
+				}
+				got = append(got, ref)
+			}
+			if strings.Join(got, ", ") != tt.want {
+				t.Errorf("got  %s\nwant %s", strings.Join(got, ", "), tt.want)
+			}
+			if res["count"] != len(got) || res["truncated"] != false {
+				t.Errorf("count %v, truncated %v", res["count"], res["truncated"])
+			}
+		})
+	}
+}
+
+func TestGoFindReferencesLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go": "package a\n\nvar x int\n\nfunc f() {\n" + strings.Repeat("\tx++\n", maxGoReferences+50) + "}\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	res, err := GoFindReferences(dir, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := res["references"].([]goReference)
+	if len(refs) != maxGoReferences || res["truncated"] != true {
+		t.Errorf("got %d references, truncated %v; want %d, true", len(refs), res["truncated"], maxGoReferences)
+	}
+	if refs[1].Text != "x++" {
+		t.Errorf("text = %q", refs[1].Text)
+	}
+}
+
+func TestReceiverTypeName(t *testing.T) {
+	tests := map[string]string{
+		"func (a App) F()":        "App",
+		"func (a *App) F()":       "App",
+		"func (*App) F()":         "App",
+		"func (l List[T]) F()":    "List",
+		"func (m *Map[K, V]) F()": "Map",
+	}
+	for src, want := range tests {
+		f, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n"+src+" {}\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := f.Decls[0].(*ast.FuncDecl)
+		if got := receiverTypeName(fn.Recv.List[0].Type); got != want {
+			t.Errorf("%s: got %q, want %q", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// droppedElements are left out of converted pages: code, styling, forms and site chrome.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Iframe: true,
+	atom.Svg: true, atom.Canvas: true, atom.Nav: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Input: true, atom.Textarea: true,
+	atom.Dialog: true, atom.Head: true, atom.Object: true, atom.Embed: true,
+}
+
+// droppedRoles are ARIA roles of navigation and other page chrome.
+var droppedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "search": true, "menu": true, "menubar": true, "complementary": true,
+}
+
+// blockElements start a new paragraph when they appear among inline content.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Details: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Fieldset: true, atom.Figure: true, atom.Figcaption: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Summary: true, atom.Table: true, atom.Ul: true,
+	atom.Body: true, atom.Html: true,
+}
+
+var (
+	spaceRun      = regexp.MustCompile(`[ \t]+`)
+	whitespaceRun = regexp.MustCompile(`\s+`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+	codeLanguage  = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([\w+#-]+)`)
+)
+
+// htmlToMarkdown converts an HTML page to markdown and returns the page title and the
+// markdown. Only the page's <main> element (or its only <article>) is converted when there is
+// one; scripts, styles, forms and navigation are dropped, and links are made absolute against
+// base.
+func htmlToMarkdown(page string, base *url.URL) (string, string) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", page
+	}
+	c := &mdConverter{base: base}
+	title := ""
+	if t := findElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Title }); t != nil {
+		title = strings.Join(strings.Fields(textContent(t)), " ")
+	}
+
+	root := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Main || attr(n, "role") == "main"
+	})
+	if root == nil {
+		var articles []*html.Node
+		collectElements(doc, func(n *html.Node) bool { return n.DataAtom == atom.Article }, &articles)
+		if len(articles) == 1 {
+			root = articles[0]
+		} else {
+			root = doc
+		}
+	}
+	md := blankLines.ReplaceAllString(strings.TrimSpace(c.blocks(root)), "\n\n")
+	return title, md + "\n"
+}
+
+// mdConverter renders HTML nodes as markdown.
+type mdConverter struct {
+	base *url.URL
+}
+
+// dropped reports whether n and its children are left out.
+func dropped(n *html.Node) bool {
+	if n.Type == html.CommentNode {
+		return true
+	}
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if droppedElements[n.DataAtom] || droppedRoles[attr(n, "role")] || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	_, hidden := attrOK(n, "hidden")
+	return hidden
+}
+
+// blocks renders the children of n, grouping runs of inline content into paragraphs.
+func (c *mdConverter) blocks(n *html.Node) string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		if p := cleanInline(inline.String()); p != "" {
+			out = append(out, p)
+		}
+		inline.Reset()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if dropped(child) {
+			continue
+		}
+		if child.Type == html.ElementNode && blockElements[child.DataAtom] {
+			flush()
+			if b := c.block(child); strings.TrimSpace(b) != "" {
+				out = append(out, b)
+			}
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return strings.Join(out, "\n\n")
+}
+
+// block renders one block-level element.
+func (c *mdConverter) block(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := cleanInline(c.inlineChildren(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")
+	case atom.Hr:
+		return "---"
+	case atom.Pre:
+		lang := ""
+		if code := findElement(n, func(e *html.Node) bool { return e.DataAtom == atom.Code }); code != nil {
+			if m := codeLanguage.FindStringSubmatch(attr(code, "class")); m != nil {
+				lang = m[1]
+			}
+		}
+		if m := codeLanguage.FindStringSubmatch(attr(n, "class")); lang == "" && m != nil {
+			lang = m[1]
+		}
+		code := strings.Trim(textContent(n), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + lang + "\n" + code + "\n" + fence
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Blockquote:
+		return prefixLines(c.blocks(n), "> ", "> ")
+	case atom.Table:
+		return c.table(n)
+	case atom.Dt:
+		return "**" + cleanInline(c.inlineChildren(n)) + "**"
+	case atom.Dd:
+		return prefixLines(c.blocks(n), ": ", "  ")
+	}
+	return c.blocks(n)
+}
+
+// list renders a ul or ol, indenting nested content under each item.
+func (c *mdConverter) list(n *html.Node) string {
+	var items []string
+	num := 1
+	if start := attr(n, "start"); start != "" {
+		fmt.Sscanf(start, "%d", &num)
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li || dropped(li) {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", num)
+			num++
+		}
+		body := c.blocks(li)
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		// Keep list items compact: paragraphs inside an item are separated by one line.
+		body = blankLines.ReplaceAllString(strings.ReplaceAll(body, "\n\n", "\n"), "\n")
+		items = append(items, prefixLines(body, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders a table as a markdown table, using the first row as the header.
+func (c *mdConverter) table(n *html.Node) string {
+	var rows [][]string
+	var trs []*html.Node
+	collectElements(n, func(e *html.Node) bool { return e.DataAtom == atom.Tr }, &trs)
+	width := 0
+	for _, tr := range trs {
+		var row []string
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+				text := strings.ReplaceAll(cleanInline(c.inlineChildren(cell)), "\n", " ")
+				row = append(row, strings.ReplaceAll(text, "|", `\|`))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+			width = max(width, len(row))
+		}
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// inlineChildren renders the children of n as inline content, flattening any blocks.
+func (c *mdConverter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if !dropped(child) {
+			b.WriteString(c.inline(child))
+		}
+	}
+	return b.String()
+}
+
+// inline renders a node inside a paragraph.
+func (c *mdConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return whitespaceRun.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	inner := func() string { return c.inlineChildren(n) }
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.Strong, atom.B:
+		return wrapInline(inner(), "**")
+	case atom.Em, atom.I:
+		return wrapInline(inner(), "*")
+	case atom.Code, atom.Kbd, atom.Samp:
+		text := textContent(n)
+		if strings.TrimSpace(text) == "" {
+			return ""
+		}
+		tick := "`"
+		for strings.Contains(text, tick) {
+			tick += "`"
+		}
+		return tick + strings.Join(strings.Fields(text), " ") + tick
+	case atom.A:
+		text := strings.TrimSpace(inner())
+		href := c.resolve(attr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		alt := strings.TrimSpace(attr(n, "alt"))
+		src := c.resolve(attr(n, "src"))
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+	}
+	if blockElements[n.DataAtom] {
+		return " " + inner() + " "
+	}
+	return inner()
+}
+
+// resolve makes href absolute, dropping script and same-page links.
+func (c *mdConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(u.String(), "(", "%28"), ")", "%29")
+}
+
+// wrapInline wraps text in a markdown marker, keeping surrounding spaces outside it.
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// cleanInline collapses the whitespace of a paragraph and trims each line.
+func cleanInline(s string) string {
+	lines := strings.Split(spaceRun.ReplaceAllString(s, " "), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// prefixLines puts first before the first line of s and rest before the others.
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		p := rest
+		if i == 0 {
+			p = first
+		}
+		if l == "" {
+			lines[i] = strings.TrimRight(p, " ")
+		} else {
+			lines[i] = p + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textContent returns the text inside n, exactly as written.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.CommentNode {
+			b.WriteString(textContent(child))
+		}
+	}
+	return b.String()
+}
+
+// findElement returns the first element under n, in document order, for which match is true.
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// collectElements appends every element under n for which match is true to out.
+func collectElements(n *html.Node, match func(*html.Node) bool, out *[]*html.Node) {
+	if n.Type == html.ElementNode && match(n) {
+		*out = append(*out, n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		collectElements(child, match, out)
+	}
+}
+
+// attr returns the value of an attribute of n, or "".
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+// attrOK returns the value of an attribute of n and whether it is present.
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ignoreFileNames are read in every directory, in this order. Rules in later files win.
+var ignoreFileNames = []string{".gitignore", ".fileignore"}
+
+// ignoreRule is one compiled line of an ignore file.
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// ignoreMatcher answers whether a path below root is excluded, using full .gitignore semantics.
+// Ignore files are loaded lazily from each directory and reloaded when they change.
+type ignoreMatcher struct {
+	root string
+
+	mu    sync.Mutex
+	rules map[string]dirRules // keyed by slash-separated directory relative to root ("" for root)
+}
+
+// dirRules are the rules of one directory's ignore files, with the size and modification time
+// of each file when they were read.
+type dirRules struct {
+	stamp string
+	rules []ignoreRule
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{root: root, rules: make(map[string]dirRules)}
+}
+
+// Match reports whether relPath (relative to the matcher's root) is ignored. A path inside an
+// ignored directory is always ignored, as in git.
+func (m *ignoreMatcher) Match(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." || relPath == "" || strings.HasPrefix(relPath, "../") {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	// rules[i] holds the rules of the directory made of the first i parts.
+	rules := make([][]ignoreRule, len(parts))
+	for i := range rules {
+		rules[i] = m.rulesFor(strings.Join(parts[:i], "/"))
+	}
+	for i := 1; i < len(parts); i++ {
+		if matchRules(rules[:i], parts[:i], true) {
+			return true
+		}
+	}
+	return matchRules(rules, parts, isDir)
+}
+
+// matchRules evaluates the rules of every ignore file between the root and the parent of the
+// path made of parts. The last matching rule decides, so deeper files and later lines override
+// earlier ones.
+func matchRules(rules [][]ignoreRule, parts []string, isDir bool) bool {
+	ignored := false
+	for i := range parts {
+		rel := strings.Join(parts[i:], "/")
+		for _, r := range rules[i] {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if r.re.MatchString(rel) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// rulesFor returns the rules for dir, reading its ignore files again if any of them was
+// created, changed or removed since they were cached.
+func (m *ignoreMatcher) rulesFor(dir string) []ignoreRule {
+	base := filepath.Join(m.root, filepath.FromSlash(dir))
+	var stamp strings.Builder
+	for _, name := range ignoreFileNames {
+		if info, err := os.Stat(filepath.Join(base, name)); err == nil {
+			fmt.Fprintf(&stamp, "%d:%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			stamp.WriteString("-;")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached, ok := m.rules[dir]; ok && cached.stamp == stamp.String() {
+		return cached.rules
+	}
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(base, name))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, parseIgnoreFile(string(data))...)
+	}
+	m.rules[dir] = dirRules{stamp: stamp.String(), rules: rules}
+	return rules
+}
+
+// parseIgnoreFile compiles every rule in an ignore file, skipping blanks and comments.
+func parseIgnoreFile(content string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		if r, ok := parseIgnoreLine(line); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreLine compiles a single .gitignore line.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	r := ignoreRule{pattern: line}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, `\/`) {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash at the start or in the middle anchors the pattern to the ignore file's directory;
+	// otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	re, err := regexp.Compile(globToRegexp(line, anchored))
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped with a backslash.
+func trimTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// globToRegexp translates a gitignore glob into an anchored regular expression over
+// slash-separated relative paths.
+func globToRegexp(glob string, anchored bool) string {
+	g := []rune(glob)
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(g); i++ {
+		switch c := g[i]; c {
+		case '*':
+			if i+1 < len(g) && g[i+1] == '*' {
+				atStart := i == 0 || g[i-1] == '/'
+				atEnd := i+2 == len(g) || g[i+2] == '/'
+				if atStart && atEnd {
+					if i+2 == len(g) {
+						// "foo/**" matches everything inside foo.
+						b.WriteString(".*")
+					} else {
+						// "**/" matches zero or more directories.
+						b.WriteString("(?:.*/)?")
+						i++ // skip the slash
+					}
+					i++
+					continue
+				}
+				// Any other "**" behaves like "*".
+				i++
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := classEnd(g, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString("[")
+			j := i + 1
+			if g[j] == '!' || g[j] == '^' {
+				b.WriteString("^")
+				j++
+			}
+			for ; j < end; j++ {
+				escaped := false
+				if g[j] == '\\' && j+1 < end {
+					j++
+					escaped = true
+				}
+				if !escaped && g[j] == '-' && j > i+1 && j+1 < end {
+					b.WriteRune('-')
+					continue
+				}
+				b.WriteString(regexp.QuoteMeta(string(g[j])))
+			}
+			b.WriteString("]")
+			i = end
+		case '\\':
+			if i+1 < len(g) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(g[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// classEnd returns the index of the ']' closing the character class that starts at i, or -1.
+func classEnd(g []rune, i int) int {
+	j := i + 1
+	if j < len(g) && (g[j] == '!' || g[j] == '^') {
+		j++
+	}
+	if j < len(g) && g[j] == ']' {
+		j++
+	}
+	for ; j < len(g); j++ {
+		if g[j] == '\\' {
+			j++
+			continue
+		}
+		if g[j] == ']' {
+			return j
+		}
+	}
+	return -1
+}
+
+// IgnoreModeEnv selects what ignore rules mean for file tools: "hidden" (the default) hides
+// ignored paths from listings and refuses to read or write them; "read-only" lists and reads
+// them but refuses writes.
+const IgnoreModeEnv = "MYAPP_IGNORE_MODE"
+
+const (
+	ignoreModeHidden   = "hidden"
+	ignoreModeReadOnly = "read-only"
+)
+
+// accessLevel is what file tools may do with a path.
+type accessLevel int
+
+const (
+	accessFull accessLevel = iota
+	accessReadOnly
+	accessHidden
+)
+
+// workspaceAccess is the single place file tools ask whether a path may be listed, read or written.
+type workspaceAccess struct {
+	root    string
+	mode    string
+	matcher *ignoreMatcher
+}
+
+// workspace governs paths under the directory the CLI was started in.
+var workspace *workspaceAccess
+
+func newWorkspaceAccess(root string) *workspaceAccess {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv(IgnoreModeEnv)))
+	if mode != ignoreModeReadOnly {
+		mode = ignoreModeHidden
+	}
+	return &workspaceAccess{root: root, mode: mode, matcher: newIgnoreMatcher(root)}
+}
+
+// workspaceFor returns the workspace governing dir, or a new one rooted at dir when dir is
+// outside the workspace, so that dir's own ignore files still apply.
+func workspaceFor(dir string) *workspaceAccess {
+	if workspace != nil {
+		if _, ok := workspace.relPath(dir); ok {
+			return workspace
+		}
+	}
+	w := newWorkspaceAccess(dir)
+	if workspace != nil {
+		w.mode = workspace.mode
+	}
+	return w
+}
+
+// relPath returns absPath relative to the workspace root, reporting false if it lies outside.
+func (w *workspaceAccess) relPath(absPath string) (string, bool) {
+	rel, err := filepath.Rel(w.root, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// Access classifies absPath. Paths outside the workspace are not governed by its ignore rules.
+func (w *workspaceAccess) Access(absPath string, isDir bool) accessLevel {
+	if w == nil {
+		return accessFull
+	}
+	rel, ok := w.relPath(absPath)
+	if !ok || !w.matcher.Match(rel, isDir) {
+		return accessFull
+	}
+	if w.mode == ignoreModeReadOnly {
+		return accessReadOnly
+	}
+	return accessHidden
+}
+
+// CheckRead returns an error for the model if absPath may not be read.
+func (w *workspaceAccess) CheckRead(absPath string) error {
+	if w.Access(absPath, isDirPath(absPath)) == accessHidden {
+		return fmt.Errorf("'%s' is excluded by ignore rules (.fileignore/.gitignore) and cannot be accessed", absPath)
+	}
+	return nil
+}
+
+// CheckWrite returns an error for the model if absPath may not be created or changed.
+func (w *workspaceAccess) CheckWrite(absPath string) error {
+	switch w.Access(absPath, isDirPath(absPath)) {
+	case accessHidden:
+		return fmt.Errorf("'%s' is excluded by ignore rules (.fileignore/.gitignore) and cannot be accessed", absPath)
+	case accessReadOnly:
+		return fmt.Errorf("'%s' matches ignore rules (.fileignore/.gitignore) and is read-only", absPath)
+	}
+	return nil
+}
+
+func isDirPath(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
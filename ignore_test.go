@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		ok      bool
+		negate  bool
+		dirOnly bool
+		match   []string // paths the rule matches
+		noMatch []string
+	}{
+		{line: "", ok: false},
+		{line: "   ", ok: false},
+		{line: "# a comment", ok: false},
+		{line: "/", ok: false},
+		{line: "*.log", ok: true, match: []string{"a.log", "dir/b.log"}, noMatch: []string{"a.log.txt"}},
+		{line: "*.log\r", ok: true, match: []string{"a.log"}},
+		{line: "build/", ok: true, dirOnly: true, match: []string{"build", "src/build"}},
+		{line: "/build", ok: true, match: []string{"build"}, noMatch: []string{"src/build"}},
+		{line: "doc/*.txt", ok: true, match: []string{"doc/a.txt"}, noMatch: []string{"src/doc/a.txt", "doc/sub/a.txt"}},
+		{line: "!keep.log", ok: true, negate: true, match: []string{"keep.log", "dir/keep.log"}},
+		{line: `\!important`, ok: true, match: []string{"!important"}},
+		{line: `\#notes`, ok: true, match: []string{"#notes"}},
+		{line: "trailing   ", ok: true, match: []string{"trailing"}, noMatch: []string{"trailing "}},
+		{line: `space\ `, ok: true, match: []string{"space "}, noMatch: []string{"space"}},
+		{line: `star\*`, ok: true, match: []string{"star*"}, noMatch: []string{"starry"}},
+		{line: "go", ok: true, match: []string{"go", "cmd/go"}, noMatch: []string{"golang", "cargo.toml", "go.mod"}},
+	}
+	for _, tt := range tests {
+		r, ok := parseIgnoreLine(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseIgnoreLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if r.negate != tt.negate || r.dirOnly != tt.dirOnly {
+			t.Errorf("parseIgnoreLine(%q) = negate %v, dirOnly %v; want %v, %v", tt.line, r.negate, r.dirOnly, tt.negate, tt.dirOnly)
+		}
+		for _, p := range tt.match {
+			if !r.re.MatchString(p) {
+				t.Errorf("%q does not match %q", tt.line, p)
+			}
+		}
+		for _, p := range tt.noMatch {
+			if r.re.MatchString(p) {
+				t.Errorf("%q matches %q", tt.line, p)
+			}
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob     string
+		anchored bool
+		match    []string
+		noMatch  []string
+	}{
+		{"**/logs", true, []string{"logs", "a/logs", "a/b/logs"}, []string{"logs2", "a/xlogs"}},
+		{"logs/**", true, []string{"logs/a", "logs/a/b"}, []string{"logs", "x/logs/a"}},
+		{"a/**/b", true, []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"ab", "a/xb", "x/a/b"}},
+		{"a**b", false, []string{"ab", "axxb", "dir/ab"}, []string{"a/b"}},
+		{"*.go", false, []string{"main.go", "cmd/x/main.go"}, []string{"main.go/x", "main.gox"}},
+		{"?.txt", false, []string{"a.txt"}, []string{"ab.txt", "/.txt"}},
+		{"[abc].md", false, []string{"a.md", "c.md"}, []string{"d.md"}},
+		{"[!abc].md", false, []string{"d.md"}, []string{"a.md"}},
+		{"[a-c]x", false, []string{"bx"}, []string{"dx", "-x"}},
+		{"[]]x", false, []string{"]x"}, []string{"ax"}},
+		{"[x", false, []string{"[x"}, []string{"x"}},
+		{"a.b+c(d)", false, []string{"a.b+c(d)"}, []string{"aXb+c(d)"}},
+		{"snow☃", false, []string{"snow☃"}, []string{"snow"}},
+	}
+	for _, tt := range tests {
+		re, err := regexp.Compile(globToRegexp(tt.glob, tt.anchored))
+		if err != nil {
+			t.Errorf("%q: %v", tt.glob, err)
+			continue
+		}
+		for _, p := range tt.match {
+			if !re.MatchString(p) {
+				t.Errorf("%q (%s) does not match %q", tt.glob, re, p)
+			}
+		}
+		for _, p := range tt.noMatch {
+			if re.MatchString(p) {
+				t.Errorf("%q (%s) matches %q", tt.glob, re, p)
+			}
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":           "# build output\n*.log\n!important.log\n/vendor/\ngo\ndocs/**/draft.md\nsecret/\n!secret/keep.txt\n",
+		".fileignore":          "*.env\n",
+		"src/.gitignore":       "!*.log\ngenerated/\n",
+		"src/deep/.fileignore": "/local.txt\n",
+	})
+
+	m := newIgnoreMatcher(dir)
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"logs/app.log", false, true},
+		{"important.log", false, false},
+		{"vendor", true, true},
+		{"vendor/lib/x.go", false, true},
+		{"vendor", false, false},    // directory-only rule
+		{"src/vendor", true, false}, // anchored to the root
+		{"go", true, true},
+		{"go/bin/tool", false, true},
+		{"golang", true, false},
+		{"golang/main.go", false, false},
+		{"cargo.toml", false, false},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"docs/final.md", false, false},
+		{"prod.env", false, true},
+		{"secret/keep.txt", false, true}, // can't re-include under an excluded parent
+		{"src/app.log", false, false},    // nested file negates the parent's rule
+		{"src/generated/x.go", false, true},
+		{"generated/x.go", false, false},
+		{"src/deep/local.txt", false, true},
+		{"src/deep/sub/local.txt", false, false},
+		{"local.txt", false, false},
+		{".", true, false},
+		{"../outside.log", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreMatcherReloads(t *testing.T) {
+	dir := t.TempDir()
+	m := newIgnoreMatcher(dir)
+	if m.Match("notes.txt", false) {
+		t.Fatal("notes.txt ignored without an ignore file")
+	}
+
+	writeFiles(t, dir, map[string]string{".gitignore": "notes.txt\n"})
+	if !m.Match("notes.txt", false) {
+		t.Error("a new .gitignore was not picked up")
+	}
+
+	// Same size, later modification time.
+	writeFiles(t, dir, map[string]string{".gitignore": "other.txt\n"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, ".gitignore"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if m.Match("notes.txt", false) || !m.Match("other.txt", false) {
+		t.Error("an edited .gitignore was not picked up")
+	}
+
+	writeFiles(t, dir, map[string]string{"sub/.fileignore": "*.txt\n"})
+	if !m.Match("sub/notes.txt", false) {
+		t.Error("a new nested ignore file was not picked up")
+	}
+	if err := os.Remove(filepath.Join(dir, ".gitignore")); err != nil {
+		t.Fatal(err)
+	}
+	if m.Match("other.txt", false) {
+		t.Error("a removed .gitignore still applies")
+	}
+}
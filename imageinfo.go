@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxImageInfoSize bounds how much of an image file image_info reads.
+const maxImageInfoSize = 100 * 1024 * 1024
+
+// imageInfo is what image_info reports about an image, all read locally.
+type imageInfo struct {
+	Path      string     `json:"path"`
+	Format    string     `json:"format"`
+	MIMEType  string     `json:"mimeType"`
+	Width     int        `json:"width,omitempty"`
+	Height    int        `json:"height,omitempty"`
+	Size      int64      `json:"size"`
+	Exif      *imageExif `json:"exif,omitempty"`
+	GPS       *imageGPS  `json:"gps,omitempty"`
+	Sensitive []string   `json:"sensitive,omitempty"`
+	Upload    []string   `json:"upload,omitempty"` // what preprocessing does or would do before upload
+}
+
+// imageExif is the commonly useful subset of an image's EXIF data.
+type imageExif struct {
+	Camera      string `json:"camera,omitempty"`
+	Lens        string `json:"lens,omitempty"`
+	Software    string `json:"software,omitempty"`
+	Taken       string `json:"taken,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	SerialNo    string `json:"serialNumber,omitempty"`
+}
+
+// imageGPS is the location embedded in an image.
+type imageGPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// ImageInfo reports an image's format, dimensions, file size and EXIF metadata without
+// uploading it. Embedded GPS coordinates, serial numbers and author names are listed under
+// Sensitive, and Upload says how the image would be changed before being sent for analysis.
+func ImageInfo(filePath string) (*imageInfo, error) {
+	fullPath, err := resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := workspace.CheckRead(fullPath); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access file: %v", err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", filePath)
+	}
+	if stat.Size() > maxImageInfoSize {
+		return nil, fmt.Errorf("%s is too large (%d bytes)", filePath, stat.Size())
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	mimeType := detectMIME(fullPath, data[:min(len(data), sniffLen)])
+	if mediaCategory(mimeType) != "Image" {
+		return nil, fmt.Errorf("%s is not an image (%s)", filePath, mimeType)
+	}
+
+	info := &imageInfo{Path: fullPath, MIMEType: mimeType, Size: stat.Size()}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info.Format, info.Width, info.Height = format, cfg.Width, cfg.Height
+	} else {
+		info.Format = strings.TrimPrefix(mimeType, "image/")
+		info.Width, info.Height = heifDimensions(data)
+	}
+
+	if tiff := findExif(data, info.Format); tiff != nil {
+		info.Exif, info.GPS = parseExif(tiff)
+	}
+	if info.Exif != nil {
+		if info.Exif.Orientation >= 5 {
+			// Rotated a quarter turn: report the size as displayed.
+			info.Width, info.Height = info.Height, info.Width
+		}
+		if info.Exif.SerialNo != "" {
+			info.Sensitive = append(info.Sensitive, "camera serial number")
+		}
+		if info.Exif.Artist != "" {
+			info.Sensitive = append(info.Sensitive, "author name")
+		}
+	}
+	if info.GPS != nil {
+		info.Sensitive = append(info.Sensitive, fmt.Sprintf("GPS location %.5f, %.5f", info.GPS.Latitude, info.GPS.Longitude))
+	}
+	info.Upload = plannedImagePrep(info, imagePrepSteps())
+	return info, nil
+}
+
+// heifDimensions reads the size of a HEIC/HEIF image from its first "ispe" box, which the
+// standard decoders can't parse.
+func heifDimensions(data []byte) (int, int) {
+	i := bytes.Index(data[:min(len(data), 64*1024)], []byte("ispe"))
+	if i < 0 || i+16 > len(data) {
+		return 0, 0
+	}
+	// The box type is followed by a 4-byte version and flags.
+	return int(binary.BigEndian.Uint32(data[i+8:])), int(binary.BigEndian.Uint32(data[i+12:]))
+}
+
+// findExif returns the TIFF-structured EXIF block of an image, or nil if it has none.
+func findExif(data []byte, format string) []byte {
+	exifHeader := []byte("Exif\x00\x00")
+	switch format {
+	case "jpeg":
+		for _, seg := range jpegSegments(data) {
+			if seg.marker == 0xE1 && bytes.HasPrefix(seg.payload, exifHeader) {
+				return seg.payload[len(exifHeader):]
+			}
+		}
+		return nil
+	case "png":
+		for _, c := range pngChunks(data) {
+			if c.kind == "eXIf" {
+				return c.data
+			}
+		}
+		return nil
+	case "webp":
+		for pos := 12; pos+8 <= len(data); {
+			size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+			if pos+8+size > len(data) || size < 0 {
+				return nil
+			}
+			if string(data[pos:pos+4]) == "EXIF" {
+				return bytes.TrimPrefix(data[pos+8:pos+8+size], exifHeader)
+			}
+			pos += 8 + size + size%2
+		}
+		return nil
+	case "tiff":
+		return data
+	}
+	// HEIC and others keep EXIF in a box prefixed with the usual header.
+	if i := bytes.Index(data, exifHeader); i >= 0 {
+		return data[i+len(exifHeader):]
+	}
+	return nil
+}
+
+// jpegSegment is one marker segment of a JPEG file before the image data.
+type jpegSegment struct {
+	marker     byte
+	start, end int // byte range of the whole segment, including the marker
+	payload    []byte
+}
+
+// jpegSegments lists the marker segments of a JPEG up to the start of the scan data.
+func jpegSegments(data []byte) []jpegSegment {
+	var segs []jpegSegment
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segs = append(segs, jpegSegment{marker: marker, start: pos, end: pos + 2 + length, payload: data[pos+4 : pos+2+length]})
+		pos += 2 + length
+	}
+	return segs
+}
+
+// pngChunk is one chunk of a PNG file.
+type pngChunk struct {
+	kind       string
+	start, end int // byte range including length, type and CRC
+	data       []byte
+}
+
+// pngChunks lists the chunks of a PNG file.
+func pngChunks(data []byte) []pngChunk {
+	var chunks []pngChunk
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[pos+4 : pos+8]), start: pos, end: end, data: data[pos+8 : pos+8+length]})
+		pos = end
+	}
+	return chunks
+}
+
+// exifEntry is one raw IFD entry.
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifReader reads IFDs from a TIFF-structured block.
+type exifReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// exifTypeSizes maps TIFF field types to the size of one value.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// ifd reads the entries of the IFD at off, skipping any that point outside the block.
+func (r *exifReader) ifd(off uint32) map[uint16]exifEntry {
+	entries := make(map[uint16]exifEntry)
+	if off == 0 || int(off)+2 > len(r.data) {
+		return entries
+	}
+	n := int(r.order.Uint16(r.data[off:]))
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + 12*i
+		if p+12 > len(r.data) {
+			break
+		}
+		tag, typ, count := r.order.Uint16(r.data[p:]), r.order.Uint16(r.data[p+2:]), r.order.Uint32(r.data[p+4:])
+		size, ok := exifTypeSizes[typ]
+		if !ok || count > 1<<20 {
+			continue
+		}
+		total := size * count
+		value := r.data[p+8 : p+12]
+		if total > 4 {
+			at := r.order.Uint32(r.data[p+8:])
+			if uint64(at)+uint64(total) > uint64(len(r.data)) {
+				continue
+			}
+			value = r.data[at : at+total]
+		}
+		entries[tag] = exifEntry{typ: typ, count: count, value: value[:min(int(total), len(value))]}
+	}
+	return entries
+}
+
+// str returns an ASCII value with trailing NULs and spaces removed.
+func (r *exifReader) str(e exifEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// uint returns the first value of a SHORT or LONG entry.
+func (r *exifReader) uint(e exifEntry) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(r.order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return r.order.Uint32(e.value)
+	}
+	return 0
+}
+
+// rationals returns the values of a RATIONAL entry.
+func (r *exifReader) rationals(e exifEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	var out []float64
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num, den := r.order.Uint32(e.value[i:]), r.order.Uint32(e.value[i+4:])
+		if den == 0 {
+			return nil
+		}
+		out = append(out, float64(num)/float64(den))
+	}
+	return out
+}
+
+// parseExif extracts camera details and location from a TIFF-structured EXIF block.
+func parseExif(tiff []byte) (*imageExif, *imageGPS) {
+	if len(tiff) < 8 {
+		return nil, nil
+	}
+	r := &exifReader{data: tiff}
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		r.order = binary.LittleEndian
+	case "MM\x00*":
+		r.order = binary.BigEndian
+	default:
+		return nil, nil
+	}
+	ifd0 := r.ifd(r.order.Uint32(tiff[4:]))
+	sub := r.ifd(r.uint(ifd0[0x8769]))
+
+	exif := &imageExif{
+		Camera:      strings.TrimSpace(r.str(ifd0[0x010F]) + " " + r.str(ifd0[0x0110])),
+		Software:    r.str(ifd0[0x0131]),
+		Taken:       r.str(sub[0x9003]),
+		Orientation: int(r.uint(ifd0[0x0112])),
+		Artist:      r.str(ifd0[0x013B]),
+		Lens:        r.str(sub[0xA434]),
+		SerialNo:    r.str(sub[0xA431]),
+	}
+	if exif.Taken == "" {
+		exif.Taken = r.str(ifd0[0x0132])
+	}
+	if *exif == (imageExif{}) {
+		exif = nil
+	}
+
+	var gps *imageGPS
+	if off := r.uint(ifd0[0x8825]); off != 0 {
+		g := r.ifd(off)
+		lat, lon := dmsToDegrees(r.rationals(g[2])), dmsToDegrees(r.rationals(g[4]))
+		if !math.IsNaN(lat) && !math.IsNaN(lon) {
+			if r.str(g[1]) == "S" {
+				lat = -lat
+			}
+			if r.str(g[3]) == "W" {
+				lon = -lon
+			}
+			gps = &imageGPS{Latitude: lat, Longitude: lon}
+			if alt := r.rationals(g[6]); len(alt) == 1 {
+				if ref := g[5].value; len(ref) > 0 && ref[0] == 1 {
+					alt[0] = -alt[0]
+				}
+				gps.Altitude = &alt[0]
+			}
+		}
+	}
+	return exif, gps
+}
+
+// dmsToDegrees converts degrees, minutes and seconds to decimal degrees, or NaN if malformed.
+func dmsToDegrees(dms []float64) float64 {
+	if len(dms) != 3 {
+		return math.NaN()
+	}
+	return dms[0] + dms[1]/60 + dms[2]/3600
+}
+
+var imageInfoSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"filePath": {
+			Type:        genai.TypeString,
+			Description: "The image to inspect (JPEG, PNG, GIF, WebP, BMP, TIFF or HEIC).",
+		},
+	},
+	Required: []string{"filePath"},
+}
+
+var ImageInfoTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "image_info",
+			Description: "Reads an image's format, dimensions, file size and EXIF metadata (camera, lens, date taken, GPS location) " +
+				"locally, without uploading it. Flags sensitive metadata such as location and says how the image is changed before upload.",
+			Parameters: imageInfoSchema,
+		},
+	},
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exifTag is one entry for buildTIFF. The value's type picks the TIFF field type: string is
+// ASCII, uint16 SHORT, uint32 LONG, [][2]uint32 RATIONAL and []byte BYTE.
+type exifTag struct {
+	tag   uint16
+	value interface{}
+}
+
+// buildTIFF returns a TIFF-structured EXIF block with IFD0 and, if given, the Exif and GPS
+// sub-IFDs.
+func buildTIFF(order binary.ByteOrder, ifd0, sub, gps []exifTag) []byte {
+	buf := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(buf, "II*\x00")
+	} else {
+		copy(buf, "MM\x00*")
+	}
+	if len(sub) > 0 {
+		ifd0 = append(ifd0, exifTag{0x8769, writeTestIFD(&buf, order, sub)})
+	}
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, exifTag{0x8825, writeTestIFD(&buf, order, gps)})
+	}
+	off := writeTestIFD(&buf, order, ifd0)
+	order.PutUint32(buf[4:], off)
+	return buf
+}
+
+// writeTestIFD appends an IFD and its out-of-line values to buf and returns its offset.
+func writeTestIFD(buf *[]byte, order binary.ByteOrder, tags []exifTag) uint32 {
+	start := len(*buf)
+	dataAt := start + 2 + 12*len(tags) + 4
+	ifd := make([]byte, dataAt-start)
+	order.PutUint16(ifd, uint16(len(tags)))
+	app := order.(binary.AppendByteOrder)
+	var data []byte
+	for i, t := range tags {
+		var typ uint16
+		var count int
+		var value []byte
+		switch v := t.value.(type) {
+		case string:
+			typ, value = 2, append([]byte(v), 0)
+			count = len(value)
+		case uint16:
+			typ, count, value = 3, 1, app.AppendUint16(nil, v)
+		case uint32:
+			typ, count, value = 4, 1, app.AppendUint32(nil, v)
+		case [][2]uint32:
+			typ, count = 5, len(v)
+			for _, r := range v {
+				value = app.AppendUint32(app.AppendUint32(value, r[0]), r[1])
+			}
+		case []byte:
+			typ, count, value = 1, len(v), v
+		}
+		e := ifd[2+12*i:]
+		order.PutUint16(e, t.tag)
+		order.PutUint16(e[2:], typ)
+		order.PutUint32(e[4:], uint32(count))
+		if len(value) <= 4 {
+			copy(e[8:12], value)
+		} else {
+			order.PutUint32(e[8:], uint32(dataAt+len(data)))
+			data = append(data, value...)
+		}
+	}
+	*buf = append(append(*buf, ifd...), data...)
+	return uint32(start)
+}
+
+// testExifTags returns IFD0, Exif and GPS entries for a photo taken at 48°51'29.6"N 2°17'40.2"E,
+// 35 m above sea level.
+func testExifTags() (ifd0, sub, gps []exifTag) {
+	ifd0 = []exifTag{
+		{0x010F, "Canon"},
+		{0x0110, "EOS R5"},
+		{0x0112, uint16(6)},
+		{0x0131, "Firmware 1.8"},
+		{0x013B, "Jane Doe"},
+	}
+	sub = []exifTag{
+		{0x9003, "2024:05:01 10:00:00"},
+		{0xA431, "012345678"},
+		{0xA434, "RF24-105mm F4 L IS USM"},
+	}
+	gps = []exifTag{
+		{1, "N"},
+		{2, [][2]uint32{{48, 1}, {51, 1}, {296, 10}}},
+		{3, "E"},
+		{4, [][2]uint32{{2, 1}, {17, 1}, {402, 10}}},
+		{5, []byte{0}},
+		{6, [][2]uint32{{35, 1}}},
+	}
+	return ifd0, sub, gps
+}
+
+func TestParseExif(t *testing.T) {
+	ifd0, sub, gps := testExifTags()
+	wantExif := &imageExif{
+		Camera:      "Canon EOS R5",
+		Lens:        "RF24-105mm F4 L IS USM",
+		Software:    "Firmware 1.8",
+		Taken:       "2024:05:01 10:00:00",
+		Orientation: 6,
+		Artist:      "Jane Doe",
+		SerialNo:    "012345678",
+	}
+	southWest := []exifTag{
+		{1, "S"},
+		{2, [][2]uint32{{33, 1}, {51, 1}, {3540, 100}}},
+		{3, "W"},
+		{4, [][2]uint32{{70, 1}, {40, 1}, {0, 1}}},
+		{5, []byte{1}},
+		{6, [][2]uint32{{10, 1}}},
+	}
+
+	tests := []struct {
+		name     string
+		tiff     []byte
+		exif     *imageExif
+		lat, lon float64
+		alt      float64
+		noGPS    bool
+	}{
+		{"little endian", buildTIFF(binary.LittleEndian, ifd0, sub, gps), wantExif, 48.858222, 2.2945, 35, false},
+		{"big endian", buildTIFF(binary.BigEndian, ifd0, sub, gps), wantExif, 48.858222, 2.2945, 35, false},
+		{"southern and western hemisphere, below sea level", buildTIFF(binary.LittleEndian, nil, nil, southWest), nil, -33.859833, -70.666667, -10, false},
+		{"date taken from IFD0", buildTIFF(binary.BigEndian, []exifTag{{0x0132, "2020:01:02 03:04:05"}}, nil, nil), &imageExif{Taken: "2020:01:02 03:04:05"}, 0, 0, 0, true},
+		{"malformed coordinates", buildTIFF(binary.LittleEndian, nil, nil, []exifTag{{1, "N"}, {2, [][2]uint32{{48, 0}, {51, 1}, {29, 1}}}, {4, [][2]uint32{{2, 1}}}}), nil, 0, 0, 0, true},
+		{"not TIFF", []byte("Exif\x00\x00II*\x00"), nil, 0, 0, 0, true},
+		{"too short", []byte("II*\x00"), nil, 0, 0, 0, true},
+		{"offset out of range", []byte("II*\x00\xff\xff\x00\x00"), nil, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exif, loc := parseExif(tt.tiff)
+			if (exif == nil) != (tt.exif == nil) || exif != nil && *exif != *tt.exif {
+				t.Errorf("exif = %+v, want %+v", exif, tt.exif)
+			}
+			if tt.noGPS {
+				if loc != nil {
+					t.Errorf("gps = %+v, want none", loc)
+				}
+				return
+			}
+			if loc == nil {
+				t.Fatal("no GPS location found")
+			}
+			if math.Abs(loc.Latitude-tt.lat) > 1e-5 || math.Abs(loc.Longitude-tt.lon) > 1e-5 {
+				t.Errorf("location = %v, %v, want %v, %v", loc.Latitude, loc.Longitude, tt.lat, tt.lon)
+			}
+			if loc.Altitude == nil || *loc.Altitude != tt.alt {
+				t.Errorf("altitude = %v, want %v", loc.Altitude, tt.alt)
+			}
+		})
+	}
+}
+
+// testImage returns a small opaque image with a gradient, so encoders don't collapse it.
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+// encodeTestJPEG encodes img and inserts segments (marker, payload) after the SOI marker.
+func encodeTestJPEG(t *testing.T, img image.Image, segments ...[]byte) (plain, withMeta []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	plain = buf.Bytes()
+	withMeta = append([]byte{}, plain[:2]...)
+	for _, s := range segments {
+		withMeta = append(withMeta, 0xFF, s[0])
+		withMeta = binary.BigEndian.AppendUint16(withMeta, uint16(len(s)-1+2))
+		withMeta = append(withMeta, s[1:]...)
+	}
+	return plain, append(withMeta, plain[2:]...)
+}
+
+// encodeTestPNG encodes img and inserts chunks (type, data) after the IHDR chunk.
+func encodeTestPNG(t *testing.T, img image.Image, chunks ...[2]string) (plain, withMeta []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	plain = buf.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(plain[8:]))
+	withMeta = append([]byte{}, plain[:ihdrEnd]...)
+	for _, c := range chunks {
+		withMeta = binary.BigEndian.AppendUint32(withMeta, uint32(len(c[1])))
+		body := []byte(c[0] + c[1])
+		withMeta = append(withMeta, body...)
+		withMeta = binary.BigEndian.AppendUint32(withMeta, crc32.ChecksumIEEE(body))
+	}
+	return plain, append(withMeta, plain[ihdrEnd:]...)
+}
+
+// app1Exif returns an APP1 segment for encodeTestJPEG holding tiff.
+func app1Exif(tiff []byte) []byte {
+	return append([]byte{0xE1}, append([]byte("Exif\x00\x00"), tiff...)...)
+}
+
+func TestImageInfo(t *testing.T) {
+	dir := t.TempDir()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	t.Setenv(ImagePrepEnv, "")
+
+	ifd0, sub, gps := testExifTags()
+	_, data := encodeTestJPEG(t, testImage(40, 20), app1Exif(buildTIFF(binary.LittleEndian, ifd0, sub, gps)))
+	path := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ImageInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "jpeg" || info.Width != 20 || info.Height != 40 {
+		t.Errorf("got %s %dx%d, want jpeg 20x40 (rotated by orientation 6)", info.Format, info.Width, info.Height)
+	}
+	if info.GPS == nil || len(info.Sensitive) != 3 {
+		t.Errorf("sensitive = %q, want serial number, author and GPS location", info.Sensitive)
+	}
+	if len(info.Upload) != 1 || info.Upload[0] != "EXIF metadata including the GPS location will be removed" {
+		t.Errorf("upload = %q, want the GPS location removed by default", info.Upload)
+	}
+}
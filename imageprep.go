@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// ImagePrepEnv selects what is done to images before they are sent for analysis: a
+// comma-separated list of "downscale", "strip", "location" and "convert", or "all" or "off".
+const ImagePrepEnv = "MYAPP_IMAGE_PREPROCESS"
+
+const (
+	// maxImageDimension is the longest side kept when downscaling; larger images gain nothing
+	// in analysis quality and cost bandwidth.
+	maxImageDimension = 3072
+	// maxImagePixels bounds the images preprocessImage decodes, since decoding allocates about
+	// four bytes per pixel whatever the size of the file.
+	maxImagePixels = 8192 * 8192
+	jpegQuality    = 90
+)
+
+// imagePrep is the set of preprocessing steps to apply.
+type imagePrep struct {
+	downscale bool
+	strip     bool
+	location  bool // strip the metadata of images that carry a GPS location
+	convert   bool
+}
+
+// geminiImageTypes are the image formats the API accepts as they are.
+var geminiImageTypes = map[string]bool{"jpeg": true, "png": true, "webp": true, "heic": true, "heif": true}
+
+// imagePrepSteps reads ImagePrepEnv. By default formats the API can't read are converted and
+// images that record where they were taken have their metadata removed.
+func imagePrepSteps() imagePrep {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(ImagePrepEnv)))
+	switch v {
+	case "":
+		return imagePrep{location: true, convert: true}
+	case "all":
+		return imagePrep{downscale: true, strip: true, location: true, convert: true}
+	case "off", "none":
+		return imagePrep{}
+	}
+	var p imagePrep
+	for _, step := range strings.Split(v, ",") {
+		switch strings.TrimSpace(step) {
+		case "downscale":
+			p.downscale = true
+		case "strip":
+			p.strip = true
+		case "location":
+			p.location = true
+		case "convert":
+			p.convert = true
+		default:
+			log.Printf("Warning: ignoring unknown %s step %q\n", ImagePrepEnv, step)
+		}
+	}
+	return p
+}
+
+// plannedImagePrep describes what preprocessing will do to the image before upload, and
+// mentions the steps that are switched off but would apply.
+func plannedImagePrep(info *imageInfo, steps imagePrep) []string {
+	var notes []string
+	if !geminiImageTypes[info.Format] {
+		if steps.convert {
+			notes = append(notes, fmt.Sprintf("will be converted from %s to PNG", strings.ToUpper(info.Format)))
+		} else {
+			notes = append(notes, fmt.Sprintf("%s is not accepted by the API; add \"convert\" to %s to convert it", strings.ToUpper(info.Format), ImagePrepEnv))
+		}
+	}
+	if max(info.Width, info.Height) > maxImageDimension {
+		w, h := fitWithin(info.Width, info.Height, maxImageDimension)
+		if steps.downscale {
+			notes = append(notes, fmt.Sprintf("will be downscaled to %dx%d", w, h))
+		} else {
+			notes = append(notes, fmt.Sprintf("larger than %dpx; add \"downscale\" to %s to send it at %dx%d", maxImageDimension, ImagePrepEnv, w, h))
+		}
+	}
+	switch {
+	case info.GPS != nil && !canStripImage(info.Format):
+		notes = append(notes, fmt.Sprintf("WARNING: the GPS location can't be removed from %s images and is uploaded with the image", strings.ToUpper(info.Format)))
+	case info.GPS != nil && (steps.strip || steps.location):
+		notes = append(notes, "EXIF metadata including the GPS location will be removed")
+	case info.GPS != nil:
+		notes = append(notes, fmt.Sprintf("WARNING: the GPS location is uploaded with the image; add \"location\" or \"strip\" to %s to remove it", ImagePrepEnv))
+	case info.Exif != nil && steps.strip:
+		notes = append(notes, "EXIF metadata will be removed")
+	case info.Exif != nil:
+		notes = append(notes, fmt.Sprintf("EXIF metadata is uploaded as is; add \"strip\" to %s to remove it", ImagePrepEnv))
+	}
+	return notes
+}
+
+// preparedImage is an image rewritten by preprocessImage.
+type preparedImage struct {
+	Data     []byte
+	MIMEType string
+	Ext      string
+	Notes    []string
+}
+
+// preprocessImage applies steps to the image at path. It returns nil if nothing needs to
+// change, including for formats it can't decode such as HEIC. Metadata is stripped without
+// re-encoding where possible; otherwise the image is decoded, turned upright according to its
+// EXIF orientation, scaled and encoded as JPEG (for photos) or PNG.
+func preprocessImage(path string, steps imagePrep) (*preparedImage, error) {
+	if steps == (imagePrep{}) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if steps.strip || steps.location {
+			format = strings.TrimPrefix(detectMIME(path, data[:min(len(data), sniffLen)]), "image/")
+			if tiff := findExif(data, format); tiff != nil {
+				if _, gps := parseExif(tiff); gps != nil {
+					log.Printf("Warning: %s records where it was taken, and the location can't be removed from %s images before upload\n", filepath.Base(path), strings.ToUpper(format))
+				}
+			}
+		}
+		return nil, nil
+	}
+	var exif *imageExif
+	var gps *imageGPS
+	if tiff := findExif(data, format); tiff != nil {
+		exif, gps = parseExif(tiff)
+	}
+
+	convert := steps.convert && !geminiImageTypes[format]
+	downscale := steps.downscale && max(cfg.Width, cfg.Height) > maxImageDimension
+	strip := (steps.strip && (exif != nil || gps != nil || hasTextMetadata(data, format))) || (steps.location && gps != nil)
+	if !convert && !downscale && !strip {
+		return nil, nil
+	}
+	var notes []string
+	if strip {
+		note := "removed metadata"
+		if gps != nil {
+			note += " including GPS location"
+		}
+		notes = append(notes, note)
+	}
+
+	orientation := 1
+	if exif != nil && exif.Orientation > 1 && exif.Orientation <= 8 {
+		orientation = exif.Orientation
+	}
+	if !convert && !downscale && orientation == 1 {
+		switch format {
+		case "jpeg":
+			return &preparedImage{Data: stripJPEG(data), MIMEType: "image/jpeg", Ext: ".jpg", Notes: notes}, nil
+		case "png":
+			return &preparedImage{Data: stripPNG(data), MIMEType: "image/png", Ext: ".png", Notes: notes}, nil
+		}
+	}
+
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		if strip {
+			return nil, fmt.Errorf("%s is too large to remove its metadata (%dx%d pixels, limit %d)", filepath.Base(path), cfg.Width, cfg.Height, maxImagePixels)
+		}
+		log.Printf("Warning: %s is too large to preprocess (%dx%d pixels); uploading it unchanged\n", filepath.Base(path), cfg.Width, cfg.Height)
+		return nil, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s image: %v", format, err)
+	}
+	// Re-encoding drops EXIF, so apply its orientation to the pixels instead.
+	img = orientImage(img, orientation)
+	if downscale {
+		b := img.Bounds()
+		w, h := fitWithin(b.Dx(), b.Dy(), maxImageDimension)
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+		img = dst
+		notes = append(notes, fmt.Sprintf("downscaled from %dx%d to %dx%d", b.Dx(), b.Dy(), w, h))
+	}
+
+	var buf bytes.Buffer
+	prepared := &preparedImage{Notes: notes}
+	opaque, _ := img.(interface{ Opaque() bool })
+	if (format == "jpeg" || format == "webp") && (opaque == nil || opaque.Opaque()) {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		prepared.MIMEType, prepared.Ext = "image/jpeg", ".jpg"
+	} else {
+		err = png.Encode(&buf, img)
+		prepared.MIMEType, prepared.Ext = "image/png", ".png"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	if convert {
+		prepared.Notes = append(prepared.Notes, fmt.Sprintf("converted from %s to %s", strings.ToUpper(format), strings.ToUpper(strings.TrimPrefix(prepared.Ext, "."))))
+	}
+	prepared.Data = buf.Bytes()
+	return prepared, nil
+}
+
+// canStripImage reports whether preprocessImage can remove metadata from images in format,
+// as named by image.DecodeConfig.
+func canStripImage(format string) bool {
+	switch format {
+	case "jpeg", "png", "gif", "bmp", "tiff", "webp":
+		return true
+	}
+	return false
+}
+
+// fitWithin scales width and height down to fit in a square of side limit, keeping the aspect ratio.
+func fitWithin(width, height, limit int) (int, int) {
+	if width <= limit && height <= limit {
+		return width, height
+	}
+	if width >= height {
+		return limit, max(1, height*limit/width)
+	}
+	return max(1, width*limit/height), limit
+}
+
+// hasTextMetadata reports whether an image carries XMP, IPTC or text comments that strip removes.
+func hasTextMetadata(data []byte, format string) bool {
+	switch format {
+	case "jpeg":
+		return len(stripJPEG(data)) != len(data)
+	case "png":
+		return len(stripPNG(data)) != len(data)
+	}
+	return false
+}
+
+// stripJPEG removes the EXIF, XMP and IPTC segments and comments from a JPEG without
+// re-encoding it.
+func stripJPEG(data []byte) []byte {
+	var out bytes.Buffer
+	last := 2
+	out.Write(data[:2])
+	for _, seg := range jpegSegments(data) {
+		out.Write(data[last:seg.start])
+		last = seg.end
+		if seg.marker == 0xE1 || seg.marker == 0xED || seg.marker == 0xFE {
+			continue
+		}
+		out.Write(data[seg.start:seg.end])
+	}
+	out.Write(data[last:])
+	return out.Bytes()
+}
+
+// stripPNG removes the eXIf and text chunks from a PNG without re-encoding it.
+func stripPNG(data []byte) []byte {
+	var out bytes.Buffer
+	last := 8
+	out.Write(data[:8])
+	for _, c := range pngChunks(data) {
+		out.Write(data[last:c.start])
+		last = c.end
+		switch c.kind {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+			continue
+		}
+		out.Write(data[c.start:c.end])
+	}
+	out.Write(data[last:])
+	return out.Bytes()
+}
+
+// orientImage returns img turned upright according to an EXIF orientation value (1-8).
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the main diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the anti-diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// preparedImagePath writes a preprocessed image to a temporary directory under the original
+// file's name, so it can be uploaded like any other file. The caller removes the directory.
+func preparedImagePath(original string, p *preparedImage) (string, string, error) {
+	dir, err := os.MkdirTemp("", "myapp-image-")
+	if err != nil {
+		return "", "", err
+	}
+	base := strings.TrimSuffix(filepath.Base(original), filepath.Ext(original)) + p.Ext
+	path := filepath.Join(dir, base)
+	if err := os.WriteFile(path, p.Data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return path, dir, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripJPEG(t *testing.T) {
+	ifd0, sub, gps := testExifTags()
+	exif := app1Exif(buildTIFF(binary.BigEndian, ifd0, sub, gps))
+	xmp := append([]byte{0xE1}, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"...)
+	iptc := append([]byte{0xED}, "Photoshop 3.0\x00"...)
+	comment := append([]byte{0xFE}, "taken at home"...)
+	icc := append([]byte{0xE2}, "ICC_PROFILE\x00"...)
+
+	plain, _ := encodeTestJPEG(t, testImage(16, 16))
+	tests := []struct {
+		name     string
+		segments [][]byte
+		keep     [][]byte // segments that must survive
+	}{
+		{"exif", [][]byte{exif}, nil},
+		{"xmp, iptc and comment", [][]byte{xmp, iptc, comment}, nil},
+		{"colour profile is kept", [][]byte{exif, icc, comment}, [][]byte{icc}},
+		{"nothing to strip", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, data := encodeTestJPEG(t, testImage(16, 16), tt.segments...)
+			_, want := encodeTestJPEG(t, testImage(16, 16), tt.keep...)
+			got := stripJPEG(data)
+			if !bytes.Equal(got, want) {
+				t.Errorf("stripped JPEG differs from the original without metadata (%d bytes, want %d)", len(got), len(want))
+			}
+			if findExif(got, "jpeg") != nil {
+				t.Error("EXIF still present")
+			}
+			if _, err := decodeTestImage(got); err != nil {
+				t.Errorf("stripped JPEG doesn't decode: %v", err)
+			}
+			if hasTextMetadata(data, "jpeg") != (len(tt.segments) > len(tt.keep)) {
+				t.Errorf("hasTextMetadata = %v", !(len(tt.segments) > len(tt.keep)))
+			}
+		})
+	}
+	if !bytes.Equal(stripJPEG(plain), plain) {
+		t.Error("stripping a JPEG without metadata changed it")
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	ifd0, sub, gps := testExifTags()
+	tests := []struct {
+		name   string
+		chunks [][2]string
+	}{
+		{"exif", [][2]string{{"eXIf", string(buildTIFF(binary.LittleEndian, ifd0, sub, gps))}}},
+		{"text chunks", [][2]string{{"tEXt", "Author\x00Jane Doe"}, {"iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"}, {"zTXt", "Comment\x00\x00x\x9c"}}},
+		{"nothing to strip", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, data := encodeTestPNG(t, testImage(16, 16), tt.chunks...)
+			got := stripPNG(data)
+			if !bytes.Equal(got, plain) {
+				t.Errorf("stripped PNG differs from the original without metadata (%d bytes, want %d)", len(got), len(plain))
+			}
+			if findExif(got, "png") != nil {
+				t.Error("EXIF still present")
+			}
+			if _, err := decodeTestImage(got); err != nil {
+				t.Errorf("stripped PNG doesn't decode: %v", err)
+			}
+		})
+	}
+}
+
+func decodeTestImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+func TestImagePrepSteps(t *testing.T) {
+	tests := map[string]imagePrep{
+		"":                   {location: true, convert: true},
+		"all":                {downscale: true, strip: true, location: true, convert: true},
+		"off":                {},
+		"none":               {},
+		"Downscale, strip":   {downscale: true, strip: true},
+		"convert,bogus":      {convert: true},
+		"location":           {location: true},
+		" strip , convert  ": {strip: true, convert: true},
+	}
+	for v, want := range tests {
+		t.Setenv(ImagePrepEnv, v)
+		if got := imagePrepSteps(); got != want {
+			t.Errorf("%s=%q: got %+v, want %+v", ImagePrepEnv, v, got, want)
+		}
+	}
+}
+
+func TestPreprocessImageLocation(t *testing.T) {
+	dir := t.TempDir()
+	ifd0, sub, gps := testExifTags()
+	_, withGPS := encodeTestJPEG(t, testImage(32, 16), app1Exif(buildTIFF(binary.LittleEndian, ifd0, sub, gps)))
+	_, withoutGPS := encodeTestJPEG(t, testImage(32, 16), app1Exif(buildTIFF(binary.LittleEndian, ifd0, sub, nil)))
+	_, pngGPS := encodeTestPNG(t, testImage(32, 16), [2]string{"eXIf", string(buildTIFF(binary.BigEndian, nil, nil, gps))})
+
+	tests := []struct {
+		name   string
+		file   string
+		data   []byte
+		steps  imagePrep
+		change bool
+		width  int // after applying the EXIF orientation
+	}{
+		{"default strips a photo with a location", "gps.jpg", withGPS, imagePrep{location: true, convert: true}, true, 16},
+		{"default keeps other EXIF", "exif.jpg", withoutGPS, imagePrep{location: true, convert: true}, false, 0},
+		{"default strips a PNG with a location", "gps.png", pngGPS, imagePrep{location: true, convert: true}, true, 32},
+		{"strip removes all EXIF", "exif.jpg", withoutGPS, imagePrep{strip: true}, true, 16},
+		{"off keeps the location", "gps.jpg", withGPS, imagePrep{}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			prepared, err := preprocessImage(path, tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (prepared != nil) != tt.change {
+				t.Fatalf("prepared = %v, want a change: %v", prepared != nil, tt.change)
+			}
+			if prepared == nil {
+				return
+			}
+			format := strings.TrimPrefix(prepared.MIMEType, "image/")
+			if tiff := findExif(prepared.Data, format); tiff != nil {
+				if _, loc := parseExif(tiff); loc != nil {
+					t.Error("GPS location still present")
+				}
+				t.Error("EXIF still present")
+			}
+			if len(prepared.Notes) == 0 || !strings.HasPrefix(prepared.Notes[0], "removed metadata") {
+				t.Errorf("notes = %q, want the metadata removal reported", prepared.Notes)
+			}
+			img, err := decodeTestImage(prepared.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.width {
+				t.Errorf("width = %d, want %d", img.Bounds().Dx(), tt.width)
+			}
+		})
+	}
+}
+
+// withPNGSize rewrites the dimensions in a PNG's header, leaving the pixel data as it is.
+func withPNGSize(data []byte, width, height uint32) []byte {
+	out := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(out[16:], width)
+	binary.BigEndian.PutUint32(out[20:], height)
+	binary.BigEndian.PutUint32(out[29:], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+func TestPreprocessImagePixelLimit(t *testing.T) {
+	dir := t.TempDir()
+	_, _, gps := testExifTags()
+	plain, withGPS := encodeTestPNG(t, testImage(32, 16), [2]string{"eXIf", string(buildTIFF(binary.BigEndian, nil, nil, gps))})
+
+	tests := []struct {
+		name  string
+		data  []byte
+		steps imagePrep
+		err   string
+	}{
+		{"uploaded unchanged", withPNGSize(plain, 20000, 20000), imagePrep{downscale: true}, ""},
+		{"metadata can't be removed", withPNGSize(withGPS, 20000, 20000), imagePrep{downscale: true, location: true}, "too large to remove its metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "huge.png")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			// The declared size is far beyond the pixel data, so reaching image.Decode would fail.
+			prepared, err := preprocessImage(path, tt.steps)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || prepared != nil {
+				t.Errorf("got %v, %v; want the image left unchanged", prepared, err)
+			}
+		})
+	}
+}
+
+func TestPlannedImagePrep(t *testing.T) {
+	loc := &imageGPS{Latitude: 1, Longitude: 2}
+	tests := []struct {
+		name  string
+		info  imageInfo
+		steps imagePrep
+		want  []string
+	}{
+		{"location removed by default", imageInfo{Format: "jpeg", GPS: loc}, imagePrep{location: true, convert: true},
+			[]string{"EXIF metadata including the GPS location will be removed"}},
+		{"location kept", imageInfo{Format: "jpeg", GPS: loc}, imagePrep{convert: true},
+			[]string{"WARNING: the GPS location is uploaded with the image; add \"location\" or \"strip\" to " + ImagePrepEnv + " to remove it"}},
+		{"heic can't be stripped", imageInfo{Format: "heic", GPS: loc}, imagePrep{strip: true},
+			[]string{"WARNING: the GPS location can't be removed from HEIC images and is uploaded with the image"}},
+		{"exif without location", imageInfo{Format: "png", Exif: &imageExif{Camera: "X"}}, imagePrep{location: true},
+			[]string{"EXIF metadata is uploaded as is; add \"strip\" to " + ImagePrepEnv + " to remove it"}},
+		{"conversion and downscaling", imageInfo{Format: "bmp", Width: 6144, Height: 4096}, imagePrep{downscale: true, convert: true},
+			[]string{"will be converted from BMP to PNG", "will be downscaled to 3072x2048"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plannedImagePrep(&tt.info, tt.steps)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileChange records one assistant-initiated write so it can be reverted.
+type fileChange struct {
+	Path    string
+	Tool    string
+	Existed bool
+	Before  []byte
+	After   []byte
+	Time    time.Time
+}
+
+// changeJournal holds every file change made by tools during the current session.
+type changeJournal struct {
+	mu      sync.Mutex
+	changes []fileChange
+}
+
+var journal = &changeJournal{}
+
+// recordedWrite atomically writes data to path and records the previous contents in the journal.
+func recordedWrite(path string, data []byte, perm os.FileMode, tool string) error {
+	before, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read existing file '%s': %v", path, err)
+	}
+	if existed {
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+
+	if err := writeFileAtomic(path, data, perm); err != nil {
+		return err
+	}
+	journal.record(path, tool, existed, before, data)
+	return nil
+}
+
+// record adds a change that was written by other means, such as a file built up incrementally.
+func (j *changeJournal) record(path, tool string, existed bool, before, after []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.changes = append(j.changes, fileChange{
+		Path:    path,
+		Tool:    tool,
+		Existed: existed,
+		Before:  before,
+		After:   append([]byte(nil), after...),
+		Time:    time.Now(),
+	})
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and renames it over path,
+// so a crash never leaves a half-written file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in '%s': %v", dir, err)
+	}
+	tmpName := tmp.Name()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to write file at '%s': %v", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to sync file at '%s': %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to close file at '%s': %v", path, err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to set permissions on '%s': %v", path, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to replace file at '%s': %v", path, err)
+	}
+	return nil
+}
+
+// Undo reverts the most recent change in the journal. Unless force is set, it refuses if the
+// file was modified after the change was made, so later edits aren't lost.
+func (j *changeJournal) Undo(force bool) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.changes) == 0 {
+		return "", fmt.Errorf("nothing to undo")
+	}
+	c := j.changes[len(j.changes)-1]
+	msg, err := revertChange(c, force)
+	if err != nil {
+		return "", err
+	}
+	j.changes = j.changes[:len(j.changes)-1]
+	return msg, nil
+}
+
+// UndoAll reverts every change in the journal, newest first. It stops at the first change
+// that can't be reverted, leaving it and every older change in the journal.
+func (j *changeJournal) UndoAll(force bool) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.changes) == 0 {
+		return "", fmt.Errorf("nothing to undo")
+	}
+	var out strings.Builder
+	for len(j.changes) > 0 {
+		c := j.changes[len(j.changes)-1]
+		msg, err := revertChange(c, force)
+		if err != nil {
+			return strings.TrimSuffix(out.String(), "\n"), err
+		}
+		out.WriteString(msg + "\n")
+		j.changes = j.changes[:len(j.changes)-1]
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// revertChange restores the contents a file had before c, deleting it if c created it. It
+// refuses if the file no longer holds what c wrote, unless force is set.
+func revertChange(c fileChange, force bool) (string, error) {
+	var note string
+	if current, err := os.ReadFile(c.Path); err == nil && !bytes.Equal(current, c.After) {
+		if !force {
+			return "", fmt.Errorf("%s was modified after %s changed it; use /undo force to discard those modifications", c.Path, c.Tool)
+		}
+		note = " (discarding later modifications)"
+	}
+
+	if !c.Existed {
+		if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to remove '%s': %v", c.Path, err)
+		}
+		return fmt.Sprintf("removed %s (created by %s)%s", c.Path, c.Tool, note), nil
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(c.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := writeFileAtomic(c.Path, c.Before, perm); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("restored %s to its state before %s%s", c.Path, c.Tool, note), nil
+}
+
+// Summary lists every file touched this session with a diffstat against its original contents.
+func (j *changeJournal) Summary() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.changes) == 0 {
+		return "No files have been changed this session."
+	}
+
+	type fileSummary struct {
+		first, last fileChange
+		count       int
+	}
+	var order []string
+	files := make(map[string]*fileSummary)
+	for _, c := range j.changes {
+		s, ok := files[c.Path]
+		if !ok {
+			s = &fileSummary{first: c}
+			files[c.Path] = s
+			order = append(order, c.Path)
+		}
+		s.last = c
+		s.count++
+	}
+
+	var out strings.Builder
+	for _, path := range order {
+		s := files[path]
+		added, removed := diffStat(string(s.first.Before), string(s.last.After))
+		status := "modified"
+		if !s.first.Existed {
+			status = "created"
+		}
+		out.WriteString(fmt.Sprintf("%-8s %s  +%d -%d  (%d change(s))\n", status, path, added, removed, s.count))
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// diffStat counts added and removed lines between a and b using a longest common
+// subsequence. Very large inputs fall back to comparing line counts per distinct line.
+func diffStat(a, b string) (added, removed int) {
+	al := splitLines(a)
+	bl := splitLines(b)
+
+	// Trim the common prefix and suffix; most edits are local.
+	for len(al) > 0 && len(bl) > 0 && al[0] == bl[0] {
+		al, bl = al[1:], bl[1:]
+	}
+	for len(al) > 0 && len(bl) > 0 && al[len(al)-1] == bl[len(bl)-1] {
+		al, bl = al[:len(al)-1], bl[:len(bl)-1]
+	}
+
+	if len(al)*len(bl) > 4_000_000 {
+		counts := make(map[string]int)
+		for _, l := range al {
+			counts[l]++
+		}
+		for _, l := range bl {
+			if counts[l] > 0 {
+				counts[l]--
+			} else {
+				added++
+			}
+		}
+		for _, n := range counts {
+			removed += n
+		}
+		return added, removed
+	}
+
+	prev := make([]int, len(bl)+1)
+	cur := make([]int, len(bl)+1)
+	for i := 1; i <= len(al); i++ {
+		for k := 1; k <= len(bl); k++ {
+			if al[i-1] == bl[k-1] {
+				cur[k] = prev[k-1] + 1
+			} else {
+				cur[k] = max(prev[k], cur[k-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	common := prev[len(bl)]
+	return len(bl) - common, len(al) - common
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestJournal replaces the session journal with an empty one for the test.
+func newTestJournal(t *testing.T) *changeJournal {
+	t.Helper()
+	old := journal
+	journal = &changeJournal{}
+	t.Cleanup(func() { journal = old })
+	return journal
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRevertChange(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		change  fileChange
+		current string // file contents before reverting; "" means the file doesn't exist
+		force   bool
+		want    string // file contents afterwards; "" means the file is gone
+		msg     string
+		err     string
+	}{
+		{
+			name:    "existing file is restored",
+			change:  fileChange{Tool: "file_edit", Existed: true, Before: []byte("old\n"), After: []byte("new\n")},
+			current: "new\n",
+			want:    "old\n",
+			msg:     "to its state before file_edit",
+		},
+		{
+			name:    "created file is removed",
+			change:  fileChange{Tool: "file_write", After: []byte("new\n")},
+			current: "new\n",
+			msg:     "(created by file_write)",
+		},
+		{
+			name:   "created file that is already gone",
+			change: fileChange{Tool: "file_write", After: []byte("new\n")},
+			msg:    "(created by file_write)",
+		},
+		{
+			name:   "deleted file is restored",
+			change: fileChange{Tool: "file_edit", Existed: true, Before: []byte("old\n"), After: []byte("new\n")},
+			want:   "old\n",
+		},
+		{
+			name:    "later modifications are kept",
+			change:  fileChange{Tool: "file_edit", Existed: true, Before: []byte("old\n"), After: []byte("new\n")},
+			current: "new\nuser edit\n",
+			want:    "new\nuser edit\n",
+			err:     "was modified after file_edit changed it",
+		},
+		{
+			name:    "a modified created file is kept",
+			change:  fileChange{Tool: "file_write", After: []byte("new\n")},
+			current: "user edit\n",
+			want:    "user edit\n",
+			err:     "was modified after file_write changed it",
+		},
+		{
+			name:    "force discards later modifications",
+			change:  fileChange{Tool: "file_edit", Existed: true, Before: []byte("old\n"), After: []byte("new\n")},
+			current: "new\nuser edit\n",
+			force:   true,
+			want:    "old\n",
+			msg:     "(discarding later modifications)",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("f", i+1))
+			if tt.current != "" {
+				if err := os.WriteFile(path, []byte(tt.current), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.change.Path = path
+			msg, err := revertChange(tt.change, tt.force)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !strings.Contains(msg, tt.msg) {
+				t.Errorf("message %q lacks %q", msg, tt.msg)
+			}
+
+			data, err := os.ReadFile(path)
+			switch {
+			case tt.want == "" && !os.IsNotExist(err):
+				t.Errorf("file still exists (%q, %v)", data, err)
+			case tt.want != "" && string(data) != tt.want:
+				t.Errorf("file holds %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	j := newTestJournal(t)
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("v0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range []struct{ path, data string }{{a, "v1\n"}, {b, "created\n"}, {a, "v2\n"}} {
+		if err := recordedWrite(w.path, []byte(w.data), 0644, "file_write"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, _ := os.Stat(a); info.Mode().Perm() != 0600 {
+		t.Errorf("rewriting a.txt changed its mode to %v", info.Mode().Perm())
+	}
+	if s := j.Summary(); !strings.Contains(s, "modified "+a+"  +1 -1  (2 change(s))") || !strings.Contains(s, "created  "+b+"  +1 -0  (1 change(s))") {
+		t.Errorf("summary:\n%s", s)
+	}
+
+	if _, err := j.Undo(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, a); got != "v1\n" {
+		t.Errorf("after one undo a.txt holds %q, want v1", got)
+	}
+
+	// A modification after the assistant's change stops /undo all there.
+	if err := os.WriteFile(b, []byte("edited by the user\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := j.UndoAll(false)
+	if err == nil || msg != "" {
+		t.Fatalf("UndoAll over a modified file = %q, %v; want an error", msg, err)
+	}
+	if got := readTestFile(t, b); got != "edited by the user\n" {
+		t.Errorf("b.txt holds %q, want the user's edit kept", got)
+	}
+	if len(j.changes) != 2 {
+		t.Errorf("%d changes left in the journal, want 2", len(j.changes))
+	}
+
+	msg, err = j.UndoAll(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(msg, "\n") != 1 {
+		t.Errorf("UndoAll reported %q, want two lines", msg)
+	}
+	if got := readTestFile(t, a); got != "v0\n" {
+		t.Errorf("a.txt holds %q, want v0", got)
+	}
+	if _, err := os.Stat(b); !os.IsNotExist(err) {
+		t.Errorf("b.txt still exists: %v", err)
+	}
+	if _, err := j.Undo(false); err == nil || err.Error() != "nothing to undo" {
+		t.Errorf("Undo on an empty journal = %v", err)
+	}
+}
+
+func TestDiffStat(t *testing.T) {
+	big := strings.Repeat("line\n", 3000)
+	tests := []struct {
+		name           string
+		a, b           string
+		added, removed int
+	}{
+		{"identical", "a\nb\n", "a\nb\n", 0, 0},
+		{"created", "", "a\nb\n", 2, 0},
+		{"emptied", "a\nb\n", "", 0, 2},
+		{"one line changed", "a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"insertion in the middle", "a\nc\n", "a\nb\nc\n", 1, 0},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", 1, 1},
+		{"missing final newline", "a\nb", "a\nb\n", 0, 0},
+		{"large inputs fall back to counting", big + "x\n" + big, "y\n" + big + big + "z\n", 2, 1},
+	}
+	for _, tt := range tests {
+		added, removed := diffStat(tt.a, tt.b)
+		if added != tt.added || removed != tt.removed {
+			t.Errorf("%s: got +%d -%d, want +%d -%d", tt.name, added, removed, tt.added, tt.removed)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads REPL input. On a terminal it handles editing keys itself so that Tab can
+// complete @-mentions; otherwise (pipes, unsupported platforms) it reads plain lines.
+type lineEditor struct {
+	reader *bufio.Reader
+	// complete returns the line with its last word completed, and the candidates to show
+	// when the completion is ambiguous.
+	complete func(line string) (string, []string)
+}
+
+// ReadLine returns the next line of input without its line ending.
+func (e *lineEditor) ReadLine() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if isTerminal(fd) {
+		if restore, err := makeRaw(fd); err == nil {
+			defer restore()
+			return e.readRaw()
+		}
+	}
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readRaw edits a line at the end of the buffer: printable keys insert, Backspace, Ctrl-U and
+// Ctrl-W delete, Tab completes, and other control keys and escape sequences are ignored.
+func (e *lineEditor) readRaw() (string, error) {
+	var line []rune
+	redraw := func() { fmt.Print("\r\033[K" + string(line)) }
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case r == '\r' || r == '\n':
+			fmt.Print("\r\n")
+			return string(line), nil
+		case r == 3: // Ctrl-C
+			fmt.Print("^C\r\n")
+			return "", errInterrupted
+		case r == 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Print("\r\n")
+				return "", io.EOF
+			}
+		case r == 127 || r == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				redraw()
+			}
+		case r == 21: // Ctrl-U
+			line = line[:0]
+			redraw()
+		case r == 23: // Ctrl-W
+			end := len(line)
+			for end > 0 && unicode.IsSpace(line[end-1]) {
+				end--
+			}
+			for end > 0 && !unicode.IsSpace(line[end-1]) {
+				end--
+			}
+			line = line[:end]
+			redraw()
+		case r == '\t':
+			if e.complete == nil {
+				continue
+			}
+			completed, candidates := e.complete(string(line))
+			if len(candidates) > 1 {
+				fmt.Print("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+			}
+			line = []rune(completed)
+			redraw()
+		case r == 27: // escape sequences such as arrow keys
+			e.skipEscape()
+		case r < 32:
+		default:
+			line = append(line, r)
+			fmt.Print(string(r))
+		}
+	}
+}
+
+// skipEscape consumes the rest of an ANSI escape sequence.
+func (e *lineEditor) skipEscape() {
+	b, err := e.reader.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	for {
+		b, err := e.reader.ReadByte()
+		if err != nil || (b >= 0x40 && b <= 0x7E) {
+			return
+		}
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/google/generative-ai-go/genai"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 )
 
 const GenaiModel = "gemini-2.0-flash" // model to use
+const MediaModel = "gemini-1.5-pro"   // model used to analyse and transcribe media files
 const EnvFilePath = ".myapp_env"
 
 type App struct {
@@ -40,32 +44,82 @@ func main() {
 		log.Fatalf("Error creating client")
 	}
 
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting working directory: %v", err)
+	}
+	checkpoints = newCheckpointStore(cwd)
+	workspace = newWorkspaceAccess(cwd)
+	uploads = newUploadCache()
+	uploads.Prune()
+
 	genaiApp.model = NewModel(genaiApp.client, GenaiModel)
-	genaiApp.model.Tools = []*genai.Tool{FileTool, ReadFileTool, RunCommandTool, SystemInfoTool, FileContentTool}
+	genaiApp.model.Tools = []*genai.Tool{FileTool, FileEditTool, OpenFileTool, ReadFileTool, ScanTool, SearchFilesTool, FindFilesTool, GoCodeTool, RepoMapTool, SemanticSearchTool, DocQueryTool, BatchAnalyzeTool, ImageInfoTool, FetchURLTool, RunCommandTool, SystemInfoTool, FileContentTool,
+		GitReadTool, GitWriteTool}
 	genaiApp.cs = genaiApp.model.StartChat()
 	// Send the system prompt as the initial system message.
-	response, err := genaiApp.cs.SendMessage(context.Background(), genai.Text(SystemPrompt))
+	systemPrompt := SystemPrompt
+	if repoMapEnabled() {
+		repoMap, err := repoMaps.Build(cwd, defaultRepoMapTokens)
+		if err != nil {
+			log.Printf("Warning: failed to build repository map: %v\n", err)
+		} else {
+			systemPrompt += "\n\n### **Repository Map**\nThe current working directory contains these source files and top-level symbols:\n\n" + repoMap
+		}
+	}
+	response, err := genaiApp.cs.SendMessage(context.Background(), genai.Text(systemPrompt))
 	if err != nil {
 		log.Fatalf("Error sending system prompt: %v", err)
 	}
-	responseString := buildResponse(response, genaiApp.cs)
+	responseString := buildResponse(context.Background(), response, genaiApp.cs)
 
 	log.Println("Response:", responseString)
 
 	//// Main loop: read user input and interact.
 	//reader := bufio.NewReader(os.Stdin)
 
+	lines := &lineEditor{reader: reader, complete: completeMention}
 	for {
-		input, _ := reader.ReadString('\n')
-		input = input[:len(input)-1]
+		input, err := lines.ReadLine()
+		if err != nil {
+			return
+		}
 
-		response, err := genaiApp.cs.SendMessage(context.Background(), genai.Text(input))
+		if handleSlashCommand(input) {
+			continue
+		}
+		checkpoints.BeginTurn(input)
+
+		// Ctrl-C cancels the current turn (including long media uploads) instead of exiting.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		// "@path" mentions attach files, directory listings and media to the message.
+		parts, warnings := expandMentions(ctx, genaiApp.client, input)
+		for _, w := range warnings {
+			log.Println("Warning:", w)
+		}
+		// SendMessage keeps messages in the history even when they fail, so a cancelled turn is
+		// removed up to here; otherwise the next message follows an unanswered turn or a
+		// function call without its response.
+		historyLen := len(genaiApp.cs.History)
+		response, err := genaiApp.cs.SendMessage(ctx, parts...)
 		if err != nil {
+			stop()
+			if ctx.Err() != nil {
+				genaiApp.cs.History = genaiApp.cs.History[:historyLen]
+				log.Println("Cancelled.")
+				continue
+			}
 			log.Println("Error sending message:", err)
 			return
 		}
 
-		responseString := buildResponse(response, genaiApp.cs)
+		responseString := buildResponse(ctx, response, genaiApp.cs)
+		stop()
+		if ctx.Err() != nil {
+			genaiApp.cs.History = genaiApp.cs.History[:historyLen]
+			log.Println("Cancelled.")
+			continue
+		}
 
 		log.Println("Response:", responseString)
 
@@ -73,14 +127,16 @@ func main() {
 }
 
 // buildResponse builds a string response based on content parts from candidates
-func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) string {
+func buildResponse(ctx context.Context, resp *genai.GenerateContentResponse, cs *genai.ChatSession) string {
 	funcResponse := make(map[string]interface{})
+	var attached []attachedMedia
 	var err error
 
 	for _, part := range resp.Candidates[0].Content.Parts {
 		functionCall, ok := part.(genai.FunctionCall)
 		if ok {
 			log.Println("Function call:", functionCall.Name)
+			checkpoints.EnsureCheckpoint()
 			switch functionCall.Name {
 			case "file_write":
 				fileName, fileNameOk := functionCall.Args["fileName"].(string)
@@ -96,23 +152,184 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 				}
 				err := WriteDesktop(fileName, content)
 				if err != nil {
-					funcResponse["error"] = "could not write file."
+					funcResponse["error"] = err.Error()
 				} else {
 					funcResponse["result"] = "file successfully written"
 				}
 
-			//case "scan_directory":
-			//	directory, ok := functionCall.Args["directory"].(string)
-			//	if !ok {
-			//		funcResponse = map[string]interface{}{"error": "Invalid directory path"}
-			//		break
-			//	}
-			//	result, err := scanDirectory(directory)
-			//	if err != nil {
-			//		funcResponse["error"] = err.Error()
-			//	} else {
-			//		funcResponse["result"] = result
-			//	}
+			case "file_edit":
+				fileName, ok := functionCall.Args["fileName"].(string)
+				if !ok || strings.TrimSpace(fileName) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'fileName'"
+					break
+				}
+				edits, err := parseEditsArg(functionCall.Args["edits"])
+				if err != nil {
+					funcResponse["error"] = err.Error()
+					break
+				}
+				diff, _ := functionCall.Args["diff"].(string)
+				result, err := EditFile(fileName, edits, diff)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = result
+				}
+
+			case "search_files":
+				result, err := SearchFiles(parseSearchArgs(functionCall.Args))
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "find_files":
+				directory, _ := functionCall.Args["directory"].(string)
+				sortBy, _ := functionCall.Args["sortBy"].(string)
+				limit, _ := intArg(functionCall.Args, "limit")
+				includeDirs, _ := functionCall.Args["includeDirs"].(bool)
+				result, err := FindFiles(directory, stringListArg(functionCall.Args["patterns"]), sortBy, limit, includeDirs)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "go_list_symbols", "go_find_definition", "go_find_references":
+				result, err := runGoCodeTool(functionCall.Name, functionCall.Args)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "repo_map":
+				directory, _ := functionCall.Args["directory"].(string)
+				maxTokens, _ := intArg(functionCall.Args, "maxTokens")
+				result, err := repoMaps.Build(directory, maxTokens)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = result
+				}
+
+			case "semantic_search":
+				query, ok := functionCall.Args["query"].(string)
+				if !ok || strings.TrimSpace(query) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'query'"
+					break
+				}
+				topK, _ := intArg(functionCall.Args, "topK")
+				directory, _ := functionCall.Args["directory"].(string)
+				result, err := SemanticSearch(ctx, newEmbedder(genaiApp.client), directory, query, topK)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "doc_query":
+				filePath, ok := functionCall.Args["filePath"].(string)
+				if !ok || strings.TrimSpace(filePath) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'filePath'"
+					break
+				}
+				question, _ := functionCall.Args["question"].(string)
+				topK, _ := intArg(functionCall.Args, "topK")
+				result, err := DocQuery(ctx, genaiApp.client, newEmbedder(genaiApp.client), filePath, question, topK)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = result
+				}
+
+			case "batch_analyze":
+				patterns := stringListArg(functionCall.Args["patterns"])
+				if len(patterns) == 0 {
+					funcResponse["error"] = "expected non-empty array of strings at key 'patterns'"
+					break
+				}
+				opts := batchOptions{Patterns: patterns}
+				opts.Prompt, _ = functionCall.Args["prompt"].(string)
+				opts.Output, _ = functionCall.Args["output"].(string)
+				opts.Directory, _ = functionCall.Args["directory"].(string)
+				opts.Concurrency, _ = intArg(functionCall.Args, "concurrency")
+				opts.RatePerMinute, _ = intArg(functionCall.Args, "ratePerMinute")
+				result, err := RunBatch(ctx, genaiApp.client, opts, func(done, total int, rec batchRecord) {
+					log.Printf("batch [%d/%d] %s %s\n", done, total, rec.Status, rec.File)
+				})
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "image_info":
+				filePath, ok := functionCall.Args["filePath"].(string)
+				if !ok || strings.TrimSpace(filePath) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'filePath'"
+					break
+				}
+				result, err := ImageInfo(filePath)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "fetch_url":
+				rawURL, ok := functionCall.Args["url"].(string)
+				if !ok || strings.TrimSpace(rawURL) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'url'"
+					break
+				}
+				maxChars, _ := intArg(functionCall.Args, "maxChars")
+				result, err := newFetcher().Fetch(ctx, rawURL, maxChars)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "open_file":
+				filePath, ok := functionCall.Args["filePath"].(string)
+				if !ok || strings.TrimSpace(filePath) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'filePath'"
+					break
+				}
+				prompt, _ := functionCall.Args["prompt"].(string)
+				startLine, _ := intArg(functionCall.Args, "startLine")
+				endLine, _ := intArg(functionCall.Args, "endLine")
+				result, err := OpenFile(ctx, genaiApp.client, filePath, prompt, startLine, endLine)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = result
+				}
+
+			case "git_status", "git_diff", "git_log", "git_blame", "git_show_file", "git_add", "git_commit":
+				result, err := runGitTool(functionCall.Name, functionCall.Args)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
+
+			case "scan_directory":
+				directory, ok := functionCall.Args["directory"].(string)
+				if !ok || strings.TrimSpace(directory) == "" {
+					funcResponse["error"] = "expected non-empty string at key 'directory'"
+					break
+				}
+				depth, _ := intArg(functionCall.Args, "depth")
+				maxEntries, _ := intArg(functionCall.Args, "maxEntries")
+				result, err := scanDirectory(directory, depth, maxEntries)
+				if err != nil {
+					funcResponse["error"] = err.Error()
+				} else {
+					funcResponse["result"] = toResponseValue(result)
+				}
 
 			// default:
 			// 	response = map[string]interface{}{"error": "Unknown function call"}
@@ -127,7 +344,9 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 					}
 				}
 
-				content, err := ReadFile(fileName)
+				startLine, _ := intArg(functionCall.Args, "startLine")
+				endLine, _ := intArg(functionCall.Args, "endLine")
+				content, err := ReadFile(fileName, startLine, endLine)
 				if err != nil {
 					funcResponse["error"] = err.Error()
 				} else {
@@ -170,10 +389,28 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 				}
 
 			case "read_file_content":
-				// Retrieve the filePath argument.
-				filePath, ok := functionCall.Args["filePath"].(string)
-				if !ok || strings.TrimSpace(filePath) == "" {
-					funcResponse["error"] = "expected non-empty string at key 'filePath'"
+				// Accept either a single filePath or a list of filePaths.
+				filePaths := stringListArg(functionCall.Args["filePaths"])
+				if filePath, ok := functionCall.Args["filePath"].(string); ok && strings.TrimSpace(filePath) != "" {
+					filePaths = append([]string{filePath}, filePaths...)
+				}
+				if len(filePaths) == 0 {
+					funcResponse["error"] = "expected non-empty string at key 'filePath' or a list at 'filePaths'"
+					break
+				}
+				if mode, _ := functionCall.Args["mode"].(string); mode == "transcribe" {
+					if len(filePaths) != 1 {
+						funcResponse["error"] = "transcribe takes exactly one file"
+						break
+					}
+					format, _ := functionCall.Args["format"].(string)
+					language, _ := functionCall.Args["language"].(string)
+					result, err := Transcribe(ctx, genaiApp.client, filePaths[0], format, language)
+					if err != nil {
+						funcResponse["error"] = err.Error()
+					} else {
+						funcResponse["result"] = toResponseValue(result)
+					}
 					break
 				}
 				// Retrieve the prompt argument.
@@ -182,8 +419,22 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 					funcResponse["error"] = "expected non-empty string at key 'prompt'"
 					break
 				}
+				attach, ok := functionCall.Args["attach"].(bool)
+				if !ok {
+					attach = attachMediaByDefault()
+				}
+				if attach {
+					parts, err := AttachMedia(ctx, genaiApp.client, filePaths)
+					if err != nil {
+						funcResponse["error"] = err.Error()
+						break
+					}
+					attached = append(attached, attachedMedia{filePaths: filePaths, prompt: prompt, parts: parts})
+					funcResponse["result"] = fmt.Sprintf("Attached %d file(s); they follow this response. Look at them to answer: %s", len(filePaths), prompt)
+					break
+				}
 				// Call our file analysis function.
-				analysis, err := ReadFileContentWithAI(context.Background(), genaiApp.client, filePath, prompt)
+				analysis, err := ReadFileContentWithAI(ctx, genaiApp.client, filePaths, prompt)
 				if err != nil {
 					funcResponse["error"] = err.Error()
 				} else {
@@ -197,15 +448,12 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 	}
 
 	if len(funcResponse) > 0 {
-		resp, err = cs.SendMessage(context.Background(), genai.FunctionResponse{
-			Name:     "Function_Call",
-			Response: funcResponse,
-		})
+		resp, err = sendFunctionResponse(ctx, cs, funcResponse, attached)
 		if err != nil {
 			return "Error sending message: " + err.Error()
 		}
 		funcResponse = nil
-		return buildResponse(resp, cs)
+		return buildResponse(ctx, resp, cs)
 	}
 
 	for _, cand := range resp.Candidates {
@@ -222,3 +470,59 @@ func buildResponse(resp *genai.GenerateContentResponse, cs *genai.ChatSession) s
 	}
 	return ""
 }
+
+// sendFunctionResponse sends funcResponse followed by any media attached by read_file_content.
+// If the chat model rejects the attachments, they are analysed by a separate model call instead
+// and only the analysis is sent.
+func sendFunctionResponse(ctx context.Context, cs *genai.ChatSession, funcResponse map[string]interface{}, attached []attachedMedia) (*genai.GenerateContentResponse, error) {
+	parts := []genai.Part{genai.FunctionResponse{Name: "Function_Call", Response: funcResponse}}
+	for _, a := range attached {
+		parts = append(parts, a.parts...)
+	}
+	resp, err := cs.SendMessage(ctx, parts...)
+	if err == nil || len(attached) == 0 || ctx.Err() != nil {
+		return resp, err
+	}
+
+	log.Printf("Attaching media to the chat failed (%v); analysing it separately instead", err)
+	// SendMessage keeps the rejected message in the history.
+	cs.History = cs.History[:len(cs.History)-1]
+	var analyses []string
+	for _, a := range attached {
+		analysis, err := ReadFileContentWithAI(ctx, genaiApp.client, a.filePaths, a.prompt)
+		if err != nil {
+			funcResponse["error"] = err.Error()
+			continue
+		}
+		analyses = append(analyses, analysis)
+	}
+	funcResponse["result"] = strings.Join(analyses, "\n\n")
+	return cs.SendMessage(ctx, genai.FunctionResponse{Name: "Function_Call", Response: funcResponse})
+}
+
+// intArg reads a numeric function call argument. Gemini sends numbers as float64.
+func intArg(args map[string]any, key string) (int, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// toResponseValue converts a tool result into the plain maps, slices and scalars that a
+// FunctionResponse can carry, by round-tripping it through JSON.
+func toResponseValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return string(data)
+	}
+	return out
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"mime"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 	"unicode/utf8"
 
@@ -33,60 +35,230 @@ func extractResponse(resp *genai.GenerateContentResponse) string {
 	return output
 }
 
-// ReadFileContentWithAI uploads a media file (PDF, image, video, etc.) and asks Gemini
-// to analyze its content using the provided prompt. If only a file name is provided, it is
-// assumed to be in the current working directory.
-func ReadFileContentWithAI(ctx context.Context, client *genai.Client, filePath, prompt string) (string, error) {
-	// Resolve file path: if not absolute, use current working directory.
-	if !filepath.IsAbs(filePath) {
-		cwd, err := os.Getwd()
+// MediaTimeoutEnv overrides how long ReadFileContentWithAI waits for an uploaded file to finish
+// processing, as a Go duration such as "90s" or "10m".
+const MediaTimeoutEnv = "MYAPP_MEDIA_TIMEOUT"
+
+const (
+	defaultMediaTimeout = 5 * time.Minute
+	minPollInterval     = 1 * time.Second
+	maxPollInterval     = 10 * time.Second
+)
+
+// mediaTimeout returns the processing deadline from MediaTimeoutEnv, or the default.
+func mediaTimeout() time.Duration {
+	if v := strings.TrimSpace(os.Getenv(MediaTimeoutEnv)); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Warning: ignoring invalid %s=%q\n", MediaTimeoutEnv, v)
+	}
+	return defaultMediaTimeout
+}
+
+const (
+	// inlineMediaLimit is the largest file sent inline with the request instead of via the File API.
+	inlineMediaLimit = 4 * 1024 * 1024
+	// maxInlineMediaTotal keeps the request under the API's size limit when several files are inlined.
+	maxInlineMediaTotal = 16 * 1024 * 1024
+	maxMediaFiles       = 10
+	// maxAttachInlineTotal is the inline budget for media attached to the chat history.
+	maxAttachInlineTotal = 256 * 1024
+)
+
+// ReadFileContentWithAI asks Gemini to analyze one or more media files (PDF, image, video, etc.)
+// together using the provided prompt, so it can compare them in a single call. Small files are
+// sent inline; larger ones are uploaded, or an earlier upload of the same contents is reused. If
+// only a file name is provided, it is assumed to be in the current working directory. Cancelling
+// ctx aborts the uploads, the wait for processing and the analysis.
+func ReadFileContentWithAI(ctx context.Context, client *genai.Client, filePaths []string, prompt string) (string, error) {
+	parts, err := mediaParts(ctx, client, filePaths, maxInlineMediaTotal)
+	if err != nil {
+		return "", err
+	}
+	parts = append(parts, genai.Text(prompt))
+
+	resp, err := client.GenerativeModel(MediaModel).GenerateContent(ctx, parts...)
+	if err != nil {
+		return "", fmt.Errorf("error generating content: %v", err)
+	}
+
+	return extractResponse(resp), nil
+}
+
+// AttachMedia returns parts that put filePaths into the chat itself, so the main model sees
+// the media directly and can refer back to it in later turns. Attached parts stay in the chat
+// history and are resent with every request, so only very small files are inlined.
+func AttachMedia(ctx context.Context, client *genai.Client, filePaths []string) ([]genai.Part, error) {
+	return mediaParts(ctx, client, filePaths, maxAttachInlineTotal)
+}
+
+// mediaParts resolves filePaths and returns a part for each, labelled by name when there are
+// several. At most inlineBudget bytes are sent inline.
+func mediaParts(ctx context.Context, client *genai.Client, filePaths []string, inlineBudget int64) ([]genai.Part, error) {
+	if len(filePaths) == 0 {
+		return nil, fmt.Errorf("no files to analyze")
+	}
+	if len(filePaths) > maxMediaFiles {
+		return nil, fmt.Errorf("too many files: %d (at most %d per call)", len(filePaths), maxMediaFiles)
+	}
+
+	var parts []genai.Part
+	for i, filePath := range filePaths {
+		// Resolve file path: if not absolute, use current working directory.
+		if !filepath.IsAbs(filePath) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get current working directory: %v", err)
+			}
+			filePath = filepath.Join(cwd, filePath)
+		}
+		if err := workspace.CheckRead(filePath); err != nil {
+			return nil, err
+		}
+
+		part, err := mediaPart(ctx, client, filePath, &inlineBudget)
 		if err != nil {
-			return "", fmt.Errorf("failed to get current working directory: %v", err)
+			return nil, fmt.Errorf("%s: %v", filepath.Base(filePath), err)
 		}
-		filePath = filepath.Join(cwd, filePath)
+		// Label each file so the prompt can refer to them by name.
+		if len(filePaths) > 1 {
+			parts = append(parts, genai.Text(fmt.Sprintf("File %d: %s", i+1, filepath.Base(filePath))))
+		}
+		parts = append(parts, part)
 	}
+	return parts, nil
+}
 
-	// Open the file.
+// attachedMedia is media that read_file_content attached to the chat, with what is needed to
+// analyse it separately if the chat model rejects it.
+type attachedMedia struct {
+	filePaths []string
+	prompt    string
+	parts     []genai.Part
+}
+
+// MediaModeEnv set to "attach" makes read_file_content attach files to the conversation
+// unless the model asks otherwise. By default they are analyzed by a separate model call.
+const MediaModeEnv = "MYAPP_MEDIA_MODE"
+
+// attachMediaByDefault reports whether MediaModeEnv selects attaching.
+func attachMediaByDefault() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv(MediaModeEnv)), "attach")
+}
+
+// mediaPart returns filePath as an inline blob if it fits within inlineMediaLimit and what is
+// left of inlineBudget, and as an uploaded file otherwise. Images are first preprocessed as
+// ImagePrepEnv says.
+func mediaPart(ctx context.Context, client *genai.Client, filePath string, inlineBudget *int64) (genai.Part, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access file: %v", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("is a directory")
+	}
+	if mimeType, _ := sniffFile(filePath); mediaCategory(mimeType) == "Image" {
+		prepared, err := preprocessImage(filePath, imagePrepSteps())
+		if err != nil {
+			return nil, err
+		}
+		if prepared != nil {
+			log.Printf("preprocessed %s: %s", filepath.Base(filePath), strings.Join(prepared.Notes, ", "))
+			if len(prepared.Data) <= inlineMediaLimit && int64(len(prepared.Data)) <= *inlineBudget {
+				*inlineBudget -= int64(len(prepared.Data))
+				return genai.Blob{MIMEType: prepared.MIMEType, Data: prepared.Data}, nil
+			}
+			path, dir, err := preparedImagePath(filePath, prepared)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write preprocessed image: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			filePath = path
+			if info, err = os.Stat(filePath); err != nil {
+				return nil, fmt.Errorf("failed to access file: %v", err)
+			}
+		}
+	}
+	if info.Size() <= inlineMediaLimit && info.Size() <= *inlineBudget {
+		mimeType, err := sniffFile(filePath)
+		if err == nil {
+			if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+				mimeType = base
+			}
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file: %v", err)
+			}
+			*inlineBudget -= int64(len(data))
+			return genai.Blob{MIMEType: mimeType, Data: data}, nil
+		}
+	}
+
+	// Unchanged files are uploaded once and reused until the upload expires.
+	file, err := uploadCached(ctx, client, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return genai.FileData{URI: file.URI, MIMEType: file.MIMEType}, nil
+}
+
+// uploadMedia uploads filePath with its sniffed MIME type.
+func uploadMedia(ctx context.Context, client *genai.Client, filePath string) (*genai.File, error) {
 	osf, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer osf.Close()
 
-	// Upload the file using UploadFile.
-	file, err := client.UploadFile(ctx, "", osf, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %v", err)
+	opts := &genai.UploadFileOptions{DisplayName: filepath.Base(filePath)}
+	if mimeType, err := sniffFile(filePath); err == nil && !strings.HasPrefix(mimeType, "text/") {
+		opts.MIMEType = mimeType
 	}
-	// Clean up the uploaded file after processing.
-	defer func() {
-		if err := client.DeleteFile(ctx, file.Name); err != nil {
-			log.Printf("warning: failed to delete file %s: %v", file.Name, err)
+
+	log.Printf("uploading %s", filepath.Base(filePath))
+	file, err := client.UploadFile(ctx, "", osf, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("upload cancelled: %v", ctx.Err())
 		}
-	}()
+		return nil, fmt.Errorf("failed to upload file: %v", err)
+	}
+	return file, nil
+}
+
+// waitForActive polls an uploaded file until it leaves the PROCESSING state, backing off
+// between polls. It fails if processing fails, timeout elapses or ctx is cancelled.
+func waitForActive(ctx context.Context, client *genai.Client, file *genai.File, timeout time.Duration) (*genai.File, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	interval := minPollInterval
 
-	// Videos need to be processed before you can use them.
 	for file.State == genai.FileStateProcessing {
-		log.Printf("processing %s", file.Name)
-		time.Sleep(5 * time.Second)
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("file %s was still processing after %s; try again later or raise %s", file.Name, timeout, MediaTimeoutEnv)
+		}
+		log.Printf("processing %s (%s elapsed)", file.Name, time.Since(start).Round(time.Second))
+
+		timer := time.NewTimer(min(interval, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("cancelled while waiting for %s to process: %v", file.Name, ctx.Err())
+		case <-timer.C:
+		}
+		interval = min(interval*2, maxPollInterval)
+
 		var err error
 		if file, err = client.GetFile(ctx, file.Name); err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("failed to check processing state: %v", err)
 		}
 	}
 	if file.State != genai.FileStateActive {
-		log.Fatalf("uploaded file has state %s, not active", file.State)
-	}
-
-	// Use the generative model (e.g., "gemini-1.5-pro") to analyze the file.
-	resp, err := client.GenerativeModel("gemini-1.5-pro").GenerateContent(ctx,
-		genai.FileData{URI: file.URI},
-		genai.Text(prompt))
-	if err != nil {
-		return "", fmt.Errorf("error generating content: %v", err)
+		return nil, fmt.Errorf("uploaded file has state %s, not active", file.State)
 	}
-
-	return extractResponse(resp), nil
+	return file, nil
 }
 
 var fileContentSchema = &genai.Schema{
@@ -96,20 +268,42 @@ var fileContentSchema = &genai.Schema{
 			Type:        genai.TypeString,
 			Description: "The full path or file name (if in the current directory) of the file to analyze (e.g., PDF, image, video, etc.).",
 		},
+		"filePaths": {
+			Type:        genai.TypeArray,
+			Items:       &genai.Schema{Type: genai.TypeString},
+			Description: "Several files to analyze together in one call, e.g. to compare two screenshots or two PDFs. Use instead of filePath.",
+		},
 		"prompt": {
 			Type:        genai.TypeString,
-			Description: "A prompt describing the analysis to perform (e.g., 'Describe the contents of this video in detail' or 'Summarize this document').",
+			Description: "A prompt describing the analysis to perform (e.g., 'Describe the contents of this video in detail' or 'Summarize this document'). Required unless mode is 'transcribe'.",
+		},
+		"mode": {
+			Type: genai.TypeString,
+			Description: "'analyze' (default) returns the prompt's analysis. 'transcribe' transcribes the speech in an audio or video " +
+				"file and saves it next to the file as subtitles; the prompt is then ignored.",
+		},
+		"format": {
+			Type:        genai.TypeString,
+			Description: "For mode 'transcribe': 'srt' (default), 'vtt' or 'txt'.",
+		},
+		"language": {
+			Type:        genai.TypeString,
+			Description: "For mode 'transcribe': the language to write the transcript in, if it should be translated.",
+		},
+		"attach": {
+			Type: genai.TypeBoolean,
+			Description: "Attach the files to the conversation instead of returning a separate analysis, so you can look at them " +
+				"yourself and refer back to them in later turns without uploading them again.",
 		},
 	},
-	Required: []string{"filePath", "prompt"},
 }
 
 var FileContentTool = &genai.Tool{
 	FunctionDeclarations: []*genai.FunctionDeclaration{
 		{
 			Name: "read_file_content",
-			Description: "Uploads a media file and returns its analysis. Supports PDFs, images, videos, and other documents. " +
-				"If the file is a video, the tool waits until the file is fully processed before generating content.",
+			Description: "Analyzes one or more media files with AI and returns the result. Supports PDFs, images, videos, and other documents. " +
+				"Pass several files to compare them in one call, or use mode 'transcribe' to save timestamped subtitles (SRT, WebVTT or text) for audio and video. If a file is a video, the tool waits until it is fully processed before generating content.",
 			Parameters: fileContentSchema,
 		},
 	},
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// maxMentionTotal bounds how much text @-mentions add to one message.
+	maxMentionTotal = 400 * 1024
+	// maxMentionListing bounds the entries shown for an @dir/ mention.
+	maxMentionListing = 200
+	// maxCompletions bounds the candidates printed for an ambiguous Tab completion.
+	maxCompletions = 50
+)
+
+// mentionPattern matches "@path" at the start of the input or after whitespace, so e-mail
+// addresses are left alone.
+var mentionPattern = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// expandMentions resolves the @-mentions in input. Text files are appended with a path header,
+// directories as a listing of their entries, and images, PDFs, audio and video as media parts.
+// Mentions that can't be used are left in the text and reported as warnings.
+func expandMentions(ctx context.Context, client *genai.Client, input string) ([]genai.Part, []string) {
+	var blocks []string
+	var mediaPaths []string
+	var warnings []string
+	seen := make(map[string]bool)
+	total := 0
+
+	for _, m := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		mention, fullPath, info, err := resolveMention(m[2])
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("@%s: %v", mention, err))
+			continue
+		}
+		if seen[fullPath] {
+			continue
+		}
+		seen[fullPath] = true
+		if err := workspace.CheckRead(fullPath); err != nil {
+			warnings = append(warnings, fmt.Sprintf("@%s: %v", mention, err))
+			continue
+		}
+
+		var block string
+		switch mimeType, _ := sniffFile(fullPath); {
+		case info.IsDir():
+			block = fmt.Sprintf("--- @%s (directory %s) ---\n%s", mention, fullPath, mentionListing(fullPath))
+		case mediaCategory(mimeType) != "":
+			mediaPaths = append(mediaPaths, fullPath)
+			continue
+		default:
+			content, err := ReadFile(fullPath, 0, 0)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("@%s: %v", mention, err))
+				continue
+			}
+			block = fmt.Sprintf("--- @%s (%s) ---\n%s", mention, fullPath, content)
+		}
+		if total+len(block) > maxMentionTotal {
+			warnings = append(warnings, fmt.Sprintf("@%s: skipped, mentioned files exceed %d KB", mention, maxMentionTotal/1024))
+			continue
+		}
+		total += len(block)
+		blocks = append(blocks, block)
+	}
+
+	parts := []genai.Part{genai.Text(input)}
+	if len(blocks) > 0 {
+		parts = append(parts, genai.Text("Contents of the mentioned files:\n\n"+strings.Join(blocks, "\n\n")))
+	}
+	if len(mediaPaths) > 0 {
+		media, err := AttachMedia(ctx, client, mediaPaths)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("could not attach media: %v", err))
+		} else {
+			parts = append(parts, media...)
+		}
+	}
+	return parts, warnings
+}
+
+// resolveMention finds the file a mention refers to and returns the mention as matched.
+// Trailing punctuation such as the comma in "see @main.go, then" is dropped if the path
+// doesn't exist with it.
+func resolveMention(mention string) (string, string, os.FileInfo, error) {
+	for {
+		fullPath, err := resolvePath(mention)
+		if err != nil {
+			return mention, "", nil, err
+		}
+		if info, err := os.Stat(fullPath); err == nil {
+			return mention, fullPath, info, nil
+		}
+		trimmed := strings.TrimRight(mention, ",.;:!?)'\"")
+		if trimmed == mention || trimmed == "" {
+			return mention, "", nil, fmt.Errorf("no such file or directory")
+		}
+		mention = trimmed
+	}
+}
+
+// mentionListing lists the visible entries of dir, one per line, with directories marked by a
+// trailing slash.
+func mentionListing(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Sprintf("(failed to list directory: %v)", err)
+	}
+	access := workspaceFor(dir)
+	var lines []string
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.Name() == ".git" || access.Access(p, e.IsDir()) == accessHidden {
+			continue
+		}
+		if len(lines) == maxMentionListing {
+			lines = append(lines, fmt.Sprintf("... (%d entries not shown)", len(entries)-maxMentionListing))
+			break
+		}
+		if e.IsDir() {
+			lines = append(lines, e.Name()+"/")
+		} else if info, err := e.Info(); err == nil {
+			lines = append(lines, fmt.Sprintf("%s (%d bytes)", e.Name(), info.Size()))
+		}
+	}
+	if len(lines) == 0 {
+		return "(empty)"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// completeMention completes the @-mention at the end of line. A unique match is filled in,
+// with "/" after directories; otherwise the common prefix is filled in and the candidates are
+// returned. Paths hidden by ignore rules are not offered.
+func completeMention(line string) (string, []string) {
+	start := strings.LastIndexAny(line, " \t") + 1
+	word := line[start:]
+	if !strings.HasPrefix(word, "@") {
+		return line, nil
+	}
+	typed := word[1:]
+	dirPart, prefix := "", typed
+	if i := strings.LastIndex(typed, "/"); i >= 0 {
+		dirPart, prefix = typed[:i+1], typed[i+1:]
+	}
+
+	var dir string
+	var err error
+	if dirPart == "" {
+		dir, err = os.Getwd()
+	} else {
+		dir, err = resolvePath(dirPart)
+	}
+	if err != nil {
+		return line, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return line, nil
+	}
+	access := workspaceFor(dir)
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || name == ".git" || access.Access(filepath.Join(dir, name), e.IsDir()) == accessHidden {
+			continue
+		}
+		// Hidden files are only offered once the user types the dot.
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return line, nil
+	}
+	sort.Strings(names)
+
+	if len(names) == 1 {
+		completed := line[:start] + "@" + dirPart + names[0]
+		if !strings.HasSuffix(names[0], "/") {
+			completed += " "
+		}
+		return completed, nil
+	}
+	common := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	for !utf8.ValidString(common) {
+		common = common[:len(common)-1]
+	}
+	if len(names) > maxCompletions {
+		names = append(names[:maxCompletions], fmt.Sprintf("... (%d more)", len(names)-maxCompletions))
+	}
+	return line[:start] + "@" + dirPart + common, names
+}
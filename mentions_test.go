@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// chdirTest changes the working directory for the rest of the test.
+func chdirTest(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func setupMentionDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore": "*.env\n",
+		".hidden":    "dot file\n",
+		"main.go":    "package main\n\nfunc main() {}\n",
+		"notes.txt":  "remember the milk\n",
+		"secret.env": "TOKEN=x\n",
+		"data.bin":   "\x00\x01\x02\x03\x00\x00\x00\x00\x05\x06",
+		"sub/a.txt":  "a\n",
+		"sub/b.txt":  "b\n",
+		"café.txt":   "1\n",
+		"cafè.txt":   "2\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	chdirTest(t, dir)
+	return dir
+}
+
+func TestExpandMentions(t *testing.T) {
+	setupMentionDir(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		contains []string // in the attached file contents
+		absent   []string
+		warnings []string
+	}{
+		{
+			name:     "file",
+			input:    "explain @main.go please",
+			contains: []string{"--- @main.go (", "     3\tfunc main() {}"},
+		},
+		{
+			name:     "trailing punctuation and duplicates",
+			input:    "compare @notes.txt, @main.go and @notes.txt.",
+			contains: []string{"--- @notes.txt (", "remember the milk", "--- @main.go ("},
+		},
+		{
+			name:     "directory",
+			input:    "what is in @sub/ and @.",
+			contains: []string{"--- @sub/ (directory ", "a.txt (2 bytes)\nb.txt (2 bytes)", "notes.txt (18 bytes)\nsub/"},
+			absent:   []string{"secret.env", ".git\n"},
+		},
+		{
+			name:     "unresolved",
+			input:    "open @missing.go and @main.go",
+			contains: []string{"--- @main.go ("},
+			warnings: []string{"@missing.go: no such file or directory"},
+		},
+		{
+			name:     "ignored and binary",
+			input:    "@secret.env @data.bin",
+			warnings: []string{"@secret.env: '", "excluded by ignore rules", "@data.bin: ", "use read_file_content"},
+		},
+		{
+			name:  "e-mail addresses are not mentions",
+			input: "mail someone@main.go",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, warnings := expandMentions(context.Background(), nil, tt.input)
+			if string(parts[0].(genai.Text)) != tt.input {
+				t.Errorf("first part %q, want the input unchanged", parts[0])
+			}
+			var attached string
+			if len(parts) > 1 {
+				attached = string(parts[1].(genai.Text))
+			}
+			if len(tt.contains) == 0 && len(parts) != 1 {
+				t.Errorf("got %d parts, want only the input", len(parts))
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(attached, want) {
+					t.Errorf("attached text %q does not contain %q", attached, want)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(attached, unwanted) {
+					t.Errorf("attached text %q contains %q", attached, unwanted)
+				}
+			}
+			if n := strings.Count(attached, "--- @notes.txt"); n > 1 {
+				t.Errorf("notes.txt attached %d times", n)
+			}
+			joined := strings.Join(warnings, "\n")
+			for _, want := range tt.warnings {
+				if !strings.Contains(joined, want) {
+					t.Errorf("warnings %q do not contain %q", warnings, want)
+				}
+			}
+			if len(tt.warnings) == 0 && len(warnings) > 0 {
+				t.Errorf("unexpected warnings %q", warnings)
+			}
+		})
+	}
+}
+
+func TestExpandMentionsTotalLimit(t *testing.T) {
+	dir := t.TempDir()
+	// Each file is longer than ReadFile returns in one call, so every block is just over 100 KB
+	// and only three fit in maxMentionTotal.
+	line := strings.Repeat("x", 100) + "\n"
+	files := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		files[name+".txt"] = strings.Repeat(line, 1500)
+	}
+	writeFiles(t, dir, files)
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	chdirTest(t, dir)
+
+	parts, warnings := expandMentions(context.Background(), nil, "@a.txt @b.txt @c.txt @d.txt @e.txt")
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	attached := string(parts[1].(genai.Text))
+	if len(attached) > maxMentionTotal+1024 {
+		t.Errorf("attached %d bytes, limit %d", len(attached), maxMentionTotal)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if !strings.Contains(attached, "--- @"+name+".txt (") {
+			t.Errorf("%s.txt not attached", name)
+		}
+	}
+	want := []string{
+		"@d.txt: skipped, mentioned files exceed 400 KB",
+		"@e.txt: skipped, mentioned files exceed 400 KB",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+}
+
+func TestCompleteMention(t *testing.T) {
+	dir := setupMentionDir(t)
+
+	tests := []struct {
+		line       string
+		want       string
+		candidates string
+	}{
+		{"@ma", "@main.go ", ""},
+		{"look at @s", "look at @sub/", ""}, // secret.env is ignored
+		{"@sub/", "@sub/", "a.txt b.txt"},
+		{"@sub/b", "@sub/b.txt ", ""},
+		{"@.", "@.", ".gitignore .hidden"},
+		{"@", "@", "cafè.txt café.txt data.bin main.go notes.txt sub/"},
+		{"@caf", "@caf", "cafè.txt café.txt"}, // the common prefix stops before a split rune
+		{"@zzz", "@zzz", ""},
+		{"no mention", "no mention", ""},
+		{"@nope/x", "@nope/x", ""},
+		{"see @" + dir + "/su", "see @" + dir + "/sub/", ""},
+	}
+	for _, tt := range tests {
+		got, candidates := completeMention(tt.line)
+		if got != tt.want || strings.Join(candidates, " ") != tt.candidates {
+			t.Errorf("completeMention(%q) = %q, %q; want %q, %q", tt.line, got, candidates, tt.want, tt.candidates)
+		}
+	}
+}
+
+func TestCompleteMentionLimit(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := range maxCompletions + 10 {
+		files[fmt.Sprintf("file%03d.txt", i)] = "x"
+	}
+	writeFiles(t, dir, files)
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	chdirTest(t, dir)
+
+	got, candidates := completeMention("@f")
+	if got != "@file0" {
+		t.Errorf("completed to %q, want @file0", got)
+	}
+	if len(candidates) != maxCompletions+1 || candidates[maxCompletions] != "... (10 more)" {
+		t.Errorf("got %d candidates ending in %q", len(candidates), candidates[len(candidates)-1])
+	}
+}
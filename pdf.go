@@ -0,0 +1,920 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// This file extracts text from PDFs without external tools. It reads every object in the file
+// (including compressed object streams), walks the page tree, and interprets the text operators
+// of each page's content streams, mapping character codes through the fonts' ToUnicode CMaps or
+// simple encodings. Layout is approximated: new lines start where the text moves down the page.
+
+const (
+	// maxPDFStream bounds the decompressed size of one stream.
+	maxPDFStream = 64 * 1024 * 1024
+	// maxPDFFormDepth bounds how deeply form XObjects are followed.
+	maxPDFFormDepth = 5
+)
+
+type pdfName string
+
+// pdfOp is an operator in a content stream, or a bare keyword in an object.
+type pdfOp string
+
+type pdfRef int
+
+type pdfDict map[string]interface{}
+
+type pdfObject struct {
+	value  interface{}
+	stream []byte // undecoded stream data, if the object is a stream
+}
+
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	fonts   map[interface{}]*pdfFont
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// extractPDF returns the text of each page of a PDF.
+func extractPDF(data []byte) ([]string, error) {
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, errors.New("the PDF is encrypted")
+	}
+	doc := &pdfDocument{objects: make(map[int]*pdfObject), fonts: make(map[interface{}]*pdfFont)}
+	doc.readObjects(data)
+	if len(doc.objects) == 0 {
+		return nil, errors.New("no PDF objects found")
+	}
+
+	var pages []string
+	for _, page := range doc.pages() {
+		var out pdfTextWriter
+		resources, _ := doc.resolve(page["Resources"]).(pdfDict)
+		for _, content := range doc.contentStreams(page["Contents"]) {
+			doc.showText(&out, content, resources, 0)
+		}
+		pages = append(pages, out.String())
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found")
+	}
+	return pages, nil
+}
+
+// readObjects indexes every "N G obj" in data, later definitions replacing earlier ones as in
+// incremental updates, and then unpacks object streams.
+func (d *pdfDocument) readObjects(data []byte) {
+	skipUntil := 0
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] < skipUntil {
+			continue // inside the stream of the previous object
+		}
+		id, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{b: data, pos: m[1]}
+		obj := &pdfObject{value: l.readValue()}
+		l.skipSpace()
+		if bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+			start := l.pos + len("stream")
+			if start < len(data) && data[start] == '\r' {
+				start++
+			}
+			if start < len(data) && data[start] == '\n' {
+				start++
+			}
+			end := -1
+			if dict, ok := obj.value.(pdfDict); ok {
+				if n, ok := dict["Length"].(float64); ok && start+int(n) <= len(data) &&
+					bytes.Contains(data[start+int(n):min(start+int(n)+32, len(data))], []byte("endstream")) {
+					end = start + int(n)
+				}
+			}
+			if end < 0 {
+				if i := bytes.Index(data[start:], []byte("endstream")); i >= 0 {
+					end = start + i
+				} else {
+					end = len(data)
+				}
+			}
+			obj.stream = data[start:end]
+			skipUntil = end
+		}
+		d.objects[id] = obj
+	}
+
+	for _, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("ObjStm") {
+			d.readObjectStream(obj)
+		}
+	}
+}
+
+// readObjectStream adds the objects packed in a compressed object stream. Objects defined
+// directly in the file take precedence.
+func (d *pdfDocument) readObjectStream(obj *pdfObject) {
+	dict := obj.value.(pdfDict)
+	data, err := d.decodeStream(obj)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(dict["N"]).(float64)
+	first, _ := d.resolve(dict["First"]).(float64)
+	header := &pdfLexer{b: data}
+	for i := 0; i < int(n); i++ {
+		id, ok1 := header.next().(float64)
+		offset, ok2 := header.next().(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		pos := int(first) + int(offset)
+		if pos >= len(data) {
+			continue
+		}
+		if _, exists := d.objects[int(id)]; !exists {
+			d.objects[int(id)] = &pdfObject{value: (&pdfLexer{b: data, pos: pos}).readValue()}
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj := d.objects[int(ref)]
+		if obj == nil {
+			return nil
+		}
+		v = obj.value
+	}
+	return nil
+}
+
+// pages returns the page dictionaries in order, with inherited resources filled in. If the
+// page tree can't be found, every page object is returned in object number order.
+func (d *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+	visited := make(map[pdfRef]bool)
+	var walk func(v interface{}, resources interface{})
+	walk = func(v interface{}, resources interface{}) {
+		if ref, ok := v.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		node, ok := d.resolve(v).(pdfDict)
+		if !ok {
+			return
+		}
+		if r, ok := node["Resources"]; ok {
+			resources = r
+		}
+		kids, isTree := d.resolve(node["Kids"]).([]interface{})
+		if !isTree {
+			page := make(pdfDict, len(node)+1)
+			for k, v := range node {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources)
+		}
+	}
+
+	for _, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			walk(dict["Pages"], nil)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	var ids []int
+	for id, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		pages = append(pages, d.objects[id].value.(pdfDict))
+	}
+	return pages
+}
+
+// contentStreams returns the decoded content streams of a page.
+func (d *pdfDocument) contentStreams(v interface{}) [][]byte {
+	var refs []interface{}
+	switch c := d.resolve(v).(type) {
+	case []interface{}:
+		refs = c
+	case pdfDict:
+		refs = []interface{}{v}
+	}
+	var out [][]byte
+	for _, ref := range refs {
+		r, ok := ref.(pdfRef)
+		if !ok || d.objects[int(r)] == nil {
+			continue
+		}
+		if data, err := d.decodeStream(d.objects[int(r)]); err == nil {
+			out = append(out, data)
+		}
+	}
+	return out
+}
+
+// decodeStream applies a stream's filters. Image filters are not supported.
+func (d *pdfDocument) decodeStream(obj *pdfObject) ([]byte, error) {
+	dict, _ := obj.value.(pdfDict)
+	var filters []interface{}
+	switch f := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{f}
+	case []interface{}:
+		filters = f
+	}
+
+	data := obj.stream
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Keep what was decoded from truncated or slightly corrupt streams.
+			decoded, err := io.ReadAll(io.LimitReader(zr, maxPDFStream))
+			if err != nil && len(decoded) == 0 {
+				return nil, err
+			}
+			data = decoded
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			s := strings.Map(func(r rune) rune {
+				if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+					return r
+				}
+				return -1
+			}, string(bytes.SplitN(data, []byte(">"), 2)[0]))
+			if len(s)%2 == 1 {
+				s += "0"
+			}
+			decoded, err := hex.DecodeString(s)
+			if err != nil {
+				return nil, err
+			}
+			data = decoded
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			src := bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if i := bytes.Index(src, []byte("~>")); i >= 0 {
+				src = src[:i]
+			}
+			decoded := make([]byte, 4*len(src)/5+4)
+			n, _, err := ascii85.Decode(decoded, src, true)
+			if err != nil {
+				return nil, err
+			}
+			data = decoded[:n]
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// showText interprets a content stream, writing the text it draws to out.
+func (d *pdfDocument) showText(out *pdfTextWriter, content []byte, resources pdfDict, depth int) {
+	fonts, _ := d.resolve(resources["Font"]).(pdfDict)
+	xobjects, _ := d.resolve(resources["XObject"]).(pdfDict)
+	font := &pdfFont{}
+	var operands []interface{}
+	var lastY float64
+
+	show := func(v interface{}) {
+		switch s := v.(type) {
+		case string:
+			out.Write(font.decode(s))
+		case []interface{}:
+			for _, item := range s {
+				switch t := item.(type) {
+				case string:
+					out.Write(font.decode(t))
+				case float64:
+					// Large negative adjustments are gaps between words.
+					if t < -120 {
+						out.Space()
+					}
+				}
+			}
+		}
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		n, _ := operands[i].(float64)
+		return n
+	}
+
+	l := &pdfLexer{b: content}
+	for {
+		tok := l.next()
+		if tok == nil && l.pos >= len(l.b) {
+			return
+		}
+		op, isOp := tok.(pdfOp)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+		n := len(operands)
+		switch op {
+		case "Tf":
+			if n >= 2 {
+				if name, ok := operands[n-2].(pdfName); ok {
+					font = d.font(fonts[string(name)])
+				}
+			}
+		case "Tj":
+			if n >= 1 {
+				show(operands[n-1])
+			}
+		case "TJ":
+			if n >= 1 {
+				show(operands[n-1])
+			}
+		case "'", "\"":
+			out.Newline()
+			if n >= 1 {
+				show(operands[n-1])
+			}
+		case "T*":
+			out.Newline()
+		case "Td", "TD":
+			if ty := number(n - 1); ty != 0 {
+				out.Newline()
+			} else if tx := number(n - 2); tx != 0 {
+				out.Space()
+			}
+		case "Tm":
+			if y := number(n - 1); math.Abs(y-lastY) > 1 {
+				out.Newline()
+				lastY = y
+			} else {
+				out.Space()
+			}
+		case "Do":
+			if n >= 1 && depth < maxPDFFormDepth {
+				if name, ok := operands[n-1].(pdfName); ok {
+					d.showForm(out, xobjects[string(name)], resources, depth)
+				}
+			}
+		case "ID":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// showForm writes the text of a form XObject.
+func (d *pdfDocument) showForm(out *pdfTextWriter, v interface{}, resources pdfDict, depth int) {
+	ref, ok := v.(pdfRef)
+	if !ok || d.objects[int(ref)] == nil {
+		return
+	}
+	obj := d.objects[int(ref)]
+	dict, _ := obj.value.(pdfDict)
+	if dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	if r, ok := d.resolve(dict["Resources"]).(pdfDict); ok {
+		resources = r
+	}
+	if data, err := d.decodeStream(obj); err == nil {
+		d.showText(out, data, resources, depth+1)
+	}
+}
+
+// pdfTextWriter collects page text, collapsing repeated spaces and blank lines.
+type pdfTextWriter struct {
+	b strings.Builder
+}
+
+func (w *pdfTextWriter) Write(s string) {
+	w.b.WriteString(s)
+}
+
+func (w *pdfTextWriter) Space() {
+	s := w.b.String()
+	if len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *pdfTextWriter) Newline() {
+	s := w.b.String()
+	if len(s) > 0 && !strings.HasSuffix(s, "\n\n") {
+		w.b.WriteByte('\n')
+	}
+}
+
+func (w *pdfTextWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// pdfFont maps character codes in shown strings to text.
+type pdfFont struct {
+	toUnicode map[string]string // code bytes -> text
+	codeLens  []int             // code lengths in toUnicode, longest first
+	twoByte   bool              // composite font without a ToUnicode map
+	macRoman  bool              // simple font based on MacRomanEncoding rather than WinAnsiEncoding
+	encoding  map[byte]string   // differences from the base encoding of a simple font
+}
+
+// font returns the decoder for a font dictionary, caching it per object.
+func (d *pdfDocument) font(v interface{}) *pdfFont {
+	key := v
+	if _, ok := v.(pdfRef); !ok {
+		key = fmt.Sprintf("%p", v)
+	}
+	if f, ok := d.fonts[key]; ok {
+		return f
+	}
+	f := &pdfFont{}
+	d.fonts[key] = f
+	dict, ok := d.resolve(v).(pdfDict)
+	if !ok {
+		return f
+	}
+
+	if ref, ok := dict["ToUnicode"].(pdfRef); ok && d.objects[int(ref)] != nil {
+		if data, err := d.decodeStream(d.objects[int(ref)]); err == nil {
+			f.parseCMap(data)
+		}
+	}
+	if f.toUnicode == nil && dict["Subtype"] == pdfName("Type0") {
+		f.twoByte = true
+	}
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		f.macRoman = enc == "MacRomanEncoding"
+	case pdfDict:
+		f.macRoman = d.resolve(enc["BaseEncoding"]) == pdfName("MacRomanEncoding")
+		if diffs, ok := d.resolve(enc["Differences"]).([]interface{}); ok {
+			f.encoding = make(map[byte]string)
+			code := 0
+			for _, item := range diffs {
+				switch t := d.resolve(item).(type) {
+				case float64:
+					code = int(t)
+				case pdfName:
+					if text, ok := glyphText(string(t)); ok && code < 256 {
+						f.encoding[byte(code)] = text
+					}
+					code++
+				}
+			}
+		}
+	}
+	return f
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap.
+func (f *pdfFont) parseCMap(data []byte) {
+	f.toUnicode = make(map[string]string)
+	lens := make(map[int]bool)
+	l := &pdfLexer{b: data}
+	var operands []interface{}
+	for {
+		tok := l.next()
+		if tok == nil && l.pos >= len(l.b) {
+			break
+		}
+		op, isOp := tok.(pdfOp)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(string); ok {
+					lens[len(lo)] = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					f.toUnicode[src] = utf16BE(dst)
+					lens[len(src)] = true
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				lens[len(lo)] = true
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				for c := start; c <= end; c++ {
+					code := codeBytes(c, len(lo))
+					switch dst := operands[i+2].(type) {
+					case string:
+						if len(dst) == 0 {
+							continue
+						}
+						b := []byte(dst)
+						last := codeValue(string(b[len(b)-1:])) + (c - start)
+						b[len(b)-1] = byte(last)
+						f.toUnicode[code] = utf16BE(string(b))
+					case []interface{}:
+						if idx := c - start; idx < len(dst) {
+							if s, ok := dst[idx].(string); ok {
+								f.toUnicode[code] = utf16BE(s)
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	for n := range lens {
+		f.codeLens = append(f.codeLens, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(f.codeLens)))
+	if len(f.codeLens) == 0 {
+		f.codeLens = []int{1}
+	}
+}
+
+// decode converts the bytes of a shown string to text.
+func (f *pdfFont) decode(s string) string {
+	var out strings.Builder
+	switch {
+	case f.toUnicode != nil:
+		for i := 0; i < len(s); {
+			matched := false
+			for _, n := range f.codeLens {
+				if i+n <= len(s) {
+					if text, ok := f.toUnicode[s[i:i+n]]; ok {
+						out.WriteString(text)
+						i += n
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				i += f.codeLens[len(f.codeLens)-1]
+			}
+		}
+	case f.twoByte:
+		// Without a ToUnicode map, glyph IDs can't be turned into text.
+	default:
+		for i := 0; i < len(s); i++ {
+			if text, ok := f.encoding[s[i]]; ok {
+				out.WriteString(text)
+			} else if f.macRoman && s[i] >= 0x80 {
+				out.WriteRune(macRomanHigh[s[i]-0x80])
+			} else {
+				out.WriteRune(winAnsiRune(s[i]))
+			}
+		}
+	}
+	return out.String()
+}
+
+func codeValue(s string) int {
+	v := 0
+	for i := 0; i < len(s); i++ {
+		v = v<<8 | int(s[i])
+	}
+	return v
+}
+
+func codeBytes(v, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// utf16BE decodes the big-endian UTF-16 used for CMap destinations.
+func utf16BE(s string) string {
+	if len(s)%2 == 1 {
+		return s
+	}
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh maps the bytes 0x80-0x9F of WinAnsiEncoding, which differ from Latin-1.
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// macRomanHigh maps the bytes 0x80-0xFF of MacRomanEncoding.
+var macRomanHigh = []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü" +
+	"†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ" +
+	"‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+func winAnsiRune(b byte) rune {
+	if b >= 0x80 && b < 0xA0 && winAnsiHigh[b-0x80] != 0 {
+		return winAnsiHigh[b-0x80]
+	}
+	return rune(b)
+}
+
+// glyphNames maps common glyph names used in encoding differences. Ligatures are spelled out
+// so the extracted text stays searchable.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "colon": ":",
+	"semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "underscore": "_", "braceleft": "{",
+	"bar": "|", "braceright": "}", "asciitilde": "~", "quoteleft": "‘", "quoteright": "’",
+	"quotedblleft": "“", "quotedblright": "”", "endash": "–", "emdash": "—", "bullet": "•",
+	"ellipsis": "…", "fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9",
+}
+
+// glyphText returns the text for a glyph name such as "A", "quoteright" or "uni00E9".
+func glyphText(name string) (string, bool) {
+	if len(name) == 1 {
+		return name, true
+	}
+	if text, ok := glyphNames[name]; ok {
+		return text, true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if v, err := strconv.ParseUint(name[3:], 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	return "", false
+}
+
+// pdfLexer tokenizes PDF objects and content streams.
+type pdfLexer struct {
+	b   []byte
+	pos int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// readValue reads one object, recognising "N G R" as an indirect reference.
+func (l *pdfLexer) readValue() interface{} {
+	tok := l.next()
+	if n, ok := tok.(float64); ok {
+		save := l.pos
+		if _, ok := l.next().(float64); ok {
+			if l.next() == pdfOp("R") {
+				return pdfRef(int(n))
+			}
+		}
+		l.pos = save
+	}
+	return tok
+}
+
+// next returns the next token: a float64, string, pdfName, []interface{}, pdfDict, bool,
+// pdfOp, or nil at the end of input or for "null".
+func (l *pdfLexer) next() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil
+	}
+	c := l.b[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+			l.pos++
+		}
+		name := string(l.b[start:l.pos])
+		if strings.Contains(name, "#") {
+			name = decodeNameEscapes(name)
+		}
+		return pdfName(name)
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '<':
+		l.pos += 2
+		dict := make(pdfDict)
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.b) {
+				return dict
+			}
+			if l.b[l.pos] == '>' {
+				l.pos += 2
+				return dict
+			}
+			key, ok := l.next().(pdfName)
+			if !ok {
+				continue
+			}
+			dict[string(key)] = l.readValue()
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.b[l.pos:], '>')
+		if end < 0 {
+			end = len(l.b) - l.pos
+		}
+		digits := strings.Map(func(r rune) rune {
+			if isPDFSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, string(l.b[l.pos:l.pos+end]))
+		l.pos += end + 1
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		decoded, _ := hex.DecodeString(digits)
+		return string(decoded)
+	case c == '[':
+		l.pos++
+		arr := []interface{}{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.b) {
+				return arr
+			}
+			if l.b[l.pos] == ']' {
+				l.pos++
+				return arr
+			}
+			arr = append(arr, l.readValue())
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfOp(string(c))
+	}
+
+	start := l.pos
+	for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	word := string(l.b[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n
+	}
+	switch word {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return pdfOp(word)
+}
+
+// literalString reads a (...) string, handling nesting and escapes.
+func (l *pdfLexer) literalString() string {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(out)
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return string(out)
+			}
+			e := l.b[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				if e == '\r' && l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// skipInlineImage skips the binary data of an inline image, which ends at "EI".
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.b) {
+		if isPDFSpace(l.b[l.pos]) && l.b[l.pos+1] == 'E' && l.b[l.pos+2] == 'I' &&
+			(l.pos+3 >= len(l.b) || isPDFSpace(l.b[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.b)
+}
+
+func decodeNameEscapes(name string) string {
+	var out strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if v, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				out.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		out.WriteByte(name[i])
+	}
+	return out.String()
+}
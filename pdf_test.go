@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildTestPDF writes a minimal PDF with one page per content stream, using a standard
+// Helvetica font. With compress set, the content streams are Flate-compressed.
+func buildTestPDF(contents []string, compress bool) []byte {
+	var objects []string
+	kids := make([]string, len(contents))
+	for i := range contents {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /Resources << /Font << /F1 3 0 R >> >> >>", strings.Join(kids, " "), len(contents)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+	for i, content := range contents {
+		stream := []byte(content)
+		filter := ""
+		if compress {
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(stream)
+			zw.Close()
+			stream = buf.Bytes()
+			filter = " /Filter /FlateDecode"
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d%s >>\nstream\n%s\nendstream", len(stream), filter, stream),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	const body = "BT /F1 12 Tf 72 720 Td (Quarterly report for the northern region) Tj " +
+		"0 -14 Td (Revenue grew by twelve percent over the previous quarter) Tj ET"
+	tests := []struct {
+		name   string
+		data   []byte
+		pages  int
+		sparse bool
+		want   []string
+	}{
+		{
+			name:  "uncompressed",
+			data:  buildTestPDF([]string{body}, false),
+			pages: 1,
+			want:  []string{"--- Page 1 ---", "Quarterly report for the northern region", "Revenue grew by twelve percent"},
+		},
+		{
+			name:  "flate compressed",
+			data:  buildTestPDF([]string{body, "BT /F1 12 Tf 72 720 Td (Second page text with enough characters to count) Tj ET"}, true),
+			pages: 2,
+			want:  []string{"--- Page 1 ---", "Quarterly report", "--- Page 2 ---", "Second page text"},
+		},
+		{
+			name:  "hex strings and escapes",
+			data:  buildTestPDF([]string{`BT /F1 12 Tf 72 720 Td <48656C6C6F> Tj ( \(world\) and more text to avoid being sparse) Tj ET`}, false),
+			pages: 1,
+			want:  []string{"Hello (world) and more text"},
+		},
+		{
+			name:   "scanned page",
+			data:   buildTestPDF([]string{"q 612 0 0 792 0 0 cm /Im1 Do Q"}, true),
+			pages:  1,
+			sparse: true,
+			want:   []string{"--- Page 1 ---"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := extractDocument(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Format != "PDF" || doc.Pages != tt.pages || doc.Sparse != tt.sparse {
+				t.Errorf("got format %s, %d pages, sparse %v; want PDF, %d pages, sparse %v", doc.Format, doc.Pages, doc.Sparse, tt.pages, tt.sparse)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(doc.Text, w) {
+					t.Errorf("text does not contain %q:\n%s", w, doc.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPDFLineBreaks(t *testing.T) {
+	doc, err := extractDocument(buildTestPDF([]string{"BT /F1 12 Tf 72 720 Td (First line) Tj 0 -14 Td (Second line) Tj ET"}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.Text, "First line\nSecond line") {
+		t.Errorf("moving down the page should start a new line:\n%s", doc.Text)
+	}
+}
+
+func TestExtractPDFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"encrypted", []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Encrypt 5 0 R >>\n")},
+		{"no objects", []byte("%PDF-1.4\nnothing here\n")},
+		{"no pages", []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")},
+	}
+	for _, tt := range tests {
+		if _, err := extractDocument(tt.data); err == nil || err == errNotDocument {
+			t.Errorf("%s: got error %v, want a PDF error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// RepoMapEnv, when set to "1" or "true", appends a repository map to the system prompt at startup.
+const RepoMapEnv = "MYAPP_REPO_MAP"
+
+const (
+	defaultRepoMapTokens = 2000
+	maxRepoMapFiles      = 5000
+	maxRepoMapFileSize   = 1024 * 1024
+	// maxRepoMapSymbols keeps one large file from using up the whole budget.
+	maxRepoMapSymbols = 12
+)
+
+// repoSymbol is a top-level declaration shown in the repository map.
+type repoSymbol struct {
+	Name string
+	Line string // one-line declaration
+	Refs int
+}
+
+// repoFile is the cached outline of one source file.
+type repoFile struct {
+	modTime time.Time
+	size    int64
+	symbols []repoSymbol
+	idents  map[string]bool // identifiers used in the file, for ranking
+}
+
+// repoMapper builds repository maps and caches per-file outlines, re-parsing only files whose
+// size or modification time changed since the last call.
+type repoMapper struct {
+	mu    sync.Mutex
+	files map[string]*repoFile // keyed by absolute path
+}
+
+var repoMaps = &repoMapper{files: make(map[string]*repoFile)}
+
+var identPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// declPatterns recognise top-level declarations in common non-Go languages. The first
+// capture group is the declared name.
+var declPatterns = map[string][]*regexp.Regexp{
+	".py": {
+		regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`),
+	},
+	".js":   jsDeclPatterns,
+	".jsx":  jsDeclPatterns,
+	".ts":   jsDeclPatterns,
+	".tsx":  jsDeclPatterns,
+	".java": {regexp.MustCompile(`^(?:public\s+|abstract\s+|final\s+)*(?:class|interface|enum|record)\s+([A-Za-z_]\w*)`)},
+	".rs": {
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?fn\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type)\s+([A-Za-z_]\w*)`),
+	},
+	".rb": {regexp.MustCompile(`^(?:def|class|module)\s+([A-Za-z_][\w.]*)`)},
+}
+
+var jsDeclPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+([A-Za-z_$][\w$]*)`),
+	regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`),
+	regexp.MustCompile(`^(?:export\s+)?(?:interface|type|enum)\s+([A-Za-z_$][\w$]*)`),
+	regexp.MustCompile(`^export\s+(?:const|let|var)\s+([A-Za-z_$][\w$]*)`),
+}
+
+// Build returns a map of the source files under dir and their top-level symbols, most
+// referenced first, trimmed to roughly maxTokens tokens.
+func (m *repoMapper) Build(dir string, maxTokens int) (string, error) {
+	if maxTokens <= 0 {
+		maxTokens = defaultRepoMapTokens
+	}
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	if err := workspace.CheckRead(root); err != nil {
+		return "", err
+	}
+	access := workspaceFor(root)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var paths []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		if d.Name() == ".git" || d.Name() == "node_modules" || d.Name() == "vendor" || access.Access(p, d.IsDir()) == accessHidden {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !isMappedSource(p) {
+			return nil
+		}
+		if len(paths) >= maxRepoMapFiles {
+			return filepath.SkipAll
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	files := make(map[string]*repoFile, len(paths))
+	for _, p := range paths {
+		if f := m.load(p); f != nil {
+			files[p] = f
+		}
+	}
+	// Forget files under root that were deleted or are now ignored.
+	for p := range m.files {
+		if _, ok := files[p]; !ok && strings.HasPrefix(p, root+string(filepath.Separator)) {
+			delete(m.files, p)
+		}
+	}
+
+	// A symbol's rank is the number of other files that mention its name, so a name repeated
+	// many times in one file doesn't outrank one used across the project.
+	totals := make(map[string]int)
+	for _, f := range files {
+		for _, s := range f.symbols {
+			totals[s.Name] = 0
+		}
+	}
+	for _, f := range files {
+		for name := range f.idents {
+			if _, ok := totals[name]; ok {
+				totals[name]++
+			}
+		}
+	}
+
+	type rankedFile struct {
+		rel     string
+		score   int
+		symbols []repoSymbol
+	}
+	var ranked []rankedFile
+	for p, f := range files {
+		rel, _ := filepath.Rel(root, p)
+		rf := rankedFile{rel: filepath.ToSlash(rel)}
+		for _, s := range f.symbols {
+			s.Refs = max(totals[s.Name]-1, 0)
+			rf.score += s.Refs
+			rf.symbols = append(rf.symbols, s)
+		}
+		sort.SliceStable(rf.symbols, func(i, j int) bool { return rf.symbols[i].Refs > rf.symbols[j].Refs })
+		ranked = append(ranked, rf)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].rel < ranked[j].rel
+	})
+
+	// Roughly four characters per token.
+	budget := maxTokens * 4
+	var out strings.Builder
+	omitted := 0
+	for _, rf := range ranked {
+		header := rf.rel + "\n"
+		if out.Len()+len(header) > budget {
+			omitted++
+			continue
+		}
+		out.WriteString(header)
+		for i, s := range rf.symbols {
+			line := "  " + s.Line + "\n"
+			if i == maxRepoMapSymbols || out.Len()+len(line) > budget {
+				out.WriteString(fmt.Sprintf("  ... (%d more)\n", len(rf.symbols)-i))
+				break
+			}
+			out.WriteString(line)
+		}
+	}
+	if omitted > 0 {
+		out.WriteString(fmt.Sprintf("(%d more files omitted; use find_files or a larger maxTokens to see them)\n", omitted))
+	}
+	return out.String(), nil
+}
+
+// load returns the outline of path, re-parsing it only if it changed since it was cached.
+func (m *repoMapper) load(path string) *repoFile {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxRepoMapFileSize {
+		delete(m.files, path)
+		return nil
+	}
+	if f, ok := m.files[path]; ok && f.size == info.Size() && f.modTime.Equal(info.ModTime()) {
+		return f
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	f := &repoFile{modTime: info.ModTime(), size: info.Size(), idents: make(map[string]bool)}
+	for _, id := range identPattern.FindAllString(string(src), -1) {
+		f.idents[id] = true
+	}
+	if strings.HasSuffix(path, ".go") {
+		f.symbols = goOutline(path, src)
+	} else {
+		f.symbols = regexOutline(filepath.Ext(path), string(src))
+	}
+	m.files[path] = f
+	return f
+}
+
+// goOutline lists top-level Go declarations, showing only the first line of each.
+func goOutline(path string, src []byte) []repoSymbol {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil && file == nil {
+		return nil
+	}
+	var symbols []repoSymbol
+	for _, s := range fileSymbols(fset, parsedGoFile{rel: path, file: file, src: src}) {
+		line, _, _ := strings.Cut(s.Signature, "\n")
+		if s.Kind == "type" && strings.HasSuffix(line, "{") {
+			line = strings.TrimSuffix(line, " {")
+		}
+		symbols = append(symbols, repoSymbol{Name: s.Name, Line: line})
+	}
+	return symbols
+}
+
+// regexOutline lists declarations that start at column zero in other languages.
+func regexOutline(ext, src string) []repoSymbol {
+	patterns := declPatterns[ext]
+	var symbols []repoSymbol
+	for _, line := range strings.Split(src, "\n") {
+		for _, re := range patterns {
+			if m := re.FindStringSubmatch(line); m != nil {
+				decl := strings.TrimRight(strings.TrimSpace(line), "{:")
+				symbols = append(symbols, repoSymbol{Name: m[1], Line: strings.TrimSpace(decl)})
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+func isMappedSource(path string) bool {
+	ext := filepath.Ext(path)
+	_, ok := declPatterns[ext]
+	return ok || ext == ".go"
+}
+
+// repoMapEnabled reports whether RepoMapEnv asks for the map in the system prompt.
+func repoMapEnabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(RepoMapEnv)))
+	return v == "1" || v == "true" || v == "yes"
+}
+
+var repoMapSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"directory": {
+			Type:        genai.TypeString,
+			Description: "Project directory to map. Defaults to the current working directory.",
+		},
+		"maxTokens": {
+			Type:        genai.TypeInteger,
+			Description: "Approximate size limit of the map in tokens (default 2000).",
+		},
+	},
+}
+
+var RepoMapTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "repo_map",
+			Description: "Returns a compact outline of the project's source files and their top-level functions, " +
+				"types and classes, with the most referenced files and symbols first. Use it to orient yourself in a codebase.",
+			Parameters: repoMapSchema,
+		},
+	},
+}
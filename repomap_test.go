@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupRepoMapDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib/util.go":     "package lib\n\n// Helper helps.\nfunc Helper() int { return 1 }\n\nfunc unused() {}\n\ntype Config struct {\n\tName string\n}\n",
+		"cmd/a.go":        "package main\n\nfunc main() { lib.Helper(); Run() }\n\nfunc Run() {}\n",
+		"cmd/b.go":        "package main\n\nfunc other() { _ = lib.Helper; _ = lib.Config{} }\n",
+		"web/app.py":      "class Server:\n    def handle(self):\n        Helper()\n\ndef start():\n    Server()\n",
+		"web/README.md":   "Helper Config Run\n",
+		"vendor/x/x.go":   "package x\n\nfunc Vendored() { Helper() }\n",
+		"build/gen.go":    "package build\n\nfunc Generated() { Helper() }\n",
+		".gitignore":      "build/\n",
+		".git/hooks/h.go": "package h\n\nfunc Hook() {}\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	return dir
+}
+
+func TestRepoMapBuild(t *testing.T) {
+	dir := setupRepoMapDir(t)
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		want      string
+	}{
+		{
+			// Helper is used in three other files, Config and main in one each, so lib/util.go
+			// ranks first, then cmd/a.go; the rest tie and are sorted by path.
+			name: "ranked",
+			want: "lib/util.go\n  func Helper() int\n  type Config struct\n  func unused()\n" +
+				"cmd/a.go\n  func main()\n  func Run()\n" +
+				"cmd/b.go\n  func other()\n" +
+				"web/app.py\n  class Server\n  def start()\n",
+		},
+		{
+			name:      "budget",
+			maxTokens: 20,
+			want: "lib/util.go\n  func Helper() int\n  type Config struct\n  func unused()\n" +
+				"cmd/a.go\n  ... (2 more)\n" +
+				"(2 more files omitted; use find_files or a larger maxTokens to see them)\n",
+		},
+		{
+			name:      "budget too small for any file",
+			maxTokens: 1,
+			want:      "(4 more files omitted; use find_files or a larger maxTokens to see them)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &repoMapper{files: make(map[string]*repoFile)}
+			got, err := m.Build(dir, tt.maxTokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoMapSymbolLimit(t *testing.T) {
+	dir := t.TempDir()
+	var src strings.Builder
+	src.WriteString("package big\n")
+	for i := range maxRepoMapSymbols + 3 {
+		fmt.Fprintf(&src, "\nfunc F%02d() {}\n", i)
+	}
+	writeFiles(t, dir, map[string]string{"big.go": src.String()})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	m := &repoMapper{files: make(map[string]*repoFile)}
+	got, err := m.Build(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != maxRepoMapSymbols+2 || lines[len(lines)-1] != "  ... (3 more)" {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestRepoMapCache(t *testing.T) {
+	dir := setupRepoMapDir(t)
+	m := &repoMapper{files: make(map[string]*repoFile)}
+	if _, err := m.Build(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.files) != 4 {
+		t.Errorf("cached %d files, want 4", len(m.files))
+	}
+
+	// An edited file is re-parsed; a deleted one is forgotten.
+	util := filepath.Join(dir, "lib/util.go")
+	writeFiles(t, dir, map[string]string{"lib/util.go": "package lib\n\nfunc Renamed() {}\n"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(util, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "cmd/b.go")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Build(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "func Renamed()") || strings.Contains(got, "Helper") || strings.Contains(got, "cmd/b.go") {
+		t.Errorf("stale map:\n%s", got)
+	}
+	if _, ok := m.files[filepath.Join(dir, "cmd/b.go")]; ok {
+		t.Error("deleted file still cached")
+	}
+}
+
+func TestRegexOutline(t *testing.T) {
+	tests := []struct {
+		ext, src string
+		want     string
+	}{
+		{".py", "import os\n\nasync def fetch(url):\n    def inner():\n        pass\n\nclass Client(Base):\n", "fetch: async def fetch(url); Client: class Client(Base)"},
+		{".ts", "export default async function main() {\nexport abstract class Shape {\ninterface Props {\nexport const API_URL = 'x';\nconst local = 1;\n", "main: export default async function main(); Shape: export abstract class Shape; Props: interface Props; API_URL: export const API_URL = 'x';"},
+		{".rs", "pub(crate) async fn run() {\npub struct Point {\nimpl Point {\n", "run: pub(crate) async fn run(); Point: pub struct Point"},
+		{".java", "public final class Main {\n  public void run() {\n", "Main: public final class Main"},
+		{".rb", "module Admin\ndef self.call\n", "Admin: module Admin; self.call: def self.call"},
+		{".txt", "def not_code():\n", ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, s := range regexOutline(tt.ext, tt.src) {
+			got = append(got, s.Name+": "+s.Line)
+		}
+		if strings.Join(got, "; ") != tt.want {
+			t.Errorf("%s: got  %s\nwant %s", tt.ext, strings.Join(got, "; "), tt.want)
+		}
+	}
+}
@@ -1,103 +1,154 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"time"
 )
 
-// scanDirectory scans the given directory using `tree` (or `find/dir`) while respecting .fileignore
-func scanDirectory(dir string) (string, error) {
+const (
+	defaultScanDepth      = 3
+	defaultScanMaxEntries = 500
+)
+
+// scanEntry is one file or directory in a scan_directory result.
+type scanEntry struct {
+	Name      string       `json:"name"`
+	Path      string       `json:"path"`
+	Type      string       `json:"type"` // "dir", "file" or "symlink"
+	Kind      string       `json:"kind,omitempty"`
+	Size      int64        `json:"size,omitempty"`
+	Modified  string       `json:"modified"`
+	Children  []*scanEntry `json:"children,omitempty"`
+	Truncated bool         `json:"truncated,omitempty"` // children not listed because of the depth limit
+	ReadOnly  bool         `json:"readOnly,omitempty"`  // matched by ignore rules in read-only mode
+}
+
+// scanResult is the structured result of scanDirectory.
+type scanResult struct {
+	Root      string       `json:"root"`
+	Entries   []*scanEntry `json:"entries"`
+	Files     int          `json:"files"`
+	Dirs      int          `json:"dirs"`
+	Ignored   int          `json:"ignored"`
+	Truncated bool         `json:"truncated,omitempty"` // stopped early because maxEntries was reached
+}
+
+// scanDirectory walks dir up to depth levels deep, listing at most maxEntries entries while respecting
+// .fileignore and .gitignore files at every level.
+func scanDirectory(dir string, depth, maxEntries int) (*scanResult, error) {
 	if dir == "" {
-		return "", fmt.Errorf("error: directory path is required")
+		return nil, fmt.Errorf("error: directory path is required")
+	}
+	if depth <= 0 {
+		depth = defaultScanDepth
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultScanMaxEntries
 	}
 
 	// Convert to absolute path
 	absPath, err := filepath.Abs(dir)
 	if err != nil {
-		return "", fmt.Errorf("error: failed to get absolute path: %v", err)
+		return nil, fmt.Errorf("error: failed to get absolute path: %v", err)
 	}
 
 	// Ensure the directory exists
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("error: directory '%s' does not exist", absPath)
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("error: directory '%s' does not exist", absPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("error: failed to access '%s': %v", absPath, err)
 	}
-
-	// Load ignore patterns (optional)
-	ignorePatterns, err := loadIgnorePatterns(absPath)
-	if err != nil {
-		log.Printf("Warning: Failed to load .fileignore: %v\n", err)
+	if !info.IsDir() {
+		return nil, fmt.Errorf("error: '%s' is not a directory", absPath)
 	}
 
-	// Run tree command with ignore rules
-	treeOutput, err := runTreeCommand(absPath, ignorePatterns)
-	if err != nil {
-		return "", fmt.Errorf("error: failed to run tree command: %v", err)
+	result := &scanResult{Root: absPath}
+	w := &scanWalker{root: absPath, access: workspaceFor(absPath), maxDepth: depth, maxEntries: maxEntries, result: result}
+	result.Entries = w.walk(absPath, 1)
+	if result.Entries == nil {
+		result.Entries = []*scanEntry{}
 	}
+	return result, nil
+}
 
-	return treeOutput, nil
+type scanWalker struct {
+	root       string
+	access     *workspaceAccess
+	maxDepth   int
+	maxEntries int
+	result     *scanResult
 }
 
-// runTreeCommand executes the system's directory listing command while skipping ignored files
-func runTreeCommand(dir string, ignorePatterns []string) (string, error) {
-	var cmd *exec.Cmd
-	var ignoreArgs []string
+// walk lists dir, which sits at the given depth below the root, recursing into subdirectories.
+func (w *scanWalker) walk(dir string, depth int) []*scanEntry {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Warning: Error accessing path %s: %v\n", dir, err)
+		return nil
+	}
 
-	// Convert ignore patterns to command arguments
-	for _, pattern := range ignorePatterns {
-		if runtime.GOOS == "windows" {
-			ignoreArgs = append(ignoreArgs, fmt.Sprintf("/S /B /A:-D | find /V \"%s\"", pattern))
-		} else {
-			ignoreArgs = append(ignoreArgs, fmt.Sprintf("! -path '%s/*'", filepath.Join(dir, pattern)))
+	var entries []*scanEntry
+	for _, de := range dirEntries {
+		if w.result.Files+w.result.Dirs >= w.maxEntries {
+			w.result.Truncated = true
+			break
+		}
+
+		path := filepath.Join(dir, de.Name())
+		info, err := de.Info()
+		if err != nil {
+			log.Printf("Warning: Error accessing path %s: %v\n", path, err)
+			continue
+		}
+		relPath, _ := filepath.Rel(w.root, path)
+		access := w.access.Access(path, info.IsDir())
+		if de.Name() == ".git" || access == accessHidden {
+			w.result.Ignored++
+			continue
 		}
-	}
 
-	if runtime.GOOS == "windows" {
-		// Windows: Use `dir /s /b` and filter ignored files
-		cmd = exec.Command("cmd", "/c", "dir /s /b", dir, strings.Join(ignoreArgs, " "))
-	} else {
-		// Linux/macOS: Use `find` with ignore filters
-		if _, err := exec.LookPath("tree"); err == nil {
-			cmd = exec.Command("tree", "-a", "--noreport", "--prune", "--matchdirs", dir)
-			for _, pattern := range ignorePatterns {
-				cmd.Args = append(cmd.Args, "-I", pattern)
+		entry := &scanEntry{
+			Name:     de.Name(),
+			Path:     filepath.ToSlash(relPath),
+			Modified: info.ModTime().Format(time.RFC3339),
+			ReadOnly: access == accessReadOnly,
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Type = "symlink"
+			w.result.Files++
+		case info.IsDir():
+			entry.Type = "dir"
+			w.result.Dirs++
+			if depth < w.maxDepth {
+				entry.Children = w.walk(path, depth+1)
+			} else if hasEntries(path) {
+				entry.Truncated = true
 			}
-		} else {
-			findCmd := []string{"find", dir, "-type", "f"}
-			findCmd = append(findCmd, ignoreArgs...)
-			cmd = exec.Command(findCmd[0], findCmd[1:]...)
+		default:
+			entry.Type = "file"
+			entry.Size = info.Size()
+			if kind := detectFileType(path); kind != "Unknown" {
+				entry.Kind = kind
+			}
+			w.result.Files++
 		}
+		entries = append(entries, entry)
 	}
-
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	err := cmd.Run()
-	return out.String(), err
+	return entries
 }
 
-// loadIgnorePatterns reads .fileignore and returns a slice of patterns
-func loadIgnorePatterns(dir string) ([]string, error) {
-	ignoreFilePath := filepath.Join(dir, ".fileignore")
-	data, err := ioutil.ReadFile(ignoreFilePath)
+// hasEntries reports whether dir contains anything at all.
+func hasEntries(dir string) bool {
+	f, err := os.Open(dir)
 	if err != nil {
-		return nil, err // No .fileignore found, return empty slice
-	}
-
-	lines := strings.Split(string(data), "\n")
-	var patterns []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed != "" {
-			patterns = append(patterns, trimmed)
-		}
+		return false
 	}
-	return patterns, nil
+	defer f.Close()
+	names, _ := f.Readdirnames(1)
+	return len(names) > 0
 }
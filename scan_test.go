@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// flattenScan lists every entry in a scan result by path, with "/..." after directories whose
+// children were cut off by the depth limit.
+func flattenScan(entries []*scanEntry) []string {
+	var paths []string
+	for _, e := range entries {
+		p := e.Path
+		if e.Truncated {
+			p += "/..."
+		}
+		paths = append(paths, p)
+		paths = append(paths, flattenScan(e.Children)...)
+	}
+	return paths
+}
+
+func TestScanDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":            "*.log\nbuild/\n",
+		"main.go":               "package main\n",
+		"debug.log":             "ignored\n",
+		"build/out":             "ignored\n",
+		"docs/guide.md":         "# Guide\n",
+		"docs/img/logo.png":     "\x89PNG\r\n\x1a\n",
+		"docs/img/deep/more.md": "deep\n",
+		"src/.fileignore":       "secret.txt\n",
+		"src/secret.txt":        "hidden\n",
+		"src/lib.go":            "package lib\n",
+		".git/HEAD":             "ref: refs/heads/main\n",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		depth, max int
+		readOnly   bool
+		want       string
+		truncated  bool
+	}{
+		{
+			name: "default depth",
+			want: ".gitignore docs docs/guide.md docs/img docs/img/deep/... docs/img/logo.png empty main.go src src/.fileignore src/lib.go",
+		},
+		{
+			name:  "depth one",
+			depth: 1,
+			want:  ".gitignore docs/... empty main.go src/...",
+		},
+		{
+			name:      "max entries",
+			max:       3,
+			want:      ".gitignore docs docs/guide.md",
+			truncated: true,
+		},
+		{
+			name:     "read-only mode lists ignored paths",
+			depth:    2,
+			readOnly: true,
+			want:     ".gitignore build build/out debug.log docs docs/guide.md docs/img/... empty main.go src src/.fileignore src/lib.go src/secret.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := ""
+			if tt.readOnly {
+				mode = ignoreModeReadOnly
+			}
+			t.Setenv(IgnoreModeEnv, mode)
+			old := workspace
+			workspace = newWorkspaceAccess(dir)
+			t.Cleanup(func() { workspace = old })
+
+			res, err := scanDirectory(dir, tt.depth, tt.max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(flattenScan(res.Entries), " "); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+			if res.Truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", res.Truncated, tt.truncated)
+			}
+		})
+	}
+
+	t.Setenv(IgnoreModeEnv, "")
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	res, err := scanDirectory(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .git, debug.log, build and src/secret.txt.
+	if res.Ignored != 4 || res.Files != 6 || res.Dirs != 5 {
+		t.Errorf("counted %d files, %d dirs, %d ignored; want 6, 5, 4", res.Files, res.Dirs, res.Ignored)
+	}
+	for _, e := range res.Entries {
+		if e.Path == "main.go" && (e.Type != "file" || e.Size != 13 || e.Kind != "Text" || e.Modified == "") {
+			t.Errorf("main.go entry = %+v", e)
+		}
+		if e.Path == "docs" && e.Children[1].Children[1].Kind != "Image" {
+			t.Errorf("logo.png entry = %+v", e.Children[1].Children[1])
+		}
+	}
+
+	for _, bad := range []string{"", filepath.Join(dir, "missing"), filepath.Join(dir, "main.go")} {
+		if _, err := scanDirectory(bad, 0, 0); err == nil {
+			t.Errorf("scanDirectory(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	defaultSearchMaxResults = 100
+	maxSearchContextLines   = 10
+	// maxSearchFileSize skips files too large to be source code.
+	maxSearchFileSize = 5 * 1024 * 1024
+	// maxSearchLineRunes caps the text returned for each matched or context line, so a hit in
+	// minified or generated code doesn't flood the response.
+	maxSearchLineRunes = 200
+)
+
+// searchMatch is one hit returned by search_files.
+type searchMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+	// Clipped is set when Text (or a context line) is only part of a long line.
+	Clipped bool `json:"clipped,omitempty"`
+}
+
+// searchResult is the structured result of SearchFiles.
+type searchResult struct {
+	Matches       []searchMatch `json:"matches"`
+	FilesSearched int           `json:"filesSearched"`
+	FilesMatched  int           `json:"filesMatched"`
+	Truncated     bool          `json:"truncated,omitempty"`
+}
+
+// searchOptions controls SearchFiles.
+type searchOptions struct {
+	Pattern      string
+	Literal      bool
+	IgnoreCase   bool
+	Directory    string
+	Include      []string
+	Exclude      []string
+	ContextLines int
+	MaxResults   int
+}
+
+// SearchFiles searches the text files under opts.Directory for a regular expression or literal
+// string. Binary files, .git and paths hidden by ignore rules are skipped.
+func SearchFiles(opts searchOptions) (*searchResult, error) {
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("search pattern must not be empty")
+	}
+	expr := opts.Pattern
+	if opts.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+
+	include, err := compileGlobs(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileGlobs(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = defaultSearchMaxResults
+	}
+	opts.ContextLines = min(max(opts.ContextLines, 0), maxSearchContextLines)
+
+	if opts.Directory == "" {
+		opts.Directory = "."
+	}
+	root, err := filepath.Abs(opts.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	if err := workspace.CheckRead(root); err != nil {
+		return nil, err
+	}
+	access := workspaceFor(root)
+
+	result := &searchResult{Matches: []searchMatch{}}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Warning: Error accessing path %s: %v\n", path, err)
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if d.Name() == ".git" || access.Access(path, d.IsDir()) == accessHidden {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if len(include) > 0 && !matchesAnyGlob(include, rel) {
+			return nil
+		}
+		if matchesAnyGlob(exclude, rel) {
+			return nil
+		}
+
+		if len(result.Matches) >= opts.MaxResults {
+			result.Truncated = true
+			return filepath.SkipAll
+		}
+		n := searchFile(path, rel, re, opts, result)
+		if n > 0 {
+			result.FilesMatched++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchFile appends the matches in one file to result and returns how many were found.
+func searchFile(path, rel string, re *regexp.Regexp, opts searchOptions, result *searchResult) int {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return 0
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	text, _, err := decodeText(data)
+	if err != nil {
+		return 0 // binary
+	}
+	result.FilesSearched++
+
+	lines := strings.Split(text, "\n")
+	found := 0
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		if len(result.Matches) >= opts.MaxResults {
+			result.Truncated = true
+			break
+		}
+		m := searchMatch{
+			File:   rel,
+			Line:   i + 1,
+			Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+		}
+		m.Text, m.Clipped = clipLine(line, loc[0], loc[1])
+		context := func(j int) string {
+			text, clipped := clipLine(strings.TrimSuffix(lines[j], "\r"), 0, 0)
+			m.Clipped = m.Clipped || clipped
+			return text
+		}
+		if opts.ContextLines > 0 {
+			for j := max(0, i-opts.ContextLines); j < i; j++ {
+				m.Before = append(m.Before, context(j))
+			}
+			for j := i + 1; j < len(lines) && j <= i+opts.ContextLines; j++ {
+				m.After = append(m.After, context(j))
+			}
+		}
+		result.Matches = append(result.Matches, m)
+		found++
+	}
+	return found
+}
+
+// clipLine returns at most maxSearchLineRunes runes of line, centred on the match at byte
+// offsets start to end, and reports whether anything was cut.
+func clipLine(line string, start, end int) (string, bool) {
+	if utf8.RuneCountInString(line) <= maxSearchLineRunes {
+		return line, false
+	}
+	runes := []rune(line)
+	from := utf8.RuneCountInString(line[:start])
+	matched := utf8.RuneCountInString(line[start:end])
+	from = max(0, from-max(0, maxSearchLineRunes-matched)/2)
+	to := min(len(runes), from+maxSearchLineRunes)
+	from = max(0, to-maxSearchLineRunes)
+	return string(runes[from:to]), true
+}
+
+// compileGlobs compiles path globs using .gitignore syntax: "*.go" matches at any depth,
+// patterns containing a slash are relative to the search root, and "**" spans directories.
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, g := range globs {
+		g = strings.TrimSpace(filepath.ToSlash(g))
+		if g == "" {
+			continue
+		}
+		anchored := strings.Contains(g, "/")
+		re, err := regexp.Compile(globToRegexp(strings.TrimPrefix(g, "/"), anchored))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %v", g, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAnyGlob(globs []*regexp.Regexp, rel string) bool {
+	for _, re := range globs {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSearchArgs builds searchOptions from a search_files function call.
+func parseSearchArgs(args map[string]interface{}) searchOptions {
+	opts := searchOptions{
+		Include: stringListArg(args["include"]),
+		Exclude: stringListArg(args["exclude"]),
+	}
+	opts.Pattern, _ = args["pattern"].(string)
+	opts.Literal, _ = args["literal"].(bool)
+	opts.IgnoreCase, _ = args["ignoreCase"].(bool)
+	opts.Directory, _ = args["directory"].(string)
+	opts.ContextLines, _ = intArg(args, "contextLines")
+	opts.MaxResults, _ = intArg(args, "maxResults")
+	return opts
+}
+
+var searchFilesSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"pattern": {
+			Type:        genai.TypeString,
+			Description: "The regular expression (Go RE2 syntax) or literal text to search for.",
+		},
+		"literal": {
+			Type:        genai.TypeBoolean,
+			Description: "Treat pattern as literal text instead of a regular expression.",
+		},
+		"ignoreCase": {
+			Type:        genai.TypeBoolean,
+			Description: "Match case-insensitively. Searches are case-sensitive by default.",
+		},
+		"directory": {
+			Type:        genai.TypeString,
+			Description: "Directory to search. Defaults to the current working directory.",
+		},
+		"include": {
+			Type:        genai.TypeArray,
+			Items:       &genai.Schema{Type: genai.TypeString},
+			Description: "Only search files matching these globs (e.g. '*.go', 'src/**/*.ts').",
+		},
+		"exclude": {
+			Type:        genai.TypeArray,
+			Items:       &genai.Schema{Type: genai.TypeString},
+			Description: "Skip files matching these globs (e.g. '*_test.go', 'vendor/**').",
+		},
+		"contextLines": {
+			Type:        genai.TypeInteger,
+			Description: "Number of lines of context to return before and after each match (max 10).",
+		},
+		"maxResults": {
+			Type:        genai.TypeInteger,
+			Description: "Maximum number of matches to return (default 100).",
+		},
+	},
+	Required: []string{"pattern"},
+}
+
+var SearchFilesTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "search_files",
+			Description: "Searches the contents of text files in a directory tree and returns matching lines with " +
+				"file, line and column. Long lines are clipped to 200 characters around the match. " +
+				"Skips binary files and anything excluded by .fileignore/.gitignore.",
+			Parameters: searchFilesSchema,
+		},
+	},
+}
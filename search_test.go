@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearchFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":          "secret.go\n",
+		"main.go":             "package main\n\nfunc main() {\n\tRun(\"a.b\")\n}\n",
+		"main_test.go":        "package main\n\nfunc TestRun(t *testing.T) { Run(\"axb\") }\n",
+		"cmd/tool/tool.go":    "package tool\n\n// run the tool\nfunc run() {}\n",
+		"web/app.ts":          "export function run() {}\r\nconst RUN = 1;\r\n",
+		"secret.go":           "func Run() {}\n",
+		"data.bin":            "Run\x00\x01\x02\x03\x00\x00\x00\x00\x05\x06Run\x00\x00\x00\x00",
+		"utf16.txt":           string(encodeUTF16("call Run here\n", binary.LittleEndian, []byte{0xFF, 0xFE})),
+		"vendor/lib/lib.go":   "func Run() {}\n",
+		".git/hooks/pre-push": "Run\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	// matches lists file:line:column for each hit.
+	matches := func(res *searchResult) string {
+		var out []string
+		for _, m := range res.Matches {
+			out = append(out, fmt.Sprintf("%s:%d:%d", m.File, m.Line, m.Column))
+		}
+		return strings.Join(out, " ")
+	}
+	tests := []struct {
+		name string
+		opts searchOptions
+		want string
+		err  string
+	}{
+		{
+			name: "regular expression",
+			opts: searchOptions{Pattern: `Run\("a.b"\)`},
+			want: "main.go:4:2 main_test.go:3:30",
+		},
+		{
+			name: "literal",
+			opts: searchOptions{Pattern: `Run("a.b")`, Literal: true},
+			want: "main.go:4:2",
+		},
+		{
+			name: "case-insensitive, crlf and utf-16",
+			opts: searchOptions{Pattern: "run", IgnoreCase: true, Include: []string{"*.ts", "*.txt"}},
+			want: "utf16.txt:1:6 web/app.ts:1:17 web/app.ts:2:7",
+		},
+		{
+			name: "include with a slash is anchored",
+			opts: searchOptions{Pattern: "run", Include: []string{"cmd/**/*.go"}},
+			want: "cmd/tool/tool.go:3:4 cmd/tool/tool.go:4:6",
+		},
+		{
+			name: "exclude",
+			opts: searchOptions{Pattern: "func", Exclude: []string{"*_test.go", "vendor/**", "cmd/**"}},
+			want: "main.go:3:1 web/app.ts:1:8",
+		},
+		{
+			name: "max results",
+			opts: searchOptions{Pattern: "package", MaxResults: 2},
+			want: "cmd/tool/tool.go:1:1 main.go:1:1",
+		},
+		{name: "empty pattern", opts: searchOptions{}, err: "must not be empty"},
+		{name: "bad regular expression", opts: searchOptions{Pattern: "(unclosed"}, err: "invalid regular expression"},
+		{name: "hidden path", opts: searchOptions{Pattern: "x", Directory: dir + "/secret.go"}, err: "excluded by ignore rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts.Directory == "" {
+				tt.opts.Directory = dir
+			}
+			res, err := SearchFiles(tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matches(res); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	res, err := SearchFiles(searchOptions{Pattern: "package", MaxResults: 2, Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Truncated {
+		t.Error("max results reached but not marked as truncated")
+	}
+	res, err = SearchFiles(searchOptions{Pattern: "Run", Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range res.Matches {
+		if m.File == "data.bin" || m.File == "secret.go" || strings.HasPrefix(m.File, ".git/") {
+			t.Errorf("searched %s", m.File)
+		}
+	}
+}
+
+func TestSearchFilesContext(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"f.txt": "one\ntwo\nthree\nfour\nfive\n"})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	tests := []struct {
+		pattern       string
+		context       int
+		before, after string
+	}{
+		{"three", 1, "two", "four"},
+		{"three", 2, "one two", "four five"},
+		{"one", 2, "", "two three"},
+		{"five", 2, "three four", ""}, // the empty line after the final newline is kept
+		{"three", 0, "", ""},
+		{"three", 50, "one two", "four five"},
+	}
+	for _, tt := range tests {
+		res, err := SearchFiles(searchOptions{Pattern: tt.pattern, ContextLines: tt.context, Directory: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := res.Matches[0]
+		before, after := strings.Join(m.Before, " "), strings.TrimSpace(strings.Join(m.After, " "))
+		if before != tt.before || after != tt.after {
+			t.Errorf("%s with %d lines: before %q, after %q; want %q, %q", tt.pattern, tt.context, before, after, tt.before, tt.after)
+		}
+	}
+}
+
+func TestClipLine(t *testing.T) {
+	long := strings.Repeat("a", 1000) + "NEEDLE" + strings.Repeat("é", 1000)
+	start := strings.Index(long, "NEEDLE")
+
+	tests := []struct {
+		name       string
+		line       string
+		start, end int
+		contains   string
+		clipped    bool
+	}{
+		{"short line", "x := NEEDLE", 5, 11, "x := NEEDLE", false},
+		{"match in the middle", long, start, start + 6, "aNEEDLEé", true},
+		{"match at the start", "NEEDLE" + long, 0, 6, "NEEDLEaaa", true},
+		{"match at the end", long + "END", len(long), len(long) + 3, "ééEND", true},
+		{"context line", long, 0, 0, "aaa", true},
+	}
+	for _, tt := range tests {
+		got, clipped := clipLine(tt.line, tt.start, tt.end)
+		if clipped != tt.clipped || !strings.Contains(got, tt.contains) || !utf8.ValidString(got) {
+			t.Errorf("%s: got %q, clipped %v", tt.name, got, clipped)
+		}
+		if n := utf8.RuneCountInString(got); n > maxSearchLineRunes {
+			t.Errorf("%s: got %d runes, limit %d", tt.name, n, maxSearchLineRunes)
+		}
+	}
+}
+
+func TestSearchFilesLongLine(t *testing.T) {
+	dir := t.TempDir()
+	minified := "var a=1;" + strings.Repeat("function f(){return 1};", 100000) + "TARGET();" + strings.Repeat("x", 1000)
+	writeFiles(t, dir, map[string]string{"app.min.js": minified + "\n" + minified + "\n"})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	res, err := SearchFiles(searchOptions{Pattern: "TARGET", ContextLines: 1, Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(res.Matches))
+	}
+	m := res.Matches[0]
+	if !m.Clipped || !strings.Contains(m.Text, "TARGET();") || len(m.Text) > maxSearchLineRunes {
+		t.Errorf("got %d bytes, clipped %v: %q", len(m.Text), m.Clipped, m.Text)
+	}
+	if m.Column != strings.Index(minified, "TARGET")+1 {
+		t.Errorf("column = %d, want the position in the full line", m.Column)
+	}
+	if len(m.After) != 1 || len(m.After[0]) > maxSearchLineRunes {
+		t.Errorf("context line not clipped: %d bytes", len(m.After[0]))
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// EmbedderEnv selects the semantic_search embedding backend: "gemini" (the default) or
+// "local" for the offline hashing embedder.
+const EmbedderEnv = "MYAPP_EMBEDDER"
+
+// IndexDir is where semantic search indexes are kept, relative to the user's home directory.
+const IndexDir = ".myapp_index"
+
+const (
+	geminiEmbeddingModel = "text-embedding-004"
+	geminiEmbedBatchSize = 100
+	localEmbeddingDims   = 512
+
+	chunkLines        = 40
+	chunkOverlap      = 10
+	maxIndexFileSize  = 1024 * 1024
+	defaultSearchTopK = 5
+	maxSearchTopK     = 50
+)
+
+// maxIndexChunks caps the chunks in one project's index, and so the embedding work a single
+// search can trigger. Files that would exceed it are left out and reported in the result.
+var maxIndexChunks = 20000
+
+// embedder turns text into vectors. Documents and queries are embedded separately because
+// some backends use different task types for each.
+type embedder interface {
+	Name() string
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+// geminiEmbedder embeds text with the Gemini embedding API.
+type geminiEmbedder struct {
+	client *genai.Client
+	model  string
+}
+
+func (e *geminiEmbedder) Name() string { return "gemini-" + e.model }
+
+func (e *geminiEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	em := e.client.EmbeddingModel(e.model)
+	em.TaskType = genai.TaskTypeRetrievalDocument
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiEmbedBatchSize {
+		end := min(start+geminiEmbedBatchSize, len(texts))
+		batch := em.NewBatch()
+		for _, t := range texts[start:end] {
+			batch.AddContent(genai.Text(t))
+		}
+		resp, err := em.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed documents: %v", err)
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(resp.Embeddings), end-start)
+		}
+		for _, emb := range resp.Embeddings {
+			vectors = append(vectors, normalize(emb.Values))
+		}
+	}
+	return vectors, nil
+}
+
+func (e *geminiEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	em := e.client.EmbeddingModel(e.model)
+	em.TaskType = genai.TaskTypeRetrievalQuery
+	resp, err := em.EmbedContent(ctx, genai.Text(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %v", err)
+	}
+	if resp.Embedding == nil {
+		return nil, fmt.Errorf("embedding API returned no vector")
+	}
+	return normalize(resp.Embedding.Values), nil
+}
+
+// hashEmbedder is a deterministic, offline embedder that hashes word and sub-word tokens
+// into a fixed number of dimensions. It needs no network access.
+type hashEmbedder struct {
+	dims int
+}
+
+func (e *hashEmbedder) Name() string { return fmt.Sprintf("local-hash-%d", e.dims) }
+
+func (e *hashEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, t := range texts {
+		vectors[i] = e.embed(t)
+	}
+	return vectors, nil
+}
+
+func (e *hashEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	return e.embed(text), nil
+}
+
+func (e *hashEmbedder) embed(text string) []float32 {
+	v := make([]float32, e.dims)
+	for _, tok := range embeddingTokens(text) {
+		h := fnv.New64a()
+		h.Write([]byte(tok))
+		sum := h.Sum64()
+		sign := float32(1)
+		if sum&1 == 1 {
+			sign = -1
+		}
+		v[(sum>>1)%uint64(e.dims)] += sign
+	}
+	return normalize(v)
+}
+
+// embeddingTokens lowercases text and splits identifiers on case changes and underscores,
+// so "readFileContent" also yields "read", "file" and "content".
+func embeddingTokens(text string) []string {
+	var tokens []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, w := range words {
+		if len(w) < 2 {
+			continue
+		}
+		tokens = append(tokens, strings.ToLower(w))
+		var part []rune
+		flush := func() {
+			if len(part) >= 2 {
+				tokens = append(tokens, strings.ToLower(string(part)))
+			}
+			part = part[:0]
+		}
+		runes := []rune(w)
+		for i, r := range runes {
+			if r == '_' {
+				flush()
+				continue
+			}
+			if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+				flush()
+			}
+			part = append(part, r)
+		}
+		flush()
+	}
+	return tokens
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / n
+	}
+	return out
+}
+
+// indexChunk is one embedded span of a file.
+type indexChunk struct {
+	StartLine int
+	EndLine   int
+	Text      string
+	Vector    []float32
+}
+
+// indexedFile holds the chunks of one file and the hash they were computed from.
+type indexedFile struct {
+	Hash   string
+	Chunks []indexChunk
+}
+
+// semanticIndex is the on-disk index for one project directory and one embedder.
+type semanticIndex struct {
+	Root     string
+	Embedder string
+	Files    map[string]*indexedFile // keyed by slash-separated path relative to Root
+}
+
+// semanticHit is one result of a semantic search.
+type semanticHit struct {
+	File      string  `json:"file"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Score     float64 `json:"score"`
+	Text      string  `json:"text"`
+}
+
+var semanticMu sync.Mutex
+
+// newEmbedder returns the backend selected by EmbedderEnv.
+func newEmbedder(client *genai.Client) embedder {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv(EmbedderEnv)), "local") || client == nil {
+		return &hashEmbedder{dims: localEmbeddingDims}
+	}
+	return &geminiEmbedder{client: client, model: geminiEmbeddingModel}
+}
+
+// SemanticSearch brings the index for dir up to date and returns the topK chunks most
+// similar to query.
+func SemanticSearch(ctx context.Context, emb embedder, dir, query string, topK int) (map[string]interface{}, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+	if topK <= 0 {
+		topK = defaultSearchTopK
+	}
+	topK = min(topK, maxSearchTopK)
+
+	semanticMu.Lock()
+	defer semanticMu.Unlock()
+
+	idx, updated, skipped, err := updateSemanticIndex(ctx, emb, dir)
+	if err != nil {
+		return nil, err
+	}
+	qv, err := emb.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []semanticHit{}
+	for path, f := range idx.Files {
+		for _, c := range f.Chunks {
+			hits = append(hits, semanticHit{File: path, StartLine: c.StartLine, EndLine: c.EndLine, Score: dot(qv, c.Vector), Text: c.Text})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	result := map[string]interface{}{
+		"results":      hits,
+		"embedder":     emb.Name(),
+		"filesIndexed": len(idx.Files),
+		"filesUpdated": updated,
+	}
+	if skipped > 0 {
+		result["truncated"] = true
+		result["filesSkipped"] = skipped
+		result["note"] = fmt.Sprintf("the index is limited to %d chunks, so %d files were not indexed; "+
+			"search a subdirectory or use search_files to cover them", maxIndexChunks, skipped)
+	}
+	return result, nil
+}
+
+// updateSemanticIndex loads the index for dir, re-embeds files whose content hash changed,
+// drops deleted files and saves the result. Files are taken in walk order until the index
+// holds maxIndexChunks chunks. It returns the number of files re-embedded or removed and the
+// number left out because of the limit.
+func updateSemanticIndex(ctx context.Context, emb embedder, dir string) (*semanticIndex, int, int, error) {
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	if err := workspace.CheckRead(root); err != nil {
+		return nil, 0, 0, err
+	}
+	indexPath, err := semanticIndexPath(root, emb)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	idx := loadSemanticIndex(indexPath, root, emb)
+	access := workspaceFor(root)
+
+	seen := make(map[string]bool)
+	updated, skipped, total := 0, 0, 0
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		if d.Name() == ".git" || d.Name() == "node_modules" || access.Access(p, d.IsDir()) == accessHidden {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxIndexFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+		text, _, err := decodeText(data)
+		if err != nil {
+			return nil // binary
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		f, unchanged := idx.Files[rel]
+		unchanged = unchanged && f.Hash == hash
+		var chunks []indexChunk
+		if unchanged {
+			chunks = f.Chunks
+		} else {
+			chunks = chunkText(text)
+		}
+		if total+len(chunks) > maxIndexChunks {
+			skipped++
+			return nil
+		}
+		total += len(chunks)
+		seen[rel] = true
+		if unchanged {
+			return nil
+		}
+
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = rel + "\n" + c.Text
+		}
+		vectors, err := emb.EmbedDocuments(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i := range chunks {
+			chunks[i].Vector = vectors[i]
+		}
+		idx.Files[rel] = &indexedFile{Hash: hash, Chunks: chunks}
+		updated++
+		return nil
+	})
+	if err != nil {
+		// Keep whatever was embedded before the failure.
+		saveSemanticIndex(indexPath, idx)
+		return nil, 0, 0, err
+	}
+
+	for rel := range idx.Files {
+		if !seen[rel] {
+			delete(idx.Files, rel)
+			updated++
+		}
+	}
+	if updated > 0 {
+		saveSemanticIndex(indexPath, idx)
+	}
+	return idx, updated, skipped, nil
+}
+
+// chunkText splits text into overlapping windows of chunkLines lines.
+func chunkText(text string) []indexChunk {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var chunks []indexChunk
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		body := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(body) != "" {
+			chunks = append(chunks, indexChunk{StartLine: start + 1, EndLine: end, Text: body})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+func dot(a, b []float32) float64 {
+	var s float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
+
+// semanticIndexPath returns the index file for root and emb, creating its directory.
+func semanticIndexPath(root string, emb embedder) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	dir := filepath.Join(homeDir, IndexDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create index directory: %v", err)
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+"-"+emb.Name()+".gob"), nil
+}
+
+func loadSemanticIndex(path, root string, emb embedder) *semanticIndex {
+	idx := &semanticIndex{Root: root, Embedder: emb.Name(), Files: make(map[string]*indexedFile)}
+	f, err := os.Open(path)
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+	var stored semanticIndex
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil || stored.Root != root || stored.Embedder != emb.Name() {
+		log.Printf("Warning: rebuilding semantic index %s\n", path)
+		return idx
+	}
+	if stored.Files == nil {
+		stored.Files = idx.Files
+	}
+	return &stored
+}
+
+func saveSemanticIndex(path string, idx *semanticIndex) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		log.Printf("Warning: failed to save semantic index: %v\n", err)
+		return
+	}
+	if err := gob.NewEncoder(tmp).Encode(idx); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		log.Printf("Warning: failed to save semantic index: %v\n", err)
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Warning: failed to save semantic index: %v\n", err)
+	}
+}
+
+var semanticSearchSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"query": {
+			Type:        genai.TypeString,
+			Description: "A natural-language description of the code or text to find (e.g. 'where the API key is stored').",
+		},
+		"topK": {
+			Type:        genai.TypeInteger,
+			Description: "Number of chunks to return (default 5, max 50).",
+		},
+		"directory": {
+			Type:        genai.TypeString,
+			Description: "Project directory to search. Defaults to the current working directory.",
+		},
+	},
+	Required: []string{"query"},
+}
+
+var SemanticSearchTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "semantic_search",
+			Description: "Finds the parts of the project's text files most related in meaning to a query, using an embedding " +
+				"index that is updated automatically. Returns file, line span, score and text for each chunk.",
+			Parameters: semanticSearchSchema,
+		},
+	},
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingEmbedder wraps the hash embedder and records how many texts it embedded.
+type countingEmbedder struct {
+	hashEmbedder
+	embedded int
+}
+
+func (e *countingEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	e.embedded += len(texts)
+	return e.hashEmbedder.EmbedDocuments(ctx, texts)
+}
+
+// setupSemanticDir creates a project directory with files, points the workspace at it and
+// keeps the index out of the real home directory.
+func setupSemanticDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+	return dir
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := &hashEmbedder{dims: localEmbeddingDims}
+	a, _ := e.EmbedQuery(context.Background(), "readFileContent")
+	b, _ := e.EmbedQuery(context.Background(), "readFileContent")
+	if len(a) != localEmbeddingDims {
+		t.Fatalf("got %d dimensions, want %d", len(a), localEmbeddingDims)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("embedding is not deterministic")
+		}
+	}
+	if n := dot(a, a); math.Abs(n-1) > 1e-5 {
+		t.Errorf("embedding norm = %v, want 1", n)
+	}
+
+	// Identifier parts are shared with prose that uses the same words.
+	related, _ := e.EmbedQuery(context.Background(), "read the file content")
+	unrelated, _ := e.EmbedQuery(context.Background(), "database migration rollback")
+	if dot(a, related) <= dot(a, unrelated) {
+		t.Errorf("similarity to related text %v is not above unrelated text %v", dot(a, related), dot(a, unrelated))
+	}
+
+	empty, _ := e.EmbedQuery(context.Background(), "")
+	if dot(empty, empty) != 0 {
+		t.Error("empty text should have a zero vector")
+	}
+}
+
+func TestEmbeddingTokens(t *testing.T) {
+	got := embeddingTokens("parseHTTPResponse user_id x")
+	want := []string{"parsehttpresponse", "parse", "httpresponse", "user_id", "user", "id"}
+	if len(got) != len(want) {
+		t.Fatalf("embeddingTokens = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("embeddingTokens = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSemanticIndexIncrementalUpdate(t *testing.T) {
+	dir := setupSemanticDir(t, map[string]string{
+		"a.go":       "package a\n\nfunc Alpha() {}\n",
+		"b.go":       "package a\n\nfunc Beta() {}\n",
+		"data.bin":   "\x00\x01\x02\x03",
+		".gitignore": "ignored.go\n",
+		"ignored.go": "package a\n\nfunc Ignored() {}\n",
+	})
+	emb := &countingEmbedder{hashEmbedder: hashEmbedder{dims: localEmbeddingDims}}
+	ctx := context.Background()
+
+	idx, updated, _, err := updateSemanticIndex(ctx, emb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 3 { // a.go, b.go, .gitignore
+		t.Errorf("first update re-embedded %d files, want 3", updated)
+	}
+	if _, ok := idx.Files["ignored.go"]; ok {
+		t.Error("ignored file was indexed")
+	}
+	if _, ok := idx.Files["data.bin"]; ok {
+		t.Error("binary file was indexed")
+	}
+
+	emb.embedded = 0
+	if _, updated, _, err = updateSemanticIndex(ctx, emb, dir); err != nil {
+		t.Fatal(err)
+	}
+	if updated != 0 || emb.embedded != 0 {
+		t.Errorf("unchanged tree: updated %d files and embedded %d chunks, want none", updated, emb.embedded)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "a.go"), "package a\n\nfunc AlphaChanged() {}\n")
+	if err := os.Remove(filepath.Join(dir, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	emb.embedded = 0
+	idx, updated, _, err = updateSemanticIndex(ctx, emb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 || emb.embedded != 1 {
+		t.Errorf("after one change and one delete: updated %d files and embedded %d chunks, want 2 and 1", updated, emb.embedded)
+	}
+	if _, ok := idx.Files["b.go"]; ok {
+		t.Error("deleted file is still indexed")
+	}
+}
+
+func TestSemanticIndexChunkLimit(t *testing.T) {
+	dir := setupSemanticDir(t, map[string]string{
+		"a.txt": "alpha\n",
+		"b.txt": strings.Repeat("beta\n", chunkLines+chunkOverlap+20), // two chunks
+		"c.txt": "gamma\n",
+	})
+	old := maxIndexChunks
+	maxIndexChunks = 3
+	t.Cleanup(func() { maxIndexChunks = old })
+	emb := &countingEmbedder{hashEmbedder: hashEmbedder{dims: localEmbeddingDims}}
+	ctx := context.Background()
+
+	idx, updated, skipped, err := updateSemanticIndex(ctx, emb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 || skipped != 1 || emb.embedded != 3 {
+		t.Errorf("updated %d files, skipped %d and embedded %d chunks; want 2, 1 and 3", updated, skipped, emb.embedded)
+	}
+	if _, ok := idx.Files["c.txt"]; ok {
+		t.Error("file beyond the limit was indexed")
+	}
+
+	result, err := SemanticSearch(ctx, emb, dir, "gamma", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["truncated"] != true || result["filesSkipped"] != 1 || !strings.Contains(result["note"].(string), "limited to 3 chunks") {
+		t.Errorf("truncation not reported: %v", result)
+	}
+
+	// Raising the limit embeds only the file that was left out.
+	maxIndexChunks = 10
+	emb.embedded = 0
+	idx, updated, skipped, err = updateSemanticIndex(ctx, emb, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 1 || skipped != 0 || emb.embedded != 1 || len(idx.Files) != 3 {
+		t.Errorf("updated %d files, skipped %d, embedded %d chunks and indexed %d files; want 1, 0, 1 and 3", updated, skipped, emb.embedded, len(idx.Files))
+	}
+	result, err = SemanticSearch(ctx, emb, dir, "gamma", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result["truncated"]; ok {
+		t.Errorf("complete index reported as truncated: %v", result)
+	}
+}
+
+func TestSemanticSearchRanking(t *testing.T) {
+	dir := setupSemanticDir(t, map[string]string{
+		"auth.go":   "package app\n\n// checkPassword compares a password with its stored hash.\nfunc checkPassword(hash, password string) bool { return false }\n",
+		"render.go": "package app\n\n// renderTemplate writes the page template to the response.\nfunc renderTemplate(name string) {}\n",
+		"queue.go":  "package app\n\n// enqueueJob adds a background job to the worker queue.\nfunc enqueueJob(job string) {}\n",
+	})
+	emb := &hashEmbedder{dims: localEmbeddingDims}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"where is the password hash checked", "auth.go"},
+		{"render page template", "render.go"},
+		{"background worker job queue", "queue.go"},
+	}
+	for _, tt := range tests {
+		result, err := SemanticSearch(context.Background(), emb, dir, tt.query, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits := result["results"].([]semanticHit)
+		if len(hits) != 2 {
+			t.Fatalf("%q: got %d results, want topK 2", tt.query, len(hits))
+		}
+		if hits[0].File != tt.want {
+			t.Errorf("%q: top result %s, want %s", tt.query, hits[0].File, tt.want)
+		}
+		if hits[0].Score < hits[1].Score {
+			t.Errorf("%q: results not sorted by score", tt.query)
+		}
+	}
+
+	if _, err := SemanticSearch(context.Background(), emb, dir, "  ", 5); err == nil {
+		t.Error("empty query should fail")
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	var text string
+	for i := 0; i < chunkLines*2; i++ {
+		text += "line\n"
+	}
+	chunks := chunkText(text)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want at least 2", len(chunks))
+	}
+	if chunks[0].StartLine != 1 || chunks[0].EndLine != chunkLines {
+		t.Errorf("first chunk spans %d-%d, want 1-%d", chunks[0].StartLine, chunks[0].EndLine, chunkLines)
+	}
+	if chunks[1].StartLine != chunkLines-chunkOverlap+1 {
+		t.Errorf("second chunk starts at %d, want %d", chunks[1].StartLine, chunkLines-chunkOverlap+1)
+	}
+	if last := chunks[len(chunks)-1]; last.EndLine != chunkLines*2 {
+		t.Errorf("last chunk ends at %d, want %d", last.EndLine, chunkLines*2)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// magicSignature maps leading bytes at a given offset to a MIME type.
+type magicSignature struct {
+	offset int
+	magic  []byte
+	mime   string
+}
+
+var magicSignatures = []magicSignature{
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte{0xFF, 0xD8, 0xFF}, "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("OggS"), "audio/ogg"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte{0x1A, 0x45, 0xDF, 0xA3}, "video/x-matroska"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte{0x1F, 0x8B}, "application/gzip"},
+}
+
+// ftypBrands maps the brands of ISO base media files (MP4, QuickTime, HEIF and AVIF) to MIME types.
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+}
+
+// utfBOMs are the byte order marks decodeText recognises.
+var utfBOMs = [][]byte{{0xEF, 0xBB, 0xBF}, {0xFF, 0xFE}, {0xFE, 0xFF}}
+
+// detectMIME identifies a file's MIME type from its leading bytes, falling back to the
+// extension and then to net/http's sniffer.
+func detectMIME(path string, head []byte) string {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	// A BOM makes the file text; FF FE would otherwise pass for an MPEG frame header.
+	for _, bom := range utfBOMs {
+		if bytes.HasPrefix(head, bom) {
+			return textMIME(ext)
+		}
+	}
+	if len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")) {
+		switch string(head[8:12]) {
+		case "WEBP":
+			return "image/webp"
+		case "WAVE":
+			return "audio/wav"
+		case "AVI ":
+			return "video/x-msvideo"
+		}
+	}
+	if t := ftypMIME(head); t != "" {
+		return t
+	}
+	if isBMP(head) {
+		return "image/bmp"
+	}
+	for _, sig := range magicSignatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			if sig.mime == "application/zip" {
+				// Office documents are zip containers; trust the extension for the specific type.
+				if t := mime.TypeByExtension(ext); t != "" {
+					return t
+				}
+			}
+			if sig.mime == "video/x-matroska" && ext == ".webm" {
+				return "video/webm"
+			}
+			return sig.mime
+		}
+	}
+
+	if _, _, err := decodeText(head); err == nil {
+		return textMIME(ext)
+	}
+	if isMPEGFrame(head) {
+		return "audio/mpeg"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// textMIME returns the MIME type for a text file with extension ext.
+func textMIME(ext string) string {
+	if t := mime.TypeByExtension(ext); strings.HasPrefix(t, "text/") || strings.Contains(t, "json") || strings.Contains(t, "xml") || strings.Contains(t, "javascript") {
+		return t
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// ftypMIME returns the type of an ISO base media file from the brands in its ftyp box, or ""
+// if head doesn't start with one. HEIF and AVIF images often have a generic major brand and
+// name the specific format only among the compatible brands.
+func ftypMIME(head []byte) string {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return ""
+	}
+	major := string(head[8:12])
+	if t := ftypBrands[major]; t != "" && major != "mif1" && major != "msf1" {
+		return t
+	}
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	for i := 16; i+4 <= min(size, len(head)); i += 4 {
+		switch t := ftypBrands[string(head[i:i+4])]; t {
+		case "image/avif", "image/heic":
+			return t
+		}
+	}
+	if t := ftypBrands[major]; t != "" {
+		return t
+	}
+	return "video/mp4"
+}
+
+// isBMP checks the BMP file header: "BM", reserved bytes that are zero and a known DIB header
+// size, so text starting with "BM" isn't taken for an image.
+func isBMP(head []byte) bool {
+	if len(head) < 18 || head[0] != 'B' || head[1] != 'M' {
+		return false
+	}
+	if binary.LittleEndian.Uint32(head[6:10]) != 0 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(head[14:18]) {
+	case 12, 16, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// isMPEGFrame reports whether head starts with a valid MPEG audio frame header: the frame
+// sync bits followed by a known version, layer, bitrate and sample rate.
+func isMPEGFrame(head []byte) bool {
+	if len(head) < 4 || head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := head[1] >> 3 & 0x3
+	layer := head[1] >> 1 & 0x3
+	bitrate := head[2] >> 4
+	sampleRate := head[2] >> 2 & 0x3
+	return version != 1 && layer != 0 && bitrate != 0 && bitrate != 0xF && sampleRate != 3
+}
+
+// sniffFile reads the start of path and returns its MIME type.
+func sniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return detectMIME(path, head[:n]), nil
+}
+
+// mediaCategory returns "Image", "Video", "Audio" or "PDF Document" for MIME types the media
+// analysis path handles, or "" otherwise.
+func mediaCategory(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "Image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "Video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "Audio"
+	case mimeType == "application/pdf":
+		return "PDF Document"
+	}
+	return ""
+}
+
+// defaultMediaPrompts are used by open_file when the model does not supply a prompt.
+var defaultMediaPrompts = map[string]string{
+	"Image":        "Describe this image in detail, including any visible text.",
+	"Video":        "Describe the contents of this video in detail, including any speech and on-screen text.",
+	"Audio":        "Transcribe this audio and summarise its contents.",
+	"PDF Document": "Extract and summarise the contents of this document, keeping headings and important details.",
+}
+
+// OpenFile returns the text of text files and routes images, PDFs, audio and video through
+// media analysis, so the model doesn't have to choose between ReadFile and read_file_content.
+func OpenFile(ctx context.Context, client *genai.Client, filePath, prompt string, startLine, endLine int) (map[string]interface{}, error) {
+	fullPath, err := resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := workspace.CheckRead(fullPath); err != nil {
+		return nil, err
+	}
+	mimeType, err := sniffFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	result := map[string]interface{}{"path": fullPath, "mimeType": mimeType}
+	category := mediaCategory(mimeType)
+	if category == "PDF Document" {
+		// PDFs with a text layer are read locally; scanned or oversized ones are analysed by the model.
+		if data, _, partial, err := readFileLimited(fullPath, maxReadFileInput); err == nil && !partial {
+			if doc, err := extractDocument(data); err == nil && !doc.Sparse {
+				if content, err := numberLines(doc.Text, documentNote(doc), startLine, endLine); err == nil {
+					result["kind"] = category
+					result["content"] = content
+					return result, nil
+				}
+			}
+		}
+	}
+	if category != "" {
+		if strings.TrimSpace(prompt) == "" {
+			prompt = defaultMediaPrompts[category]
+		}
+		analysis, err := ReadFileContentWithAI(ctx, client, []string{fullPath}, prompt)
+		if err != nil {
+			return nil, err
+		}
+		result["kind"] = category
+		result["analysis"] = analysis
+		return result, nil
+	}
+
+	content, err := ReadFile(fullPath, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+	result["kind"] = "Text"
+	result["content"] = content
+	return result, nil
+}
+
+var openFileSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"filePath": {
+			Type:        genai.TypeString,
+			Description: "The name or path of the file to open. Relative paths are resolved against the current working directory.",
+		},
+		"prompt": {
+			Type:        genai.TypeString,
+			Description: "For images, PDFs, audio and video: what to analyse. A sensible default is used if omitted. Ignored for text files.",
+		},
+		"startLine": {
+			Type:        genai.TypeInteger,
+			Description: "For text files: optional first line to return (1-based).",
+		},
+		"endLine": {
+			Type:        genai.TypeInteger,
+			Description: "For text files: optional last line to return (inclusive).",
+		},
+	},
+	Required: []string{"filePath"},
+}
+
+var OpenFileTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{
+		{
+			Name: "open_file",
+			Description: "Opens any file. Detects its type from its contents: text files are returned with line numbers, " +
+				"and images, PDFs, audio and video are analysed with AI. Use this when unsure which reader fits a file.",
+			Parameters: openFileSchema,
+		},
+	},
+}
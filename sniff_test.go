@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ftypBox builds the start of an ISO base media file with the given brands.
+func ftypBox(major string, compatible ...string) []byte {
+	box := make([]byte, 16, 16+4*len(compatible))
+	binary.BigEndian.PutUint32(box[:4], uint32(16+4*len(compatible)))
+	copy(box[4:], "ftyp"+major)
+	for _, b := range compatible {
+		box = append(box, b...)
+	}
+	return append(box, "\x00\x00\x00\x08free"...)
+}
+
+// bmpHeader builds a BMP file header followed by a DIB header of the given size.
+func bmpHeader(dibSize uint32) []byte {
+	h := make([]byte, 54)
+	copy(h, "BM")
+	binary.LittleEndian.PutUint32(h[2:6], 54)
+	binary.LittleEndian.PutUint32(h[10:14], 54)
+	binary.LittleEndian.PutUint32(h[14:18], dibSize)
+	return h
+}
+
+func TestDetectMIME(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		head []byte
+		want string
+	}{
+		{"png", "x", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"jpeg", "photo.jpg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10}, "image/jpeg"},
+		{"pdf", "x", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"webp", "x", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"wav", "x", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), "audio/wav"},
+		{"mp3 with id3", "x", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"mp3 frame", "x", []byte{0xFF, 0xFB, 0x90, 0x64, 0x00, 0x00, 0x00, 0x00}, "audio/mpeg"},
+		{"invalid mpeg header", "x", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x01, 0x02, 0x03}, "application/octet-stream"},
+		{"bmp", "x", bmpHeader(40), "image/bmp"},
+		{"bmp v5", "x", bmpHeader(124), "image/bmp"},
+		{"text starting with BM", "notes", []byte("BMW service notes\nOil changed at 30000 km\n"), "text/plain; charset=utf-8"},
+		{"mp4", "x", ftypBox("isom", "isom", "mp41"), "video/mp4"},
+		{"quicktime", "x", ftypBox("qt  ", "qt  "), "video/quicktime"},
+		{"m4a", "x", ftypBox("M4A ", "M4A ", "mp42"), "audio/mp4"},
+		{"heic", "x", ftypBox("heic", "mif1", "heic"), "image/heic"},
+		{"heif", "x", ftypBox("mif1", "mif1"), "image/heif"},
+		{"avif", "x", ftypBox("avif", "mif1", "avif"), "image/avif"},
+		{"avif with generic brand", "x", ftypBox("mif1", "mif1", "miaf", "avif"), "image/avif"},
+		{"utf-8 bom", "index.html", []byte("\xEF\xBB\xBF<p>hi</p>\n"), "text/html; charset=utf-8"},
+		{"utf-16le bom", "notes", []byte("\xFF\xFEh\x00i\x00\n\x00"), "text/plain; charset=utf-8"},
+		{"utf-16be bom", "data.xml", []byte("\xFE\xFF\x00<\x00a\x00>"), "text/xml; charset=utf-8"},
+		{"plain text", "Makefile", []byte("package main\n"), "text/plain; charset=utf-8"},
+		{"json", "config.json", []byte(`{"a": 1}`), "application/json"},
+		{"zip", "x", []byte("PK\x03\x04\x14\x00"), "application/zip"},
+		{"webm", "clip.webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, "video/webm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectMIME(tt.path, tt.head); got != tt.want {
+				t.Errorf("detectMIME(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMPEGFrame(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want bool
+	}{
+		{[]byte{0xFF, 0xFB, 0x90, 0x64}, true},  // MPEG-1 layer III, 128 kbit/s, 44.1 kHz
+		{[]byte{0xFF, 0xF3, 0x48, 0xC4}, true},  // MPEG-2 layer III
+		{[]byte{0xFF, 0xEB, 0x90, 0x64}, false}, // reserved version
+		{[]byte{0xFF, 0xF9, 0x90, 0x64}, false}, // reserved layer
+		{[]byte{0xFF, 0xFB, 0xF0, 0x64}, false}, // bad bitrate
+		{[]byte{0xFF, 0xFB, 0x9C, 0x64}, false}, // reserved sample rate
+		{[]byte{0xFF, 0xFB}, false},
+	}
+	for _, tt := range tests {
+		if got := isMPEGFrame(tt.head); got != tt.want {
+			t.Errorf("isMPEGFrame(% x) = %v, want %v", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestOpenFileReadsLocally(t *testing.T) {
+	dir := t.TempDir()
+	pdf := buildTestPDF([]string{
+		"BT /F1 12 Tf 72 720 Td (Quarterly report for the northern region, covering revenue, costs and headcount for every office) Tj ET",
+		"BT /F1 12 Tf 72 720 Td (Second page with the sales figures for the year, broken down by month, product line and customer) Tj ET",
+	}, false)
+	writeFiles(t, dir, map[string]string{
+		"report.pdf": string(pdf),
+		"notes.txt":  "one\ntwo\nthree\n",
+	})
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	tests := []struct {
+		file               string
+		startLine, endLine int
+		kind               string
+		contains           []string
+	}{
+		{"report.pdf", 0, 0, "PDF Document", []string{"Quarterly report", "sales figures", "[text extracted from PDF, 2 pages]"}},
+		{"report.pdf", 3, 4, "PDF Document", []string{"sales figures", "[showing lines 3-4 of 4]"}},
+		{"notes.txt", 2, 2, "Text", []string{"     2\ttwo\n", "[showing lines 2-2 of 3]"}},
+	}
+	for _, tt := range tests {
+		// A nil client fails the test if the file is sent for analysis instead of read locally.
+		res, err := OpenFile(context.Background(), nil, filepath.Join(dir, tt.file), "", tt.startLine, tt.endLine)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		content, _ := res["content"].(string)
+		if res["kind"] != tt.kind {
+			t.Errorf("%s: kind %v, want %s", tt.file, res["kind"], tt.kind)
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s lines %d-%d: %q does not contain %q", tt.file, tt.startLine, tt.endLine, content, want)
+			}
+		}
+	}
+}
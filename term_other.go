@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// isTerminal always reports false, so input is read line by line without tab completion.
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// sniffLen is how many leading bytes are inspected when guessing a file's encoding.
+const sniffLen = 8000
+
+var errBinaryFile = errors.New("file appears to be binary")
+
+// readFileLimited reads at most limit bytes of path without loading the rest into memory. It
+// returns the file's full size and whether the data was cut short; a cut is moved back to the
+// last newline so no line or multi-byte character is split.
+func readFileLimited(path string, limit int64) ([]byte, int64, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to access file: %v", err)
+	}
+	if info.IsDir() {
+		return nil, 0, false, fmt.Errorf("%s is a directory", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to read file: %v", err)
+	}
+	if int64(len(data)) <= limit {
+		return data, info.Size(), false, nil
+	}
+	data = data[:limit]
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[:i+1]
+	}
+	return data, info.Size(), true, nil
+}
+
+// decodeText converts raw file bytes to a UTF-8 string and reports the source encoding.
+// UTF-16 (with or without a BOM) and Latin-1 are converted; anything containing NUL bytes
+// that is not UTF-16 is treated as binary.
+func decodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "utf-8", nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian), "utf-16le", nil
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian), "utf-16be", nil
+	}
+
+	head := data
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		if order, ok := guessUTF16(head); ok {
+			name := "utf-16le"
+			if order == binary.BigEndian {
+				name = "utf-16be"
+			}
+			return decodeUTF16(data, order), name, nil
+		}
+		return "", "", errBinaryFile
+	}
+
+	if utf8.Valid(data) {
+		return string(data), "utf-8", nil
+	}
+	if looksBinary(head) {
+		return "", "", errBinaryFile
+	}
+	return decodeLatin1(data), "latin-1", nil
+}
+
+// guessUTF16 detects BOM-less UTF-16 by checking whether NUL bytes sit almost
+// exclusively at even or odd offsets, as they do for mostly-ASCII text.
+func guessUTF16(head []byte) (binary.ByteOrder, bool) {
+	var even, odd int
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	pairs := len(head) / 2
+	if pairs == 0 {
+		return nil, false
+	}
+	switch {
+	case odd*10 >= pairs*7 && even*20 < pairs:
+		return binary.LittleEndian, true
+	case even*10 >= pairs*7 && odd*20 < pairs:
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// looksBinary reports whether too many bytes are control characters for the data to be text.
+func looksBinary(head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	control := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1b {
+			control++
+		}
+	}
+	return control*10 > len(head)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, with bom prepended.
+func encodeUTF16(s string, order binary.ByteOrder, bom []byte) []byte {
+	data := append([]byte{}, bom...)
+	for _, u := range utf16.Encode([]rune(s)) {
+		data = order.(binary.AppendByteOrder).AppendUint16(data, u)
+	}
+	return data
+}
+
+func TestDecodeText(t *testing.T) {
+	const text = "héllo\nwörld ✓\n"
+	allBytes := make([]byte, 512)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     string
+		encoding string
+		binary   bool
+	}{
+		{"utf-8", []byte(text), text, "utf-8", false},
+		{"utf-8 with bom", append([]byte{0xEF, 0xBB, 0xBF}, text...), text, "utf-8", false},
+		{"utf-16le with bom", encodeUTF16(text, binary.LittleEndian, []byte{0xFF, 0xFE}), text, "utf-16le", false},
+		{"utf-16be with bom", encodeUTF16(text, binary.BigEndian, []byte{0xFE, 0xFF}), text, "utf-16be", false},
+		{"utf-16le without bom", encodeUTF16(text, binary.LittleEndian, nil), text, "utf-16le", false},
+		{"utf-16be without bom", encodeUTF16(text, binary.BigEndian, nil), text, "utf-16be", false},
+		{"latin-1", []byte("caf\xe9 cr\xe8me\n"), "café crème\n", "latin-1", false},
+		{"empty", nil, "", "utf-8", false},
+		{"nul bytes", allBytes, "", "", true},
+		{"control characters", []byte("\x01\x02\x03\x04\xff\x05\x06"), "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding, err := decodeText(tt.data)
+			if tt.binary {
+				if err != errBinaryFile {
+					t.Fatalf("got %q (%s), %v; want errBinaryFile", got, encoding, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || encoding != tt.encoding {
+				t.Errorf("got %q (%s), want %q (%s)", got, encoding, tt.want, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := map[string]bool{
+		"":                         false,
+		"plain text\n":             false,
+		"tabs\tand\r\nescapes\x1b": false,
+		"\x01\x02\x03 mostly ctl":  true,
+		"one \x07 bell in a line of ordinary text": false,
+	}
+	for head, want := range tests {
+		if got := looksBinary([]byte(head)); got != want {
+			t.Errorf("looksBinary(%q) = %v, want %v", head, got, want)
+		}
+	}
+}
+
+func TestReadFileLimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("first line\nsecond line\nthird"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		limit   int64
+		want    string
+		partial bool
+	}{
+		{100, "first line\nsecond line\nthird", false},
+		{28, "first line\nsecond line\nthird", false},
+		{20, "first line\n", true},
+		{5, "first", true}, // no newline to back up to
+	}
+	for _, tt := range tests {
+		data, size, partial, err := readFileLimited(path, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want || partial != tt.partial || size != 28 {
+			t.Errorf("limit %d: got %q, size %d, partial %v; want %q, size 28, partial %v", tt.limit, data, size, partial, tt.want, tt.partial)
+		}
+	}
+	if _, _, _, err := readFileLimited(filepath.Dir(path), 10); err == nil {
+		t.Error("reading a directory succeeded")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	old := workspace
+	workspace = newWorkspaceAccess(dir)
+	t.Cleanup(func() { workspace = old })
+
+	var ten strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&ten, "line %d\r\n", i)
+	}
+	long := strings.Repeat(strings.Repeat("x", 99)+"\n", 3000)
+	allBytes := make([]byte, 512)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+	files := map[string][]byte{
+		"ten.txt":   []byte(ten.String()),
+		"long.txt":  []byte(long),
+		"utf16.txt": encodeUTF16("hello\nworld\n", binary.LittleEndian, []byte{0xFF, 0xFE}),
+		"data.bin":  allBytes,
+		"empty.txt": nil,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		start, end int
+		want       []string // in the output
+		unwanted   []string // not in the output
+		err        string   // in the error
+	}{
+		{name: "whole file", file: "ten.txt", want: []string{"     1\tline 1\n", "    10\tline 10\n"}, unwanted: []string{"\r", "[showing"}},
+		{name: "line range", file: "ten.txt", start: 3, end: 5, want: []string{"     3\tline 3\n", "     5\tline 5\n", "[showing lines 3-5 of 10]"}, unwanted: []string{"line 2\n", "line 6\n"}},
+		{name: "end past the end", file: "ten.txt", start: 9, end: 50, want: []string{"    10\tline 10\n", "[showing lines 9-10 of 10]"}},
+		{name: "start past the end", file: "ten.txt", start: 11, err: "past the end of the file (10 lines)"},
+		{name: "start after end", file: "ten.txt", start: 5, end: 4, err: "startLine 5 is after endLine 4"},
+		{name: "output cap", file: "long.txt", want: []string{"[output truncated at line 957 of 3000; call ReadFile again with startLine=958]"}},
+		{name: "continuing after the cap", file: "long.txt", start: 2990, want: []string{"  3000\t", "[showing lines 2990-3000 of 3000]"}},
+		{name: "utf-16", file: "utf16.txt", want: []string{"     2\tworld\n", "[decoded from utf-16le]"}},
+		{name: "empty file", file: "empty.txt"},
+		{name: "binary file", file: "data.bin", err: "use read_file_content"},
+		{name: "missing file", file: "missing.txt", err: "failed to access file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ReadFile(filepath.Join(dir, tt.file), tt.start, tt.end)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) > maxReadFileBytes+200 {
+				t.Errorf("output is %d bytes, limit %d", len(out), maxReadFileBytes)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output lacks %q:\n%.500s", w, out)
+				}
+			}
+			for _, u := range tt.unwanted {
+				if strings.Contains(out, u) {
+					t.Errorf("output contains %q:\n%.500s", u, out)
+				}
+			}
+		})
+	}
+}
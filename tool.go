@@ -38,30 +38,19 @@ var FileTool = &genai.Tool{
 }
 
 func WriteDesktop(fileName string, content string) error {
-	var fullPath string
-
-	// If fileName is an absolute path or contains a directory separator, use it as-is.
-	// Otherwise, assume it's just a file name and use the current working directory.
-	if filepath.IsAbs(fileName) || strings.Contains(fileName, string(os.PathSeparator)) {
-		fullPath = fileName
-	} else {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get current working directory: %v", err)
-		}
-		fullPath = filepath.Join(cwd, fileName)
-	}
-
-	// Replace literal "\n" with actual newlines in the content.
-	formattedContent := strings.ReplaceAll(content, "\\n", "\n")
-
-	// Write the file, using 0644 permissions.
-	// This will override the file if it already exists.
-	err := os.WriteFile(fullPath, []byte(formattedContent), 0644)
+	// Relative names are resolved against the current working directory.
+	fullPath, err := resolvePath(fileName)
 	if err != nil {
-		return fmt.Errorf("failed to write file at '%s': %v", fullPath, err)
+		return err
 	}
-	return nil
+	if err := workspace.CheckWrite(fullPath); err != nil {
+		return err
+	}
+
+	// The content is written exactly as given: function-call arguments are already decoded JSON,
+	// so a literal backslash-n (as in a Go or JSON string) must be kept.
+	// This will override the file if it already exists; the old contents are kept in the undo journal.
+	return recordedWrite(fullPath, []byte(content), 0644, "file_write")
 }
 
 //	func scanDirectory(dir string) (string, error) {
@@ -185,45 +174,32 @@ func WriteDesktop(fileName string, content string) error {
 //	return patterns, nil
 //}
 
-// isIgnored checks if a file matches any pattern in .fileignore
-func isIgnored(path string, info os.FileInfo, patterns []string) bool {
-	for _, pattern := range patterns {
-		// Match directories
-		if info.IsDir() && strings.HasSuffix(pattern, "/") {
-			if strings.HasPrefix(path, strings.TrimSuffix(pattern, "/")) {
-				return true
-			}
-		}
-
-		// Match wildcards (e.g., *.jpg, *.gz)
-		matched, err := filepath.Match(pattern, filepath.Base(path))
-		if err == nil && matched {
-			return true
-		}
-
-		// Match exact filename
-		if pattern == path {
-			return true
-		}
-	}
-	return false
-}
-
-// detectFileType returns the file type based on the extension
+// detectFileType returns the file type based on the extension, sniffing the file's
+// contents when the extension is missing or not recognised.
 func detectFileType(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
 	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif":
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".heic":
 		return "Image"
-	case ".mp4", ".avi", ".mov", ".mkv":
+	case ".mp4", ".avi", ".mov", ".mkv", ".webm", ".m4v":
 		return "Video"
-	case ".mp3", ".wav", ".ogg":
+	case ".mp3", ".wav", ".ogg", ".flac", ".m4a", ".aac":
 		return "Audio"
 	case ".pdf":
 		return "PDF Document"
-	default:
+	}
+
+	mimeType, err := sniffFile(path)
+	if err != nil {
 		return "Unknown"
 	}
+	if category := mediaCategory(mimeType); category != "" {
+		return category
+	}
+	if strings.HasPrefix(mimeType, "text/") {
+		return "Text"
+	}
+	return "Unknown"
 }
 
 var scanDirectorySchema = &genai.Schema{
@@ -231,7 +207,15 @@ var scanDirectorySchema = &genai.Schema{
 	Properties: map[string]*genai.Schema{
 		"directory": {
 			Type:        genai.TypeString,
-			Description: "The absolute directory path to scan. This field is required.",
+			Description: "The directory path to scan. Relative paths are resolved against the current working directory. This field is required.",
+		},
+		"depth": {
+			Type:        genai.TypeInteger,
+			Description: "How many directory levels to descend (default 3). Directories below the limit are marked as truncated.",
+		},
+		"maxEntries": {
+			Type:        genai.TypeInteger,
+			Description: "Maximum number of files and directories to return (default 500).",
 		},
 	},
 	Required: []string{"directory"},
@@ -240,9 +224,10 @@ var scanDirectorySchema = &genai.Schema{
 var ScanTool = &genai.Tool{
 	FunctionDeclarations: []*genai.FunctionDeclaration{
 		{
-			Name:        "scan_directory",
-			Description: "Scans the specified directory and lists all files.",
-			Parameters:  scanDirectorySchema,
+			Name: "scan_directory",
+			Description: "Scans the specified directory and returns a JSON tree of its files and folders " +
+				"with sizes, modification times and file types, skipping anything excluded by .fileignore.",
+			Parameters: scanDirectorySchema,
 		},
 	},
 }
@@ -256,22 +241,130 @@ var ScanTool = &genai.Tool{
 //"path/filepath"
 //)
 
-// ReadFile reads the content of a given file, assuming the current directory if only a filename is provided
-func ReadFile(filePath string) (string, error) {
-	if !filepath.IsAbs(filePath) {
-		cwd, err := os.Getwd()
+// resolvePath turns a bare file name or relative path into an absolute path under the current working directory.
+func resolvePath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+	return filepath.Join(cwd, path), nil
+}
+
+const (
+	// maxReadFileBytes caps how much text ReadFile sends back in a single call.
+	maxReadFileBytes = 100 * 1024
+	// maxReadFileInput caps how much of a file ReadFile loads into memory.
+	maxReadFileInput = 32 * 1024 * 1024
+)
+
+// ReadFile reads the content of a given file, assuming the current directory if only a filename is provided.
+// startLine and endLine are 1-based and inclusive; pass 0 to read from the beginning or to the end of the file.
+// Every returned line is prefixed with its line number.
+func ReadFile(filePath string, startLine, endLine int) (string, error) {
+	filePath, err := resolvePath(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err := workspace.CheckRead(filePath); err != nil {
+		return "", err
+	}
+
+	data, size, partial, err := readFileLimited(filePath, maxReadFileInput)
+	if err != nil {
+		return "", err
+	}
+
+	// PDFs and office documents are read through local text extraction. They are checked
+	// first because decodeText can take a PDF for latin-1 text.
+	var text, note string
+	if partial && looksLikeDocument(data) {
+		return "", fmt.Errorf("%s is too large to read (%d bytes, limit %d)", filePath, size, maxReadFileInput)
+	}
+	doc, err := extractDocument(data)
+	switch {
+	case err == nil:
+		text, note = doc.Text, documentNote(doc)
+	case err != errNotDocument:
+		return "", fmt.Errorf("%s: %v; use read_file_content to analyze it instead", filePath, err)
+	default:
+		var encoding string
+		text, encoding, err = decodeText(data)
 		if err != nil {
-			return "", fmt.Errorf("failed to get current directory: %v", err)
+			if partial {
+				return "", fmt.Errorf("%s is too large to read (%d bytes, limit %d)", filePath, size, maxReadFileInput)
+			}
+			return "", fmt.Errorf("%s: %v; use read_file_content to analyze binary or media files", filePath, err)
+		}
+		if encoding != "utf-8" {
+			note = "decoded from " + encoding
+		}
+	}
+	if partial {
+		if note != "" {
+			note += "; "
 		}
-		filePath = filepath.Join(cwd, filePath) // Ensure it resolves correctly
+		note += fmt.Sprintf("only the first %d of %d bytes were read; use search_files to find text further on", len(data), size)
 	}
+	return numberLines(text, note, startLine, endLine)
+}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+// documentNote says where the text of an extracted document came from.
+func documentNote(doc *extractedDocument) string {
+	note := "text extracted from " + doc.Format
+	if doc.Pages > 0 {
+		note += fmt.Sprintf(", %d pages", doc.Pages)
+	}
+	if doc.Sparse {
+		note += "; little text was found, so this may be a scanned or image-based document: use read_file_content to analyze it visually"
+	}
+	return note
+}
+
+// numberLines returns lines startLine to endLine of text, each prefixed with its line number,
+// capped at maxReadFileBytes and followed by note and a hint for reading on.
+func numberLines(text, note string, startLine, endLine int) (string, error) {
+	lines := strings.Split(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	total := len(lines)
+
+	if startLine <= 0 {
+		startLine = 1
+	}
+	if endLine <= 0 || endLine > total {
+		endLine = total
+	}
+	if total > 0 && startLine > total {
+		return "", fmt.Errorf("startLine %d is past the end of the file (%d lines)", startLine, total)
+	}
+	if startLine > endLine && total > 0 {
+		return "", fmt.Errorf("startLine %d is after endLine %d", startLine, endLine)
 	}
 
-	return string(data), nil
+	var out strings.Builder
+	last := startLine - 1
+	for i := startLine; i <= endLine; i++ {
+		line := fmt.Sprintf("%6d\t%s\n", i, strings.TrimSuffix(lines[i-1], "\r"))
+		if out.Len()+len(line) > maxReadFileBytes {
+			break
+		}
+		out.WriteString(line)
+		last = i
+	}
+
+	if note != "" {
+		out.WriteString(fmt.Sprintf("[%s]\n", note))
+	}
+	if last < endLine {
+		out.WriteString(fmt.Sprintf("[output truncated at line %d of %d; call ReadFile again with startLine=%d]\n", last, total, last+1))
+	} else if startLine > 1 || endLine < total {
+		out.WriteString(fmt.Sprintf("[showing lines %d-%d of %d]\n", startLine, endLine, total))
+	}
+	return out.String(), nil
 }
 
 var ReadFileSchema = &genai.Schema{
@@ -281,6 +374,14 @@ var ReadFileSchema = &genai.Schema{
 			Type:        genai.TypeString,
 			Description: "The name or path of the file to be read. If only a filename is provided, the file will be searched in the current working directory.",
 		},
+		"startLine": {
+			Type:        genai.TypeInteger,
+			Description: "Optional 1-based line number to start reading from. Defaults to the first line.",
+		},
+		"endLine": {
+			Type:        genai.TypeInteger,
+			Description: "Optional 1-based line number to stop reading at (inclusive). Defaults to the last line.",
+		},
 	},
 	Required: []string{"fileName"}, // Change "directory" to "fileName"
 }
@@ -288,9 +389,11 @@ var ReadFileSchema = &genai.Schema{
 var ReadFileTool = &genai.Tool{
 	FunctionDeclarations: []*genai.FunctionDeclaration{
 		{
-			Name:        "ReadFile",
-			Description: "Reads the contents of a specified file and send it to you to analyze it.",
-			Parameters:  ReadFileSchema,
+			Name: "ReadFile",
+			Description: "Reads the contents of a text file and sends it to you with line numbers. PDF, Word (.docx), Excel (.xlsx) " +
+				"and OpenDocument files are converted to text locally, with page markers for PDFs. " +
+				"Use startLine and endLine to read only part of a large file. Other binary files are rejected.",
+			Parameters: ReadFileSchema,
 		},
 	},
 }
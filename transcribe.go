@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// transcribeWindow is how much of a recording is transcribed per request, so long recordings
+	// don't run into the output token limit.
+	transcribeWindow = 10 * 60.0
+	// maxTranscribeWindows bounds a transcription to about six hours.
+	maxTranscribeWindows = 36
+	// timestampSlack is how far a segment may stray outside its window before it is rejected.
+	timestampSlack   = 5.0
+	minSegmentLength = 0.5
+)
+
+// transcriptSegment is one timed line of a transcript, in seconds from the start of the recording.
+type transcriptSegment struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker,omitempty"`
+	Text    string  `json:"text"`
+}
+
+// transcriptWindow is the structured response for one window of the recording.
+type transcriptWindow struct {
+	DurationSeconds float64             `json:"durationSeconds"`
+	ReachedEnd      bool                `json:"reachedEnd"`
+	Segments        []transcriptSegment `json:"segments"`
+}
+
+// transcriptResult is what Transcribe reports back.
+type transcriptResult struct {
+	Output   string   `json:"output"`
+	Format   string   `json:"format"`
+	Segments int      `json:"segments"`
+	Duration string   `json:"duration"`
+	Requests int      `json:"requests"`
+	Warnings []string `json:"warnings,omitempty"`
+	Preview  string   `json:"preview"`
+}
+
+var transcriptSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"durationSeconds": {Type: genai.TypeNumber, Description: "Length of the whole recording in seconds."},
+		"reachedEnd":      {Type: genai.TypeBoolean, Description: "True if the recording ends within the requested range."},
+		"segments": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"start":   {Type: genai.TypeNumber, Description: "Start time in seconds from the beginning of the recording."},
+					"end":     {Type: genai.TypeNumber, Description: "End time in seconds from the beginning of the recording."},
+					"speaker": {Type: genai.TypeString, Description: "Speaker label, if speakers can be told apart."},
+					"text":    {Type: genai.TypeString},
+				},
+				Required: []string{"start", "end", "text"},
+			},
+		},
+	},
+	Required: []string{"durationSeconds", "reachedEnd", "segments"},
+}
+
+// Transcribe transcribes the speech in an audio or video file and writes it next to the source
+// as SRT, WebVTT or plain text ("talk.mp4" becomes "talk.srt"). The recording is transcribed
+// in ten-minute windows using structured output; the segments are checked for impossible or
+// out-of-order timestamps and merged into one transcript, with overlaps at window boundaries
+// removed. The output can be reverted with /undo.
+func Transcribe(ctx context.Context, client *genai.Client, filePath, format, language string) (*transcriptResult, error) {
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	if format == "" {
+		format = "srt"
+	}
+	if format == "webvtt" {
+		format = "vtt"
+	}
+	if format != "srt" && format != "vtt" && format != "txt" {
+		return nil, fmt.Errorf("invalid format '%s': expected 'srt', 'vtt' or 'txt'", format)
+	}
+
+	fullPath, err := resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if kind := detectFileType(fullPath); kind != "Audio" && kind != "Video" {
+		return nil, fmt.Errorf("%s is not an audio or video file", filepath.Base(fullPath))
+	}
+	outPath := strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + "." + format
+	if err := workspace.CheckWrite(outPath); err != nil {
+		return nil, err
+	}
+	parts, err := mediaParts(ctx, client, []string{fullPath}, maxInlineMediaTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	model := client.GenerativeModel(MediaModel)
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = transcriptSchema
+
+	var segments []transcriptSegment
+	var warnings []string
+	duration := 0.0
+	requests := 0
+	for w := 0; w < maxTranscribeWindows; w++ {
+		from := float64(w) * transcribeWindow
+		if duration > 0 && from >= duration {
+			break
+		}
+		to := from + transcribeWindow
+		prompt := fmt.Sprintf("Transcribe the speech in this recording from %s to %s, verbatim, as short segments of one or two "+
+			"sentences. Give start and end times in seconds from the beginning of the whole recording, not from %s. "+
+			"Label speakers (e.g. \"Speaker 1\") if there is more than one. If nobody speaks in this range, return no segments.",
+			formatClock(from), formatClock(to), formatClock(from))
+		if language != "" {
+			prompt += " Write the transcript in " + language + "."
+		}
+		resp, err := model.GenerateContent(ctx, append(append([]genai.Part{}, parts...), genai.Text(prompt))...)
+		requests++
+		if err != nil {
+			return nil, fmt.Errorf("error transcribing %s-%s: %v", formatClock(from), formatClock(to), err)
+		}
+		var window transcriptWindow
+		if err := json.Unmarshal([]byte(extractResponse(resp)), &window); err != nil {
+			return nil, fmt.Errorf("unexpected transcript for %s-%s: %v", formatClock(from), formatClock(to), err)
+		}
+		if window.DurationSeconds > duration {
+			duration = window.DurationSeconds
+		}
+		kept, dropped := validateSegments(window.Segments, from, to)
+		if dropped > 0 {
+			warnings = append(warnings, fmt.Sprintf("dropped %d segment(s) with invalid timestamps in %s-%s", dropped, formatClock(from), formatClock(to)))
+		}
+		segments = append(segments, kept...)
+		if window.ReachedEnd || (duration == 0 && len(window.Segments) == 0) {
+			break
+		}
+		if w == maxTranscribeWindows-1 {
+			warnings = append(warnings, fmt.Sprintf("stopped after %s", formatClock(to)))
+		}
+	}
+
+	segments = mergeSegments(segments, duration)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no speech found in %s", filepath.Base(fullPath))
+	}
+	if duration == 0 {
+		duration = segments[len(segments)-1].End
+	}
+	output := formatTranscript(segments, format)
+	if err := recordedWrite(outPath, []byte(output), 0644, "transcribe"); err != nil {
+		return nil, err
+	}
+
+	preview := formatTranscript(segments[:min(len(segments), 5)], "txt")
+	return &transcriptResult{
+		Output:   outPath,
+		Format:   format,
+		Segments: len(segments),
+		Duration: formatClock(duration),
+		Requests: requests,
+		Warnings: warnings,
+		Preview:  preview,
+	}, nil
+}
+
+// validateSegments drops segments with no text or timestamps that can't be right, and fixes
+// those that are only slightly off. Segments timed relative to the window instead of the
+// recording are shifted into place. It returns the usable segments and how many were dropped.
+func validateSegments(segments []transcriptSegment, from, to float64) ([]transcriptSegment, int) {
+	// A window whose segments all start before it began was timed from the window start.
+	if from > 0 && len(segments) > 0 {
+		relative := true
+		for _, s := range segments {
+			if s.Start >= from-timestampSlack {
+				relative = false
+				break
+			}
+		}
+		if relative {
+			for i := range segments {
+				segments[i].Start += from
+				segments[i].End += from
+			}
+		}
+	}
+
+	var kept []transcriptSegment
+	dropped := 0
+	for _, s := range segments {
+		s.Text = strings.Join(strings.Fields(s.Text), " ")
+		s.Speaker = strings.TrimSpace(s.Speaker)
+		if s.Text == "" {
+			continue
+		}
+		if math.IsNaN(s.Start) || math.IsInf(s.Start, 0) || math.IsNaN(s.End) || math.IsInf(s.End, 0) ||
+			s.Start < from-timestampSlack || s.Start > to+timestampSlack {
+			dropped++
+			continue
+		}
+		s.Start = math.Max(s.Start, 0)
+		if s.End <= s.Start {
+			// A missing or reversed end time; the merge step fits it to the next segment.
+			s.End = s.Start
+		}
+		kept = append(kept, s)
+	}
+	return kept, dropped
+}
+
+// mergeSegments puts segments from all windows in order, drops lines repeated on both sides of
+// a window boundary, trims overlaps and gives every segment a sensible end time.
+func mergeSegments(segments []transcriptSegment, duration float64) []transcriptSegment {
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+	var merged []transcriptSegment
+	for _, s := range segments {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			// Both windows often transcribe the sentence spoken across their boundary.
+			if strings.EqualFold(s.Text, prev.Text) && s.Start <= math.Max(prev.End, prev.Start)+timestampSlack {
+				prev.End = math.Max(prev.End, s.End)
+				continue
+			}
+			if prev.End <= prev.Start {
+				prev.End = prev.Start + speakingTime(prev.Text)
+			}
+			prev.End = math.Min(prev.End, s.Start)
+			if prev.End-prev.Start < minSegmentLength {
+				prev.End = prev.Start + minSegmentLength
+				s.Start = math.Max(s.Start, prev.End)
+			}
+		}
+		merged = append(merged, s)
+	}
+	if n := len(merged); n > 0 {
+		last := &merged[n-1]
+		if last.End <= last.Start {
+			last.End = last.Start + speakingTime(last.Text)
+			if duration > last.Start {
+				last.End = math.Min(last.End, duration)
+			}
+		}
+		for i := range merged {
+			merged[i].End = math.Max(merged[i].End, merged[i].Start+minSegmentLength)
+		}
+	}
+	return merged
+}
+
+// speakingTime estimates how long text takes to say, for segments without an end time.
+func speakingTime(text string) float64 {
+	return math.Max(minSegmentLength, float64(len(text))/15)
+}
+
+// formatTranscript renders segments as SRT, WebVTT or plain text with a timestamp per line.
+func formatTranscript(segments []transcriptSegment, format string) string {
+	var b strings.Builder
+	if format == "vtt" {
+		b.WriteString("WEBVTT\n\n")
+	}
+	for i, s := range segments {
+		text := s.Text
+		if s.Speaker != "" {
+			text = s.Speaker + ": " + text
+		}
+		switch format {
+		case "srt":
+			fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(s.Start, ","), formatTimestamp(s.End, ","), text)
+		case "vtt":
+			fmt.Fprintf(&b, "%s --> %s\n%s\n\n", formatTimestamp(s.Start, "."), formatTimestamp(s.End, "."), text)
+		default:
+			fmt.Fprintf(&b, "[%s] %s\n", formatClock(s.Start), text)
+		}
+	}
+	return b.String()
+}
+
+// formatTimestamp formats seconds as "hh:mm:ss,mmm", with sep before the milliseconds.
+func formatTimestamp(seconds float64, sep string) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// formatClock formats seconds as "m:ss", or "h:mm:ss" from an hour on.
+func formatClock(seconds float64) string {
+	s := int64(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		sep     string
+		want    string
+	}{
+		{0, ",", "00:00:00,000"},
+		{1.5, ",", "00:00:01,500"},
+		{61.0004, ".", "00:01:01.000"},
+		{59.9996, ",", "00:01:00,000"}, // rounds up into the next minute
+		{3723.042, ".", "01:02:03.042"},
+		{36000, ",", "10:00:00,000"},
+	}
+	for _, tt := range tests {
+		if got := formatTimestamp(tt.seconds, tt.sep); got != tt.want {
+			t.Errorf("formatTimestamp(%v, %q) = %q, want %q", tt.seconds, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestFormatClock(t *testing.T) {
+	tests := map[float64]string{0: "0:00", 59.9: "0:59", 600: "10:00", 3599: "59:59", 3600: "1:00:00", 3725: "1:02:05"}
+	for seconds, want := range tests {
+		if got := formatClock(seconds); got != want {
+			t.Errorf("formatClock(%v) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestValidateSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []transcriptSegment
+		from, to float64
+		want     []transcriptSegment
+		dropped  int
+	}{
+		{
+			name: "cleans text and fixes small errors",
+			segments: []transcriptSegment{
+				{Start: -2, End: 3, Speaker: " Speaker 1 ", Text: "  Hello,\n  world. "},
+				{Start: 4, End: 2, Text: "Reversed end."},
+				{Start: 6, End: 7, Text: "   "},
+			},
+			from: 0, to: 600,
+			want: []transcriptSegment{
+				{Start: 0, End: 3, Speaker: "Speaker 1", Text: "Hello, world."},
+				{Start: 4, End: 4, Text: "Reversed end."},
+			},
+		},
+		{
+			name: "drops impossible timestamps",
+			segments: []transcriptSegment{
+				{Start: 610, End: 615, Text: "Kept."},
+				{Start: math.NaN(), End: 620, Text: "No start."},
+				{Start: 625, End: math.Inf(1), Text: "Infinite end."},
+				{Start: 1300, End: 1305, Text: "Past the window."},
+			},
+			from: 600, to: 1200,
+			want:    []transcriptSegment{{Start: 610, End: 615, Text: "Kept."}},
+			dropped: 3,
+		},
+		{
+			name: "shifts segments timed from the window start",
+			segments: []transcriptSegment{
+				{Start: 5, End: 9, Text: "First."},
+				{Start: 30, End: 0, Text: "Second."},
+			},
+			from: 600, to: 1200,
+			want: []transcriptSegment{
+				{Start: 605, End: 609, Text: "First."},
+				{Start: 630, End: 630, Text: "Second."},
+			},
+		},
+		{
+			name: "keeps segments slightly before the window",
+			segments: []transcriptSegment{
+				{Start: 597, End: 601, Text: "Across the boundary."},
+				{Start: 20, End: 25, Text: "Misplaced."},
+			},
+			from: 600, to: 1200,
+			want:    []transcriptSegment{{Start: 597, End: 601, Text: "Across the boundary."}},
+			dropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := validateSegments(tt.segments, tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) || dropped != tt.dropped {
+				t.Errorf("got %+v, %d dropped; want %+v, %d dropped", got, dropped, tt.want, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestMergeSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []transcriptSegment
+		duration float64
+		want     []transcriptSegment
+	}{
+		{
+			name: "sorts and trims overlaps",
+			segments: []transcriptSegment{
+				{Start: 5, End: 9, Text: "Second."},
+				{Start: 0, End: 6, Text: "First."},
+			},
+			want: []transcriptSegment{
+				{Start: 0, End: 5, Text: "First."},
+				{Start: 5, End: 9, Text: "Second."},
+			},
+		},
+		{
+			name: "drops a line repeated at a window boundary",
+			segments: []transcriptSegment{
+				{Start: 590, End: 597, Text: "Before."},
+				{Start: 597, End: 601, Text: "Across the boundary."},
+				{Start: 598, End: 603, Text: "across the boundary."},
+				{Start: 603, End: 606, Text: "After."},
+			},
+			want: []transcriptSegment{
+				{Start: 590, End: 597, Text: "Before."},
+				{Start: 597, End: 603, Text: "Across the boundary."},
+				{Start: 603, End: 606, Text: "After."},
+			},
+		},
+		{
+			name: "fills in missing end times",
+			segments: []transcriptSegment{
+				{Start: 0, End: 0, Text: "Fifteen chars.."}, // one second to say
+				{Start: 10, End: 10, Text: "This one is cut off by the next."},
+				{Start: 11, End: 12, Text: "Next."},
+				{Start: 20, End: 20, Text: "The last line runs past the end of the recording."},
+			},
+			duration: 22,
+			want: []transcriptSegment{
+				{Start: 0, End: 1, Text: "Fifteen chars.."},
+				{Start: 10, End: 11, Text: "This one is cut off by the next."},
+				{Start: 11, End: 12, Text: "Next."},
+				{Start: 20, End: 22, Text: "The last line runs past the end of the recording."},
+			},
+		},
+		{
+			name: "keeps a minimum segment length",
+			segments: []transcriptSegment{
+				{Start: 10, End: 12, Text: "Short."},
+				{Start: 10.2, End: 13, Text: "Overlapping."},
+			},
+			want: []transcriptSegment{
+				{Start: 10, End: 10.5, Text: "Short."},
+				{Start: 10.5, End: 13, Text: "Overlapping."},
+			},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeSegments(tt.segments, tt.duration)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTranscript(t *testing.T) {
+	segments := []transcriptSegment{
+		{Start: 0, End: 2.5, Speaker: "Speaker 1", Text: "Hello."},
+		{Start: 2.5, End: 4, Text: "Hi."},
+	}
+	tests := map[string]string{
+		"srt": "1\n00:00:00,000 --> 00:00:02,500\nSpeaker 1: Hello.\n\n2\n00:00:02,500 --> 00:00:04,000\nHi.\n\n",
+		"vtt": "WEBVTT\n\n00:00:00.000 --> 00:00:02.500\nSpeaker 1: Hello.\n\n00:00:02.500 --> 00:00:04.000\nHi.\n\n",
+		"txt": "[0:00] Speaker 1: Hello.\n[0:02] Hi.\n",
+	}
+	for format, want := range tests {
+		if got := formatTranscript(segments, format); got != want {
+			t.Errorf("formatTranscript(%s) = %q, want %q", format, got, want)
+		}
+	}
+}
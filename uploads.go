@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// UploadCacheFile records media uploads so unchanged files aren't uploaded again. It lives in
+// the user's home directory.
+const UploadCacheFile = ".myapp_uploads.json"
+
+// uploadExpiryMargin keeps a cached upload from being used if it is about to expire mid-request.
+const uploadExpiryMargin = 10 * time.Minute
+
+// cachedUpload is a remote file uploaded for one local file's contents.
+type cachedUpload struct {
+	Name      string    `json:"name"` // remote resource name, e.g. "files/abc-123"
+	URI       string    `json:"uri"`
+	MIMEType  string    `json:"mimeType"`
+	Path      string    `json:"path"` // local path it was uploaded from
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// uploadCache maps SHA-256 hashes of local file contents to uploaded files that are still valid.
+type uploadCache struct {
+	mu      sync.Mutex
+	path    string // empty if the cache can't be persisted
+	entries map[string]cachedUpload
+}
+
+var uploads *uploadCache
+
+// newUploadCache loads the cache from the user's home directory. If that fails, uploads are
+// still cached for the current session.
+func newUploadCache() *uploadCache {
+	c := &uploadCache{entries: make(map[string]cachedUpload)}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return c
+	}
+	c.path = filepath.Join(homeDir, UploadCacheFile)
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil || c.entries == nil {
+		log.Printf("Warning: ignoring corrupt upload cache %s\n", c.path)
+		c.entries = make(map[string]cachedUpload)
+	}
+	return c
+}
+
+// get returns the upload for sum if it won't expire soon.
+func (c *uploadCache) get(sum string) (cachedUpload, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.entries[sum]
+	if !ok || (!u.ExpiresAt.IsZero() && time.Until(u.ExpiresAt) < uploadExpiryMargin) {
+		return cachedUpload{}, false
+	}
+	return u, true
+}
+
+func (c *uploadCache) put(sum string, u cachedUpload) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[sum] = u
+	c.save()
+}
+
+// forget drops every entry for the remote file name.
+func (c *uploadCache) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for sum, u := range c.entries {
+		if u.Name == name {
+			delete(c.entries, sum)
+		}
+	}
+	c.save()
+}
+
+// lookup returns the cached entry for a remote file name.
+func (c *uploadCache) lookup(name string) (cachedUpload, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, u := range c.entries {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return cachedUpload{}, false
+}
+
+// Prune drops entries that have expired and returns how many were removed.
+func (c *uploadCache) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for sum, u := range c.entries {
+		if !u.ExpiresAt.IsZero() && time.Now().After(u.ExpiresAt) {
+			delete(c.entries, sum)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.save()
+	}
+	return removed
+}
+
+// save writes the cache to disk. The caller must hold c.mu.
+func (c *uploadCache) save() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(c.path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to save upload cache: %v\n", err)
+	}
+}
+
+// uploadCached returns an active remote copy of filePath, reusing an earlier upload of the same
+// contents while it is still valid and uploading (and waiting for processing) otherwise.
+func uploadCached(ctx context.Context, client *genai.Client, filePath string) (*genai.File, error) {
+	sum, size, err := hashFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	if u, ok := uploads.get(sum); ok {
+		// The service may have deleted the file early; check before trusting the cache.
+		file, err := client.GetFile(ctx, u.Name)
+		if err == nil && file.State == genai.FileStateActive {
+			log.Printf("reusing upload %s for %s", file.Name, filepath.Base(filePath))
+			return file, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uploads.forget(u.Name)
+	}
+
+	file, err := uploadMedia(ctx, client, filePath)
+	if err != nil {
+		return nil, err
+	}
+	// Videos need to be processed before you can use them.
+	active, err := waitForActive(ctx, client, file, mediaTimeout())
+	if err != nil {
+		deleteRemoteFile(client, file.Name)
+		return nil, err
+	}
+	uploads.put(sum, cachedUpload{
+		Name:      active.Name,
+		URI:       active.URI,
+		MIMEType:  active.MIMEType,
+		Path:      filePath,
+		Size:      size,
+		ExpiresAt: active.ExpirationTime,
+	})
+	return active, nil
+}
+
+// deleteRemoteFile deletes an uploaded file and its cache entries. It uses its own context so
+// cleanup still happens after the request that triggered it was cancelled.
+func deleteRemoteFile(client *genai.Client, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	uploads.forget(name)
+	if err := client.DeleteFile(ctx, name); err != nil {
+		log.Printf("warning: failed to delete file %s: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// forgetHistoryFile replaces the parts of history that reference the uploaded file name with a
+// note, so later messages don't send the API a file it can no longer read. It returns how many
+// parts were replaced.
+func forgetHistoryFile(history []*genai.Content, name string) int {
+	replaced := 0
+	for _, c := range history {
+		for i, p := range c.Parts {
+			if fd, ok := p.(genai.FileData); ok && strings.HasSuffix(fd.URI, "/"+name) {
+				c.Parts[i] = genai.Text(fmt.Sprintf("[attached file %s was deleted]", name))
+				replaced++
+			}
+		}
+	}
+	return replaced
+}
+
+// remoteFile is one uploaded file as shown by /files.
+type remoteFile struct {
+	Name      string
+	MIMEType  string
+	Size      int64
+	ExpiresAt time.Time
+	LocalPath string // empty if the file wasn't uploaded from this machine
+}
+
+// ListRemoteFiles returns the files currently uploaded with client's API key, soonest to expire first.
+func ListRemoteFiles(ctx context.Context, client *genai.Client) ([]remoteFile, error) {
+	var files []remoteFile
+	it := client.ListFiles(ctx)
+	for {
+		f, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rf := remoteFile{Name: f.Name, MIMEType: f.MIMEType, Size: f.SizeBytes, ExpiresAt: f.ExpirationTime}
+		if u, ok := uploads.lookup(f.Name); ok {
+			rf.LocalPath = u.Path
+		}
+		files = append(files, rf)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ExpiresAt.Before(files[j].ExpiresAt) })
+	return files, nil
+}
+
+// hashFile returns the hex SHA-256 of path's contents and its size.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}